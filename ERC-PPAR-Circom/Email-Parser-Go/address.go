@@ -0,0 +1,140 @@
+package dkim
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+)
+
+// addressParser parses RFC 5322 addresses, with RFC 6532 UTF-8 addresses and
+// RFC 2047 encoded-words in display names.
+var addressParser = &mail.AddressParser{
+	WordDecoder: &mime.WordDecoder{CharsetReader: replaceCharset},
+}
+
+// replaceCharset is used for charsets the standard library can't decode. Only
+// the ASCII characters are kept, the other ones are replaced by U+FFFD: the
+// display name is approximate, but the address is still parsed.
+func replaceCharset(charset string, input io.Reader) (io.Reader, error) {
+	b, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, c := range b {
+		if c < utf8.RuneSelf {
+			buf.WriteByte(c)
+		} else {
+			buf.WriteRune(utf8.RuneError)
+		}
+	}
+	return &buf, nil
+}
+
+// ParseFromAddress parses the value of a From header field. It must contain a
+// single mailbox. The address may be an internationalized one, as defined in
+// RFC 6532, and the display name may contain RFC 2047 encoded-words.
+func ParseFromAddress(value string) (*mail.Address, error) {
+	list, err := addressParser.ParseList(strings.NewReplacer("\r\n", "", "\n", "").Replace(value))
+	if err != nil {
+		return nil, fmt.Errorf("dkim: malformed From address: %v", err)
+	}
+	if len(list) != 1 {
+		return nil, fmt.Errorf("dkim: From field has %v addresses, expected one", len(list))
+	}
+	return list[0], nil
+}
+
+// FindFromAddress returns the address of the first From header field of a
+// canonicalized header as a reveal named "from". The revealed bytes are the
+// address as written in the header: raw UTF-8 for internationalized
+// addresses.
+//
+// The address must be written on a single line: with the simple header
+// canonicalization, it can't span a folding.
+func FindFromAddress(h []byte) (*Reveal, error) {
+	start, end := -1, -1
+	for offset := 0; offset < len(h); {
+		line := h[offset:]
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i+1]
+		}
+		// Continuation lines belong to the previous field: a folded value
+		// containing "from:" mustn't be taken for a From field
+		continued := line[0] == ' ' || line[0] == '\t'
+		if start >= 0 && !continued {
+			break
+		}
+		if start < 0 && !continued {
+			if k, _, ok := bytes.Cut(line, []byte(":")); ok && asciiEqualFold(strings.Trim(string(k), " \t"), "from") {
+				start = offset + len(k) + 1
+			}
+		}
+		offset += len(line)
+		end = offset
+	}
+	if start < 0 {
+		return nil, errors.New("dkim: no From field in header")
+	}
+
+	value := string(h[start:end])
+	addr, err := ParseFromAddress(value)
+	if err != nil {
+		return nil, err
+	}
+
+	i, j := findAddrSpec(value)
+	if i < 0 {
+		return nil, errors.New("dkim: malformed From address")
+	}
+	// The raw address must be the parsed one, e.g. not a quoted local part
+	// or an address with a comment or a folding inside
+	if value[i:j] != addr.Address {
+		return nil, fmt.Errorf("dkim: From address %q can't be revealed as is", addr.Address)
+	}
+
+	return newReveal("from", h, []RevealRange{{start + i, start + j}}), nil
+}
+
+// findAddrSpec returns the position of the address in the value of a From
+// header field: the content of the last angle brackets outside quoted strings
+// and comments, or the value without its surrounding whitespace.
+func findAddrSpec(value string) (start, end int) {
+	start, end = -1, -1
+	var quoted bool
+	var comment int
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '\\' && (quoted || comment > 0):
+			i++
+		case quoted:
+			quoted = c != '"'
+		case c == '"' && comment == 0:
+			quoted = true
+		case c == '(':
+			comment++
+		case c == ')' && comment > 0:
+			comment--
+		case comment > 0:
+		case c == '<':
+			start = i + 1
+		case c == '>' && start >= 0:
+			end = i
+		}
+	}
+	if start >= 0 && end >= start {
+		return start, end
+	}
+
+	trimmed := strings.Trim(value, " \t\r\n")
+	if trimmed == "" {
+		return -1, -1
+	}
+	start = strings.Index(value, trimmed)
+	return start, start + len(trimmed)
+}
@@ -0,0 +1,86 @@
+package dkim
+
+import (
+	"testing"
+)
+
+func TestFindFromAddress(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"relaxed", "to:bob@example.com\r\nfrom:Alice <alice@example.org>\r\nsubject:hi\r\n", "alice@example.org"},
+		{"simple", "To: bob@example.com\r\nFROM : alice@example.org\r\nSubject: hi\r\n", "alice@example.org"},
+		{"folded-from", "From: Alice\r\n <alice@example.org>\r\nSubject: hi\r\n", "alice@example.org"},
+		{"last-field", "Subject: hi\r\nFrom: <alice@example.org>", "alice@example.org"},
+		{
+			// A folded value containing "from:" isn't a From field
+			"folded-subject",
+			"Subject: hi\r\n from: <attacker@evil.com>\r\nFrom: Alice <alice@example.org>\r\n",
+			"alice@example.org",
+		},
+		{
+			"folded-subject-tab",
+			"Subject: hi\r\n\tFrom:attacker@evil.com\r\nFrom: Alice <alice@example.org>\r\n",
+			"alice@example.org",
+		},
+		{
+			"folded-signature",
+			"From: alice@example.org\r\nDKIM-Signature: v=1; a=rsa-sha256; d=example.org; s=test;\r\n h=from:to:subject; bh=; b=",
+			"alice@example.org",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			h := []byte(tc.header)
+			reveal, err := FindFromAddress(h)
+			if err != nil {
+				t.Fatalf("FindFromAddress() = %v", err)
+			}
+			if string(reveal.Value) != tc.want {
+				t.Errorf("FindFromAddress() = %q, want %q", reveal.Value, tc.want)
+			}
+			if err := reveal.Check(h); err != nil {
+				t.Errorf("Reveal.Check() = %v", err)
+			}
+		})
+	}
+}
+
+func TestFindFromAddress_invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"none", "To: bob@example.com\r\nSubject: hi\r\n"},
+		{"only-folded", "Subject: hi\r\n from: <attacker@evil.com>\r\n"},
+		{"two-addresses", "From: alice@example.org, bob@example.org\r\n"},
+		{"quoted-local-part", "From: \"alice smith\"@example.org\r\n"},
+		{"comment", "From: alice(comment)@example.org\r\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if reveal, err := FindFromAddress([]byte(tc.header)); err == nil {
+				t.Errorf("FindFromAddress() = %q, want an error", reveal.Value)
+			}
+		})
+	}
+}
+
+func TestBuildWitness_foldedFrom(t *testing.T) {
+	// With the simple header canonicalization, the folding is kept in the
+	// signed header, before the From field
+	msg := "Subject: Account recovery\r\n from: <attacker@evil.com>\r\n" +
+		"From: Alice <alice@example.org>\r\n" +
+		"To: Guardian <guardian@example.com>\r\n" +
+		"\r\n" +
+		"Approve recovery code: 482911\r\n"
+	w := testWitness(t, msg, &SignOptions{
+		HeaderCanonicalization: CanonicalizationSimple,
+		HeaderKeys:             []string{"Subject", "From", "To"},
+	}, nil)
+	if string(w.Gmail) != "alice@example.org" {
+		t.Errorf("witness From address = %q, want %q", w.Gmail, "alice@example.org")
+	}
+}
@@ -0,0 +1,424 @@
+package dkim
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/subtle"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ARC header field names, as defined in RFC 8617 section 4.1.
+const (
+	arcAuthenticationResultsFieldName = "ARC-Authentication-Results"
+	arcMessageSignatureFieldName      = "ARC-Message-Signature"
+	arcSealFieldName                  = "ARC-Seal"
+)
+
+// RFC 8617 section 4.2.1: the maximum number of ARC sets.
+const maxARCInstances = 50
+
+var (
+	requiredARCMessageSignatureTags = []string{"i", "a", "b", "bh", "d", "h", "s"}
+	requiredARCSealTags             = []string{"i", "a", "b", "cv", "d", "s"}
+)
+
+// ARCChainValidation is the chain validation status of an ARC chain, as
+// defined in RFC 8617 section 4.4.
+type ARCChainValidation string
+
+const (
+	ARCChainValidationNone ARCChainValidation = "none"
+	ARCChainValidationPass ARCChainValidation = "pass"
+	ARCChainValidationFail ARCChainValidation = "fail"
+)
+
+// An ARCSet is one instance of the ARC header fields added by an
+// intermediary.
+type ARCSet struct {
+	// The instance number of the set, starting at 1.
+	Instance int
+
+	// The raw ARC-Authentication-Results, ARC-Message-Signature and ARC-Seal
+	// header fields.
+	AuthenticationResults string
+	MessageSignatureField string
+	SealField             string
+
+	// The chain validation status recorded by the sealer, i.e. the "cv" tag
+	// of the ARC-Seal.
+	ChainValidation ARCChainValidation
+
+	// The verification of the ARC-Message-Signature over the received
+	// message. Only the most recent one needs to be valid for the chain to
+	// pass, older ones usually break because of the intermediaries'
+	// modifications.
+	MessageSignature *Verification
+	// The verification of the ARC-Seal.
+	Seal *Verification
+}
+
+// An ARCResult is produced by VerifyARC.
+type ARCResult struct {
+	// The validation status of the whole chain.
+	ChainValidation ARCChainValidation
+	// The ARC sets, sorted by increasing instance number.
+	Sets []*ARCSet
+	// The lowest instance number whose ARC-Message-Signature, and all newer
+	// ones, are valid. Zero if even the most recent one is invalid.
+	OldestPass int
+
+	// Err explains why the chain failed to validate. It's nil if
+	// ChainValidation isn't ARCChainValidationFail.
+	Err error
+}
+
+// VerifyARC validates the ARC chain of a message, as specified in RFC 8617
+// section 5.2. Errors in the chain are reported in ARCResult.Err, the
+// returned error is only set if the message can't be read.
+func VerifyARC(r io.Reader, options *VerifyOptions) (*ARCResult, error) {
+	bufr := bufio.NewReader(r)
+	h, err := readHeader(bufr)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader = bufr
+	if options != nil {
+		body = newBodyReader(bufr, options.MaxBodySize)
+	}
+
+	result := new(ARCResult)
+	sets, err := parseARCSets(h)
+	result.Sets = sets
+	if err != nil {
+		result.ChainValidation = ARCChainValidationFail
+		result.Err = err
+		return result, nil
+	}
+	if len(sets) == 0 {
+		result.ChainValidation = ARCChainValidationNone
+		return result, nil
+	}
+
+	// Hash the body once for each body canonicalization in use
+	bodyHashes, err := hashARCBodies(body, sets)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, set := range sets {
+		set.MessageSignature = verifyARCMessageSignature(h, set, bodyHashes, options)
+	}
+	for i := len(sets) - 1; i >= 0; i-- {
+		set := sets[i]
+		if set.MessageSignature.Err != nil {
+			break
+		}
+		result.OldestPass = set.Instance
+	}
+	for i, set := range sets {
+		set.Seal = verifyARCSeal(sets[:i+1], options)
+	}
+
+	result.ChainValidation = ARCChainValidationPass
+	result.Err = checkARCChain(sets)
+	if result.Err != nil {
+		result.ChainValidation = ARCChainValidationFail
+	}
+	return result, nil
+}
+
+func checkARCChain(sets []*ARCSet) error {
+	latest := sets[len(sets)-1]
+	if latest.ChainValidation == ARCChainValidationFail {
+		return failError(fmt.Sprintf("ARC chain was already marked as failed by instance %v", latest.Instance))
+	}
+
+	for _, set := range sets {
+		want := ARCChainValidationPass
+		if set.Instance == 1 {
+			want = ARCChainValidationNone
+		}
+		if set.ChainValidation != want {
+			return permFailError(fmt.Sprintf("ARC-Seal instance %v has cv=%v, want cv=%v", set.Instance, set.ChainValidation, want))
+		}
+	}
+
+	if err := latest.MessageSignature.Err; err != nil {
+		return fmt.Errorf("ARC-Message-Signature instance %v: %w", latest.Instance, err)
+	}
+
+	for i := len(sets) - 1; i >= 0; i-- {
+		if err := sets[i].Seal.Err; err != nil {
+			return fmt.Errorf("ARC-Seal instance %v: %w", sets[i].Instance, err)
+		}
+	}
+	return nil
+}
+
+// parseARCSets groups the ARC header fields by instance. It returns an error
+// if the sets are incomplete, duplicated or not numbered sequentially.
+func parseARCSets(h header) ([]*ARCSet, error) {
+	byInstance := make(map[int]*ARCSet)
+	max := 0
+	for _, kv := range h {
+		k, v := parseHeaderField(kv)
+		if !isARCFieldName(k) {
+			continue
+		}
+
+		instance, err := parseARCInstance(v)
+		if err != nil {
+			return nil, permFailError(fmt.Sprintf("malformed %v header field: %v", k, err))
+		}
+		if instance > max {
+			max = instance
+		}
+
+		set, ok := byInstance[instance]
+		if !ok {
+			set = &ARCSet{Instance: instance}
+			byInstance[instance] = set
+		}
+		var field *string
+		switch {
+		case asciiEqualFold(k, arcAuthenticationResultsFieldName):
+			field = &set.AuthenticationResults
+		case asciiEqualFold(k, arcMessageSignatureFieldName):
+			field = &set.MessageSignatureField
+		default:
+			field = &set.SealField
+		}
+		if *field != "" {
+			return nil, permFailError(fmt.Sprintf("duplicate %v header field for instance %v", k, instance))
+		}
+		*field = kv
+	}
+
+	if max > maxARCInstances {
+		return nil, permFailError(fmt.Sprintf("too many ARC sets: %v", max))
+	}
+
+	sets := make([]*ARCSet, 0, max)
+	for i := 1; i <= max; i++ {
+		set, ok := byInstance[i]
+		if !ok {
+			return nil, permFailError(fmt.Sprintf("missing ARC set for instance %v", i))
+		}
+		if set.AuthenticationResults == "" || set.MessageSignatureField == "" || set.SealField == "" {
+			return nil, permFailError(fmt.Sprintf("incomplete ARC set for instance %v", i))
+		}
+
+		_, v := parseHeaderField(set.SealField)
+		params, err := parseHeaderParams(v)
+		if err != nil {
+			return nil, permFailError("malformed ARC-Seal tags: " + err.Error())
+		}
+		set.ChainValidation = ARCChainValidation(strings.ToLower(stripWhitespace(params["cv"])))
+
+		sets = append(sets, set)
+	}
+	return sets, nil
+}
+
+func isARCFieldName(k string) bool {
+	return asciiEqualFold(k, arcAuthenticationResultsFieldName) ||
+		asciiEqualFold(k, arcMessageSignatureFieldName) ||
+		asciiEqualFold(k, arcSealFieldName)
+}
+
+// parseARCInstance parses the "i" tag of an ARC header field value. For
+// ARC-Authentication-Results, it's the first element of the field.
+func parseARCInstance(v string) (int, error) {
+	for _, s := range strings.Split(v, ";") {
+		key, value, ok := strings.Cut(s, "=")
+		if !ok || stripWhitespace(key) != "i" {
+			continue
+		}
+		i, err := strconv.Atoi(stripWhitespace(value))
+		if err != nil || i < 1 {
+			return 0, fmt.Errorf("invalid instance %q", value)
+		}
+		return i, nil
+	}
+	return 0, fmt.Errorf("missing instance tag")
+}
+
+func hashARCBodies(r io.Reader, sets []*ARCSet) (map[Canonicalization][]byte, error) {
+	hashers := make(map[Canonicalization]hash.Hash)
+	var writers []io.Writer
+	var closers []io.WriteCloser
+	for _, set := range sets {
+		_, v := parseHeaderField(set.MessageSignatureField)
+		params, err := parseHeaderParams(v)
+		if err != nil {
+			continue
+		}
+		_, bodyCan := parseCanonicalization(params["c"])
+		can, ok := lookupCanonicalizer(bodyCan)
+		if _, seen := hashers[bodyCan]; seen || !ok {
+			continue
+		}
+
+		// RFC 8617 section 4.1.2: only SHA-256 is defined for ARC
+		hasher := crypto.SHA256.New()
+		hashers[bodyCan] = hasher
+		wc := can.CanonicalizeBody(hasher)
+		writers = append(writers, wc)
+		closers = append(closers, wc)
+	}
+
+	if _, err := io.Copy(io.MultiWriter(writers...), r); err != nil {
+		return nil, err
+	}
+	for _, wc := range closers {
+		if err := wc.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	sums := make(map[Canonicalization][]byte, len(hashers))
+	for can, hasher := range hashers {
+		sums[can] = hasher.Sum(nil)
+	}
+	return sums, nil
+}
+
+func verifyARCMessageSignature(h header, set *ARCSet, bodyHashes map[Canonicalization][]byte, options *VerifyOptions) *Verification {
+	verif := new(Verification)
+	verif.Err = func() error {
+		_, v := parseHeaderField(set.MessageSignatureField)
+		params, err := parseHeaderParams(v)
+		if err != nil {
+			return permFailError("malformed signature tags: " + err.Error())
+		}
+		for _, tag := range requiredARCMessageSignatureTags {
+			if _, ok := params[tag]; !ok {
+				return permFailError("signature missing required tag")
+			}
+		}
+
+		verif.Domain = stripWhitespace(params["d"])
+		verif.HeaderKeys = parseTagList(params["h"])
+		for _, k := range verif.HeaderKeys {
+			if asciiEqualFold(k, arcSealFieldName) {
+				return permFailError("ARC-Seal must not be signed")
+			}
+		}
+		if timeStr, ok := params["t"]; ok {
+			t, err := parseTime(timeStr)
+			if err != nil {
+				return permFailError("malformed time: " + err.Error())
+			}
+			verif.Time = t
+		}
+		if _, ok := params["l"]; ok {
+			return permFailError("body length tag is not allowed in ARC")
+		}
+
+		res, hash, err := queryKey(verif.Domain, params, options)
+		if err != nil {
+			return err
+		}
+
+		headerCan, bodyCan := parseCanonicalization(params["c"])
+		can, ok := lookupCanonicalizer(headerCan)
+		if !ok {
+			return permFailError("unsupported header canonicalization algorithm")
+		}
+		bodyHashed, ok := bodyHashes[bodyCan]
+		if !ok {
+			return permFailError("unsupported body canonicalization algorithm")
+		}
+
+		bh, err := decodeBase64String(params["bh"])
+		if err != nil {
+			return permFailError("malformed body hash: " + err.Error())
+		}
+		sig, err := decodeBase64String(params["b"])
+		if err != nil {
+			return permFailError("malformed signature: " + err.Error())
+		}
+		if subtle.ConstantTimeCompare(bodyHashed, bh) != 1 {
+			return failError("body hash did not verify")
+		}
+
+		hasher := hash.New()
+		if err := hashHeader(hasher, h, verif.HeaderKeys, can, set.MessageSignatureField); err != nil {
+			return err
+		}
+		if err := res.Verifier.Verify(hash, hasher.Sum(nil), sig); err != nil {
+			return failError("signature did not verify: " + err.Error())
+		}
+		return nil
+	}()
+	return verif
+}
+
+// verifyARCSeal verifies the ARC-Seal of the last set. The seal signs all
+// the ARC sets up to and including its own, in increasing instance order,
+// using relaxed header canonicalization (RFC 8617 section 5.1.1).
+func verifyARCSeal(sets []*ARCSet, options *VerifyOptions) *Verification {
+	set := sets[len(sets)-1]
+	verif := new(Verification)
+	verif.Err = func() error {
+		_, v := parseHeaderField(set.SealField)
+		params, err := parseHeaderParams(v)
+		if err != nil {
+			return permFailError("malformed seal tags: " + err.Error())
+		}
+		for _, tag := range requiredARCSealTags {
+			if _, ok := params[tag]; !ok {
+				return permFailError("seal missing required tag")
+			}
+		}
+		if _, ok := params["h"]; ok {
+			return permFailError("seal must not have a header list tag")
+		}
+
+		verif.Domain = stripWhitespace(params["d"])
+		if timeStr, ok := params["t"]; ok {
+			t, err := parseTime(timeStr)
+			if err != nil {
+				return permFailError("malformed time: " + err.Error())
+			}
+			verif.Time = t
+		}
+
+		res, hash, err := queryKey(verif.Domain, params, options)
+		if err != nil {
+			return err
+		}
+		sig, err := decodeBase64String(params["b"])
+		if err != nil {
+			return permFailError("malformed signature: " + err.Error())
+		}
+
+		can, _ := lookupCanonicalizer(CanonicalizationRelaxed)
+		hasher := hash.New()
+		for _, s := range sets {
+			fields := []string{s.AuthenticationResults, s.MessageSignatureField}
+			if s != set {
+				fields = append(fields, s.SealField)
+			}
+			for _, kv := range fields {
+				if _, err := io.WriteString(hasher, can.CanonicalizeHeader(kv)); err != nil {
+					return err
+				}
+			}
+		}
+		if err := hashHeader(hasher, nil, nil, can, set.SealField); err != nil {
+			return err
+		}
+
+		if err := res.Verifier.Verify(hash, hasher.Sum(nil), sig); err != nil {
+			return failError("signature did not verify: " + err.Error())
+		}
+		return nil
+	}()
+	return verif
+}
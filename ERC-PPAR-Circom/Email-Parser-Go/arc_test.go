@@ -0,0 +1,116 @@
+package dkim
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testARCSeal adds an ARC set to msg, signed with testRSAKey, as an
+// intermediary would.
+func testARCSeal(t *testing.T, msg []byte, cv ARCChainValidation) []byte {
+	t.Helper()
+	bufr := bufio.NewReader(bytes.NewReader(msg))
+	h, err := readHeader(bufr)
+	if err != nil {
+		t.Fatalf("readHeader() = %v", err)
+	}
+	sets, err := parseARCSets(h)
+	if err != nil {
+		t.Fatalf("parseARCSets() = %v", err)
+	}
+	instance := len(sets) + 1
+	can, _ := lookupCanonicalizer(CanonicalizationRelaxed)
+
+	var body bytes.Buffer
+	if err := canonicalizeBody(&body, bufr, can); err != nil {
+		t.Fatalf("canonicalizeBody() = %v", err)
+	}
+	bh := sha256.Sum256(body.Bytes())
+
+	sign := func(hasher interface{ Sum([]byte) []byte }) string {
+		sig, err := rsa.SignPKCS1v15(rand.Reader, testRSAKey, crypto.SHA256, hasher.Sum(nil))
+		if err != nil {
+			t.Fatalf("SignPKCS1v15() = %v", err)
+		}
+		return base64.StdEncoding.EncodeToString(sig)
+	}
+
+	aar := fmt.Sprintf("ARC-Authentication-Results: i=%v; mx.example.com; dkim=pass header.d=%v\r\n", instance, testDomain)
+
+	keys := []string{"from", "to", "subject"}
+	ams := fmt.Sprintf("ARC-Message-Signature: i=%v; a=rsa-sha256; c=relaxed/relaxed; d=example.com; s=arc; h=%v; bh=%v; b=",
+		instance, strings.Join(keys, ":"), base64.StdEncoding.EncodeToString(bh[:]))
+	hasher := sha256.New()
+	if err := hashHeader(hasher, h, keys, can, ams+crlf); err != nil {
+		t.Fatalf("hashHeader() = %v", err)
+	}
+	ams += sign(hasher) + crlf
+
+	seal := fmt.Sprintf("ARC-Seal: i=%v; a=rsa-sha256; cv=%v; d=example.com; s=arc; b=", instance, cv)
+	hasher.Reset()
+	for _, set := range sets {
+		for _, kv := range []string{set.AuthenticationResults, set.MessageSignatureField, set.SealField} {
+			hasher.Write([]byte(can.CanonicalizeHeader(kv)))
+		}
+	}
+	hasher.Write([]byte(can.CanonicalizeHeader(aar) + can.CanonicalizeHeader(ams)))
+	if err := hashHeader(hasher, nil, nil, can, seal+crlf); err != nil {
+		t.Fatalf("hashHeader() = %v", err)
+	}
+	seal += sign(hasher) + crlf
+
+	return append([]byte(seal+ams+aar), msg...)
+}
+
+func TestVerifyARC(t *testing.T) {
+	options := &VerifyOptions{LookupTXT: testLookupTXT(t, testRSAKey.Public())}
+	signed := testSign(t, testMessage, nil)
+
+	once := testARCSeal(t, signed, ARCChainValidationNone)
+	// The second intermediary modifies the body before sealing, e.g. to add
+	// a footer, which breaks the first ARC-Message-Signature
+	modified := append(append([]byte(nil), once...), "-- \r\nSent through a mailing list\r\n"...)
+	twice := testARCSeal(t, modified, ARCChainValidationPass)
+
+	tests := []struct {
+		name       string
+		msg        []byte
+		cv         ARCChainValidation
+		oldestPass int
+	}{
+		{"no chain", signed, ARCChainValidationNone, 0},
+		{"one set", once, ARCChainValidationPass, 1},
+		{"two sets", testARCSeal(t, once, ARCChainValidationPass), ARCChainValidationPass, 1},
+		{"modified body", twice, ARCChainValidationPass, 2},
+		{"chain already failed", testARCSeal(t, once, ARCChainValidationFail), ARCChainValidationFail, 1},
+		{"wrong cv", testARCSeal(t, signed, ARCChainValidationPass), ARCChainValidationFail, 1},
+		{"modified sealed set", bytes.Replace(twice, []byte("i=1; mx.example.com"), []byte("i=1; evil.example.com"), 1), ARCChainValidationFail, 2},
+		{"modified body after sealing", append(append([]byte(nil), once...), "Appended\r\n"...), ARCChainValidationFail, 0},
+		{"missing set", bytes.Replace(twice, []byte("i=1;"), []byte("i=3;"), 3), ARCChainValidationFail, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := VerifyARC(bytes.NewReader(tc.msg), options)
+			if err != nil {
+				t.Fatalf("VerifyARC() = %v", err)
+			}
+			if result.ChainValidation != tc.cv {
+				t.Errorf("ChainValidation = %v, want %v (%v)", result.ChainValidation, tc.cv, result.Err)
+			}
+			if (result.Err != nil) != (tc.cv == ARCChainValidationFail) {
+				t.Errorf("Err = %v with chain validation %v", result.Err, result.ChainValidation)
+			}
+			if result.OldestPass != tc.oldestPass {
+				t.Errorf("OldestPass = %v, want %v", result.OldestPass, tc.oldestPass)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package dkim
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// ReadCircuitInput reads circuit inputs in the JSON form expected by snarkjs,
+// such as the files written for SignatureInput, CombinedInput and
+// ClaimsInput. Values may be decimal strings or numbers. public sets
+// Signal.Public for all of them, except for the public inputs of the
+// combined circuit which are always public, see CombinedSignals.
+func ReadCircuitInput(r io.Reader, public bool) ([]Signal, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var input map[string]interface{}
+	if err := dec.Decode(&input); err != nil {
+		return nil, fmt.Errorf("dkim: malformed circuit input: %v", err)
+	}
+
+	signals := make([]Signal, 0, len(input))
+	for name, v := range input {
+		s := Signal{Name: name, Public: public || publicCombinedSignals[name]}
+		var values []interface{}
+		if array, ok := v.([]interface{}); ok {
+			values = array
+		} else {
+			s.Scalar = true
+			values = []interface{}{v}
+		}
+		for _, v := range values {
+			var str string
+			switch v := v.(type) {
+			case string:
+				str = v
+			case json.Number:
+				str = v.String()
+			default:
+				return nil, fmt.Errorf("dkim: malformed value for input %q", name)
+			}
+			n, ok := new(big.Int).SetString(str, 10)
+			if !ok {
+				return nil, fmt.Errorf("dkim: malformed value for input %q", name)
+			}
+			s.Values = append(s.Values, n)
+		}
+		signals = append(signals, s)
+	}
+
+	// JSON objects aren't ordered: use the order of the circuit declarations
+	order := make(map[string]int)
+	names := append(signatureSignalNames[:len(signatureSignalNames):len(signatureSignalNames)], combinedSignalNames...)
+	for i, name := range append(names, claimSignalNames...) {
+		order[name] = i + 1
+	}
+	sort.Slice(signals, func(i, j int) bool {
+		oi, oj := order[signals[i].Name], order[signals[j].Name]
+		if oi != oj {
+			return oi != 0 && (oj == 0 || oi < oj)
+		}
+		return signals[i].Name < signals[j].Name
+	})
+	return signals, nil
+}
+
+// AuditOptions configures AuditSignals.
+type AuditOptions struct {
+	// If LookupTXT is set, the key record of the signature is retrieved and
+	// compared to the key of the inputs. Otherwise, the key check is
+	// skipped.
+	LookupTXT func(domain string) ([]string, error)
+}
+
+// A WitnessCheck is the result of one of the checks of AuditSignals.
+type WitnessCheck struct {
+	Name string
+	// Err is nil if the check passed or was skipped.
+	Err error
+	// Skipped is true if the check couldn't be performed, e.g. the key check
+	// without AuditOptions.LookupTXT.
+	Skipped bool
+}
+
+// A WitnessAudit is the result of AuditSignals.
+type WitnessAudit struct {
+	// The witness rebuilt from the inputs, see WitnessFromSignals. If the
+	// inputs can't be decoded, it's nil and Err is set.
+	Witness *Witness
+	Err     error
+
+	Checks []WitnessCheck
+	// The signed header fields identifying the email, by lowercase name:
+	// from, to, subject, date and message-id. RFC 2047 encoded-words are
+	// decoded.
+	Fields map[string]string
+}
+
+// OK returns true if the inputs could be decoded and no check failed.
+// Skipped checks don't fail, see Complete.
+func (a *WitnessAudit) OK() bool {
+	if a.Err != nil {
+		return false
+	}
+	for _, c := range a.Checks {
+		if c.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Complete returns true if no check was skipped: the inputs may be
+// consistent, but without the key check, nothing ties them to the key
+// published by the domain.
+func (a *WitnessAudit) Complete() bool {
+	for _, c := range a.Checks {
+		if c.Skipped {
+			return false
+		}
+	}
+	return true
+}
+
+type auditCheck struct {
+	name  string
+	check func() error
+}
+
+// auditFields are the header fields reported by AuditSignals.
+var auditFields = []string{"from", "to", "subject", "date", "message-id"}
+
+// AuditSignals checks that the inputs of the rsa_verify and combined circuits
+// are consistent without the original email: the header and body are
+// rebuilt from the inputs, their hashes are computed again and the
+// signature is verified with the key of the inputs. The claims inputs are
+// checked against the rebuilt header and body. If claims is nil, the checks
+// of the claims are skipped.
+func AuditSignals(signature, combined, claims []Signal, options *AuditOptions) *WitnessAudit {
+	if options == nil {
+		options = new(AuditOptions)
+	}
+
+	d, err := decodeSignals(signature, combined, claims)
+	if err != nil {
+		return &WitnessAudit{Err: err}
+	}
+	w := d.w
+	a := &WitnessAudit{Witness: w, Fields: signedFields(w.Header)}
+
+	checkTime, checkReveals := d.checkTime, d.checkReveals
+	if !d.hasClaims {
+		checkTime, checkReveals = nil, nil
+	}
+	var checkKey func() error
+	if options.LookupTXT != nil {
+		checkKey = func() error {
+			return checkWitnessKey(w, d.params, options.LookupTXT)
+		}
+	}
+	checks := []auditCheck{
+		{"algorithm", func() error {
+			if algo := stripWhitespace(d.params["a"]); algo != "rsa-sha256" {
+				return fmt.Errorf("dkim: unsupported signature algorithm %q", algo)
+			}
+			return nil
+		}},
+		{"header-hash-inputs", d.checkHeaderHash},
+		{"header-hash", func() error {
+			if h := sha256.Sum256(w.Header); !bytes.Equal(h[:], w.HeaderHash) {
+				return errors.New("dkim: header hash input doesn't match the header")
+			}
+			return nil
+		}},
+		{"body-hash", func() error {
+			if h := sha256.Sum256(w.Body); !bytes.Equal(h[:], w.BodyHash) {
+				return errors.New("dkim: body hash input doesn't match the body")
+			}
+			bh, err := decodeBase64String(d.params["bh"])
+			if err != nil {
+				return permFailError("malformed body hash: " + err.Error())
+			}
+			if !bytes.Equal(bh, w.BodyHash) {
+				return errors.New("dkim: body hash input doesn't match the signature body hash tag")
+			}
+			return nil
+		}},
+		{"body-length", d.checkBodyLength},
+		{"signature", func() error {
+			return verifyWitnessSignature(w)
+		}},
+		{"signature-time", checkTime},
+		{"from", d.checkFrom},
+		{"reveals", checkReveals},
+		{"key", checkKey},
+	}
+
+	for _, c := range checks {
+		if c.check == nil {
+			a.Checks = append(a.Checks, WitnessCheck{Name: c.name, Skipped: true})
+			continue
+		}
+		a.Checks = append(a.Checks, WitnessCheck{Name: c.name, Err: c.check()})
+	}
+	return a
+}
+
+// verifyWitnessSignature verifies the RSA signature of the header hash with
+// the key of the witness.
+func verifyWitnessSignature(w *Witness) error {
+	if w.Modulus.Sign() <= 0 || !w.Exponent.IsInt64() || w.Exponent.Int64() > 1<<31-1 {
+		return errors.New("dkim: invalid RSA key")
+	}
+	pub := &rsa.PublicKey{N: w.Modulus, E: int(w.Exponent.Int64())}
+	if w.Signature.Cmp(pub.N) >= 0 {
+		return errors.New("dkim: signature larger than the modulus")
+	}
+	sig := w.Signature.FillBytes(make([]byte, pub.Size()))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, w.HeaderHash, sig); err != nil {
+		return fmt.Errorf("dkim: signature didn't verify: %v", err)
+	}
+	return nil
+}
+
+// checkWitnessKey compares the key of the witness to the key record of its
+// domain and selector.
+func checkWitnessKey(w *Witness, params map[string]string, lookupTXT func(domain string) ([]string, error)) error {
+	res, _, err := queryKey(w.Domain, params, &VerifyOptions{LookupTXT: lookupTXT})
+	if err != nil {
+		return err
+	}
+	pub, ok := res.Verifier.Public().(*rsa.PublicKey)
+	if !ok {
+		return errors.New("dkim: key record isn't an RSA key")
+	}
+	if pub.N.Cmp(w.Modulus) != 0 || int64(pub.E) != w.Exponent.Int64() {
+		return fmt.Errorf("dkim: key of the inputs doesn't match the key record of %v", KeyRecordName(w.Domain, w.Selector))
+	}
+	return nil
+}
+
+// signedFields returns the auditFields found in a canonicalized header.
+func signedFields(header []byte) map[string]string {
+	raw, err := ReadRawHeader(bufio.NewReader(bytes.NewReader(header)))
+	if err != nil {
+		return nil
+	}
+	picker := newHeaderPicker(raw.header())
+	fields := make(map[string]string)
+	for _, k := range auditFields {
+		kv := picker.Pick(k)
+		if kv == "" {
+			continue
+		}
+		v := strings.TrimSpace(unfoldHeaderValue(kv))
+		if decoded, err := addressParser.WordDecoder.DecodeHeader(v); err == nil {
+			v = decoded
+		}
+		fields[k] = v
+	}
+	return fields
+}
@@ -0,0 +1,191 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// auditCheckErrors returns the failed checks of an audit, by name.
+func auditCheckErrors(a *WitnessAudit) map[string]error {
+	errs := make(map[string]error)
+	for _, c := range a.Checks {
+		if c.Err != nil {
+			errs[c.Name] = c.Err
+		}
+	}
+	return errs
+}
+
+// auditSkipped returns the names of the skipped checks of an audit.
+func auditSkipped(a *WitnessAudit) []string {
+	var skipped []string
+	for _, c := range a.Checks {
+		if c.Skipped {
+			skipped = append(skipped, c.Name)
+		}
+	}
+	return skipped
+}
+
+// replaceSignal returns a copy of signals, with the values of the signal
+// name replaced.
+func replaceSignal(signals []Signal, name string, values ...*big.Int) []Signal {
+	out := append([]Signal(nil), signals...)
+	for i, s := range out {
+		if s.Name == name {
+			out[i].Values = values
+		}
+	}
+	return out
+}
+
+func TestAuditSignals(t *testing.T) {
+	w := testWitness(t, testMessage, nil, &WitnessOptions{
+		BodyReveals: []*RevealSpec{{Name: "code", Anchor: "recovery code: "}},
+	})
+	signature, combined, claims := testSignals(t, w)
+
+	a := AuditSignals(signature, combined, claims, nil)
+	if !a.OK() {
+		t.Fatalf("AuditSignals() failed: %v", auditCheckErrors(a))
+	}
+	if a.Complete() {
+		t.Errorf("AuditSignals() without a key provider is complete")
+	}
+	if skipped := auditSkipped(a); !reflect.DeepEqual(skipped, []string{"key"}) {
+		t.Errorf("skipped checks = %v, want [key]", skipped)
+	}
+	if a.Fields["from"] != "Alice <alice@example.org>" || a.Fields["subject"] != "Account recovery" {
+		t.Errorf("Fields = %v", a.Fields)
+	}
+
+	// Without the claims, their checks are skipped
+	a = AuditSignals(signature, combined, nil, nil)
+	if !a.OK() {
+		t.Fatalf("AuditSignals() without claims failed: %v", auditCheckErrors(a))
+	}
+	if skipped := auditSkipped(a); !reflect.DeepEqual(skipped, []string{"signature-time", "reveals", "key"}) {
+		t.Errorf("skipped checks without claims = %v, want [signature-time reveals key]", skipped)
+	}
+	if len(a.Witness.BodyReveals) != 0 {
+		t.Errorf("witness audited without claims has reveals")
+	}
+
+	a = AuditSignals(signature, combined, claims, &AuditOptions{LookupTXT: testLookupTXT(t, testRSAKey.Public())})
+	if !a.OK() || !a.Complete() {
+		t.Errorf("AuditSignals() with the key = %v, complete = %v, want OK and complete", auditCheckErrors(a), a.Complete())
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+	a = AuditSignals(signature, combined, claims, &AuditOptions{LookupTXT: testLookupTXT(t, other.Public())})
+	if errs := auditCheckErrors(a); len(errs) != 1 || errs["key"] == nil {
+		t.Errorf("AuditSignals() with another key failed checks %v, want key", errs)
+	}
+}
+
+func TestAuditSignals_tampered(t *testing.T) {
+	w := testWitness(t, testMessage, nil, &WitnessOptions{
+		BodyReveals: []*RevealSpec{{Name: "code", Anchor: "recovery code: "}},
+	})
+	signature, combined, claims := testSignals(t, w)
+
+	body := make([]*big.Int, len(w.Body))
+	for i, c := range bytes.Replace(w.Body, []byte("482911"), []byte("000000"), 1) {
+		body[i] = big.NewInt(int64(c))
+	}
+	attackerHigh, attackerLow := prepareHashInput([]byte("attacker@evil.com"))
+	one := big.NewInt(1)
+	exponent := []*big.Int{big.NewInt(3)}
+	for len(exponent) < rsaLimbs {
+		exponent = append(exponent, new(big.Int))
+	}
+
+	tests := []struct {
+		name      string
+		signature []Signal
+		combined  []Signal
+		claims    []Signal
+		check     string
+	}{
+		{"body", signature, replaceSignal(combined, "body", body...), claims, "body-hash"},
+		{"gmail-hash", signature, replaceSignal(combined, "gmailHash", attackerHigh, attackerLow), claims, "from"},
+		{"signature-time", signature, combined, replaceSignal(claims, "signatureTime", big.NewInt(testTime.Unix()+1)), "signature-time"},
+		{"exponent", replaceSignal(signature, "exp", exponent...), combined, claims, "signature"},
+		{"reveal-mask", signature, combined, replaceSignal(claims, "codeMask", append([]*big.Int{one}, signalValues(claims, "codeMask")[1:]...)...), "reveals"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := AuditSignals(tc.signature, tc.combined, tc.claims, nil)
+			if a.Err != nil {
+				t.Fatalf("AuditSignals() = %v", a.Err)
+			}
+			if a.OK() {
+				t.Fatalf("AuditSignals() succeeded")
+			}
+			if errs := auditCheckErrors(a); errs[tc.check] == nil {
+				t.Errorf("AuditSignals() failed checks %v, want %v", errs, tc.check)
+			}
+		})
+	}
+}
+
+// signalValues returns the values of the signal name.
+func signalValues(signals []Signal, name string) []*big.Int {
+	for _, s := range signals {
+		if s.Name == name {
+			return s.Values
+		}
+	}
+	return nil
+}
+
+func TestAuditSignals_spoofedFrom(t *testing.T) {
+	// A folded Subject field containing "from:", signed before the From
+	// field with the simple header canonicalization: inputs attesting the
+	// address of the folded value must be rejected
+	msg := "Subject: Account recovery\r\n from: <attacker@evil.com>\r\n" +
+		"From: Alice <alice@example.org>\r\n" +
+		"To: Guardian <guardian@example.com>\r\n" +
+		"\r\n" +
+		"Approve recovery code: 482911\r\n"
+	w := testWitness(t, msg, &SignOptions{
+		HeaderCanonicalization: CanonicalizationSimple,
+		HeaderKeys:             []string{"Subject", "From", "To"},
+	}, nil)
+	signature, combined, claims := testSignals(t, w)
+
+	if a := AuditSignals(signature, combined, claims, nil); !a.OK() {
+		t.Fatalf("AuditSignals() failed: %v", auditCheckErrors(a))
+	}
+
+	high, low := prepareHashInput([]byte("attacker@evil.com"))
+	spoofed := replaceSignal(combined, "gmailHash", high, low)
+	a := AuditSignals(signature, spoofed, claims, nil)
+	if errs := auditCheckErrors(a); errs["from"] == nil {
+		t.Errorf("AuditSignals() failed checks %v, want from", errs)
+	}
+	if _, err := WitnessFromSignals(signature, spoofed, claims); err == nil {
+		t.Errorf("WitnessFromSignals() succeeded with the spoofed From address hash")
+	}
+}
+
+func TestAuditSignals_twoFromFields(t *testing.T) {
+	// Both From fields are signed: scanning the header finds the first one,
+	// while verifiers pick the last one
+	msg := "From: Mallory <mallory@example.org>\r\n" + testMessage
+	w := testWitness(t, msg, &SignOptions{HeaderKeys: []string{"From", "From", "To", "Subject"}}, nil)
+	signature, combined, claims := testSignals(t, w)
+
+	a := AuditSignals(signature, combined, claims, nil)
+	if errs := auditCheckErrors(a); errs["from"] == nil || !strings.Contains(errs["from"].Error(), "From field") {
+		t.Errorf("AuditSignals() failed checks %v, want from", errs)
+	}
+}
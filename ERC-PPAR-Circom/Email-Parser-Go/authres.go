@@ -0,0 +1,289 @@
+package dkim
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const authResultsFieldName = "Authentication-Results"
+
+// AuthResult is the result of an authentication method, as defined in RFC
+// 8601 section 2.7.1.
+type AuthResult string
+
+const (
+	AuthResultNone      AuthResult = "none"
+	AuthResultPass      AuthResult = "pass"
+	AuthResultFail      AuthResult = "fail"
+	AuthResultPolicy    AuthResult = "policy"
+	AuthResultNeutral   AuthResult = "neutral"
+	AuthResultTempError AuthResult = "temperror"
+	AuthResultPermError AuthResult = "permerror"
+)
+
+// An AuthenticationResult is one result of an Authentication-Results header
+// field.
+type AuthenticationResult struct {
+	// The authentication method, e.g. "dkim" or "spf".
+	Method string
+	Result AuthResult
+	// The optional reason of the result.
+	Reason string
+	// The method properties, e.g. "header.d" for DKIM.
+	Properties map[string]string
+}
+
+// VerificationResult returns the DKIM result matching a verification.
+func VerificationResult(v *Verification) AuthResult {
+	switch err := v.Err; {
+	case err == nil:
+		return AuthResultPass
+	case isFail(err):
+		return AuthResultFail
+	case IsPolicyFail(err):
+		return AuthResultPolicy
+	case IsTempFail(err):
+		return AuthResultTempError
+	case IsPermFail(err):
+		return AuthResultPermError
+	default:
+		return AuthResultNeutral
+	}
+}
+
+// FormatAuthenticationResults formats an Authentication-Results header field
+// for the verifications returned by VerifyWithOptions. authServID identifies
+// the authentication service, usually the host name of the mail server.
+//
+// The returned value contains both the header field name, its value and the
+// final CRLF.
+func FormatAuthenticationResults(authServID string, verifs []*Verification) string {
+	resinfos := []string{authServID}
+	if len(verifs) == 0 {
+		resinfos = append(resinfos, "dkim="+string(AuthResultNone))
+	}
+	for _, v := range verifs {
+		result := VerificationResult(v)
+		resinfo := "dkim=" + string(result)
+		if v.Err != nil {
+			reason := strings.TrimPrefix(v.Err.Error(), "dkim: ")
+			resinfo += " reason=" + formatAuthResultsValue(reason)
+		}
+		if v.Domain != "" {
+			resinfo += " header.d=" + formatAuthResultsValue(v.Domain)
+		}
+		if v.Identifier != "" {
+			resinfo += " header.i=" + formatAuthResultsValue(v.Identifier)
+		}
+		if v.Selector != "" {
+			resinfo += " header.s=" + formatAuthResultsValue(v.Selector)
+		}
+		if v.Signature != "" {
+			// RFC 6008 section 4: the first 8 characters are enough to tell
+			// signatures apart.
+			b := v.Signature
+			if len(b) > 8 {
+				b = b[:8]
+			}
+			resinfo += " header.b=" + formatAuthResultsValue(b)
+		}
+		resinfos = append(resinfos, resinfo)
+	}
+
+	return authResultsFieldName + ": " + strings.Join(resinfos, ";"+crlf+" ") + crlf
+}
+
+// formatAuthResultsValue quotes v if it isn't a valid token.
+func formatAuthResultsValue(v string) string {
+	for _, ch := range v {
+		if ch <= ' ' || ch >= 0x7f || strings.ContainsRune(`()<>,;:\"[]?=`, ch) {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+		}
+	}
+	return v
+}
+
+// ParseAuthenticationResults parses the value of an Authentication-Results
+// header field. It returns the authentication service identifier and the
+// results.
+func ParseAuthenticationResults(v string) (string, []*AuthenticationResult, error) {
+	parts, err := splitAuthResults(stripAuthResultsComments(v))
+	if err != nil {
+		return "", nil, err
+	}
+
+	// The authserv-id may be followed by a version
+	authServID, _, _ := strings.Cut(strings.TrimSpace(parts[0]), " ")
+	if authServID == "" {
+		return "", nil, errors.New("dkim: missing authserv-id in Authentication-Results")
+	}
+
+	var results []*AuthenticationResult
+	for _, part := range parts[1:] {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		pairs, err := parseAuthResultsPairs(part)
+		if err != nil {
+			return authServID, nil, err
+		}
+		if len(pairs) == 1 && pairs[0][1] == "" && strings.EqualFold(pairs[0][0], "none") {
+			// No authentication was performed
+			continue
+		}
+
+		method, _, _ := strings.Cut(pairs[0][0], "/")
+		res := &AuthenticationResult{
+			Method:     strings.ToLower(method),
+			Result:     AuthResult(strings.ToLower(pairs[0][1])),
+			Properties: make(map[string]string),
+		}
+		for _, pair := range pairs[1:] {
+			if strings.EqualFold(pair[0], "reason") {
+				res.Reason = pair[1]
+			} else {
+				res.Properties[strings.ToLower(pair[0])] = pair[1]
+			}
+		}
+		results = append(results, res)
+	}
+
+	return authServID, results, nil
+}
+
+// MatchVerification returns true if the result is a DKIM result for the same
+// signature as v, i.e. its header.d and header.b properties match.
+func (r *AuthenticationResult) MatchVerification(v *Verification) bool {
+	if r.Method != "dkim" || !strings.EqualFold(r.Properties["header.d"], v.Domain) {
+		return false
+	}
+	b, ok := r.Properties["header.b"]
+	if !ok {
+		return true
+	}
+	return b != "" && strings.HasPrefix(v.Signature, b)
+}
+
+// stripAuthResultsComments removes the comments, outside of quoted strings.
+func stripAuthResultsComments(v string) string {
+	var sb strings.Builder
+	depth := 0
+	quoted := false
+	escaped := false
+	for _, ch := range v {
+		switch {
+		case escaped:
+			escaped = false
+		case ch == '\\' && (quoted || depth > 0):
+			escaped = true
+		case quoted:
+			if ch == '"' {
+				quoted = false
+			}
+		case ch == '(':
+			if depth == 0 {
+				// A comment separates tokens like whitespace does
+				sb.WriteRune(' ')
+			}
+			depth++
+			continue
+		case ch == ')' && depth > 0:
+			depth--
+			continue
+		case depth > 0:
+		case ch == '"':
+			quoted = true
+		}
+		if depth == 0 {
+			sb.WriteRune(ch)
+		}
+	}
+	return sb.String()
+}
+
+// splitAuthResults splits v on semicolons outside of quoted strings.
+func splitAuthResults(v string) ([]string, error) {
+	var parts []string
+	start := 0
+	quoted := false
+	escaped := false
+	for i, ch := range v {
+		switch {
+		case escaped:
+			escaped = false
+		case ch == '\\' && quoted:
+			escaped = true
+		case ch == '"':
+			quoted = !quoted
+		case ch == ';' && !quoted:
+			parts = append(parts, v[start:i])
+			start = i + 1
+		}
+	}
+	if quoted {
+		return nil, errors.New("dkim: unterminated quoted string in Authentication-Results")
+	}
+	return append(parts, v[start:]), nil
+}
+
+// parseAuthResultsPairs parses a list of whitespace-separated key=value
+// pairs. A key without value is returned with an empty value.
+func parseAuthResultsPairs(s string) ([][2]string, error) {
+	var pairs [][2]string
+	isSpace := func(ch byte) bool {
+		return ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n'
+	}
+
+	i := 0
+	for {
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		if i == len(s) {
+			return pairs, nil
+		}
+
+		start := i
+		for i < len(s) && !isSpace(s[i]) && s[i] != '=' {
+			i++
+		}
+		key := s[start:i]
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		if i == len(s) || s[i] != '=' {
+			pairs = append(pairs, [2]string{key, ""})
+			continue
+		}
+		i++
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+
+		var value strings.Builder
+		if i < len(s) && s[i] == '"' {
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, errors.New("dkim: unterminated quoted string in Authentication-Results")
+			}
+			i++
+		} else {
+			for i < len(s) && !isSpace(s[i]) {
+				value.WriteByte(s[i])
+				i++
+			}
+		}
+
+		if key == "" {
+			return nil, fmt.Errorf("dkim: malformed Authentication-Results: %q", s)
+		}
+		pairs = append(pairs, [2]string{key, value.String()})
+	}
+}
@@ -0,0 +1,131 @@
+package dkim
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormatAuthenticationResults(t *testing.T) {
+	lookup := testLookupTXT(t, testRSAKey.Public())
+	pass := testVerify(t, testSign(t, testMessage, nil), &VerifyOptions{LookupTXT: lookup})
+	signed := testSign(t, testMessage, nil)
+	fail := testVerify(t, append(signed, "Appended\r\n"...), &VerifyOptions{LookupTXT: lookup})
+
+	v := FormatAuthenticationResults("mx.example.com", []*Verification{pass, fail})
+	if !strings.HasPrefix(v, "Authentication-Results: mx.example.com;\r\n dkim=pass ") || !strings.HasSuffix(v, "\r\n") {
+		t.Fatalf("FormatAuthenticationResults() = %q", v)
+	}
+
+	_, value := parseHeaderField(v)
+	authServID, results, err := ParseAuthenticationResults(value)
+	if err != nil {
+		t.Fatalf("ParseAuthenticationResults() = %v", err)
+	}
+	if authServID != "mx.example.com" {
+		t.Errorf("authserv-id = %q, want %q", authServID, "mx.example.com")
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %v results, want 2", len(results))
+	}
+	for i, want := range []struct {
+		verif  *Verification
+		result AuthResult
+	}{{pass, AuthResultPass}, {fail, AuthResultFail}} {
+		r := results[i]
+		if r.Method != "dkim" || r.Result != want.result {
+			t.Errorf("result %v = %v=%v, want dkim=%v", i, r.Method, r.Result, want.result)
+		}
+		if r.Properties["header.d"] != testDomain || r.Properties["header.s"] != testSelector {
+			t.Errorf("result %v properties = %v", i, r.Properties)
+		}
+		if !r.MatchVerification(want.verif) {
+			t.Errorf("result %v doesn't match its verification", i)
+		}
+	}
+	if results[1].Reason != "body hash did not verify" {
+		t.Errorf("reason = %q, want %q", results[1].Reason, "body hash did not verify")
+	}
+
+	if v := FormatAuthenticationResults("mx.example.com", nil); v != "Authentication-Results: mx.example.com;\r\n dkim=none\r\n" {
+		t.Errorf("FormatAuthenticationResults() without verification = %q", v)
+	}
+}
+
+func TestParseAuthenticationResults(t *testing.T) {
+	tests := []struct {
+		value      string
+		authServID string
+		results    []*AuthenticationResult
+	}{
+		{
+			value:      "example.org 1; none",
+			authServID: "example.org",
+		},
+		{
+			value:      ` mx.google.com; dkim=pass (test mode) header.i=@example.org header.s=sel header.b="AbCd;=1"; spf=fail (sender) smtp.mailfrom=a@example.org`,
+			authServID: "mx.google.com",
+			results: []*AuthenticationResult{
+				{
+					Method:     "dkim",
+					Result:     AuthResultPass,
+					Properties: map[string]string{"header.i": "@example.org", "header.s": "sel", "header.b": "AbCd;=1"},
+				},
+				{
+					Method:     "spf",
+					Result:     AuthResultFail,
+					Properties: map[string]string{"smtp.mailfrom": "a@example.org"},
+				},
+			},
+		},
+		{
+			value:      `example.com; dkim/1=FAIL reason="bad \"sig\"" header.d=example.org`,
+			authServID: "example.com",
+			results: []*AuthenticationResult{
+				{
+					Method:     "dkim",
+					Result:     AuthResultFail,
+					Reason:     `bad "sig"`,
+					Properties: map[string]string{"header.d": "example.org"},
+				},
+			},
+		},
+	}
+	for _, tc := range tests {
+		authServID, results, err := ParseAuthenticationResults(tc.value)
+		if err != nil {
+			t.Errorf("ParseAuthenticationResults(%q) = %v", tc.value, err)
+			continue
+		}
+		if authServID != tc.authServID {
+			t.Errorf("ParseAuthenticationResults(%q) authserv-id = %q, want %q", tc.value, authServID, tc.authServID)
+		}
+		if !reflect.DeepEqual(results, tc.results) {
+			t.Errorf("ParseAuthenticationResults(%q) = %+v, want %+v", tc.value, results, tc.results)
+		}
+	}
+
+	for _, v := range []string{"", "; dkim=pass", `example.com; dkim=pass reason="unterminated`, "example.com; =pass"} {
+		if _, _, err := ParseAuthenticationResults(v); err == nil {
+			t.Errorf("ParseAuthenticationResults(%q) = nil, want an error", v)
+		}
+	}
+}
+
+func TestVerificationResult(t *testing.T) {
+	tests := []struct {
+		err  error
+		want AuthResult
+	}{
+		{nil, AuthResultPass},
+		{failError("body hash did not verify"), AuthResultFail},
+		{policyError("key is in testing mode"), AuthResultPolicy},
+		{tempFailError("DNS timeout"), AuthResultTempError},
+		{permFailError("malformed signature"), AuthResultPermError},
+	}
+	for _, tc := range tests {
+		if got := VerificationResult(&Verification{Err: tc.err}); got != tc.want {
+			t.Errorf("VerificationResult(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
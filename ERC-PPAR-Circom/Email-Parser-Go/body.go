@@ -0,0 +1,83 @@
+package dkim
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrBodyTooLarge is returned when a message body exceeds the configured
+// maximum size.
+var ErrBodyTooLarge = errors.New("dkim: message body too large")
+
+// maxBytesReader reads at most N bytes from R. Unlike io.LimitReader, it
+// returns ErrBodyTooLarge instead of io.EOF when more data is available. If N
+// is zero or negative, there is no limit.
+type maxBytesReader struct {
+	R io.Reader
+	N int64
+}
+
+func newBodyReader(r io.Reader, max int64) io.Reader {
+	if max <= 0 {
+		return r
+	}
+	return &maxBytesReader{R: r, N: max}
+}
+
+func (r *maxBytesReader) Read(b []byte) (int, error) {
+	if r.N < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	// Read one more byte than allowed to detect oversized bodies
+	if int64(len(b)) > r.N+1 {
+		b = b[:r.N+1]
+	}
+	n, err := r.R.Read(b)
+	if int64(n) > r.N {
+		n = int(r.N)
+		r.N = -1
+		return n, ErrBodyTooLarge
+	}
+	r.N -= int64(n)
+	return n, err
+}
+
+// bodyCapture keeps the canonicalized body bytes needed by the circuit. Writes
+// beyond Max bytes fail with ErrBodyTooLarge. If Max is zero or negative,
+// there is no limit.
+//
+// The combined circuit hashes the whole signed body itself, so all of it is
+// kept, not only the revealed ranges: keeping less would require the circuit
+// to start from a precomputed SHA-256 state. The body hash is computed as the
+// body is streamed, and with a body length tag, the unsigned bytes following
+// the signed prefix are neither hashed nor kept.
+type bodyCapture struct {
+	Max int64
+
+	buf []byte
+}
+
+func (c *bodyCapture) Write(b []byte) (int, error) {
+	if c.Max > 0 && int64(len(c.buf))+int64(len(b)) > c.Max {
+		return 0, ErrBodyTooLarge
+	}
+	c.buf = append(c.buf, b...)
+	return len(b), nil
+}
+
+// Bytes returns the captured bytes.
+func (c *bodyCapture) Bytes() []byte {
+	return c.buf
+}
+
+// canonicalizeBody streams the body read from r through the canonicalizer
+// can, and writes the result to w. The body is never held in memory as a
+// whole: only the canonicalizer's trailing line break buffer and whatever w
+// retains are kept.
+func canonicalizeBody(w io.Writer, r io.Reader, can Canonicalizer) error {
+	wc := can.CanonicalizeBody(w)
+	if _, err := io.Copy(wc, r); err != nil {
+		return err
+	}
+	return wc.Close()
+}
@@ -0,0 +1,102 @@
+package dkim
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMaxBytesReader(t *testing.T) {
+	tests := []struct {
+		size int
+		max  int64
+		err  error
+	}{
+		{10, 0, nil},
+		{10, 10, nil},
+		{10, 11, nil},
+		{11, 10, ErrBodyTooLarge},
+		{1 << 20, 1000, ErrBodyTooLarge},
+	}
+	for _, tc := range tests {
+		b, err := io.ReadAll(newBodyReader(strings.NewReader(strings.Repeat("a", tc.size)), tc.max))
+		if !errors.Is(err, tc.err) {
+			t.Errorf("reading %v bytes with a maximum of %v: err = %v, want %v", tc.size, tc.max, err, tc.err)
+		}
+		if tc.err == nil && len(b) != tc.size {
+			t.Errorf("reading %v bytes with a maximum of %v: got %v bytes", tc.size, tc.max, len(b))
+		}
+	}
+}
+
+func TestBodyCapture(t *testing.T) {
+	c := &bodyCapture{Max: 8}
+	if _, err := io.WriteString(c, "abcd"); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if _, err := io.WriteString(c, "efgh"); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if _, err := io.WriteString(c, "i"); !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("Write() past the maximum = %v, want ErrBodyTooLarge", err)
+	}
+	if string(c.Bytes()) != "abcdefgh" {
+		t.Errorf("Bytes() = %q, want %q", c.Bytes(), "abcdefgh")
+	}
+}
+
+func TestCanonicalizeBody_chunks(t *testing.T) {
+	body := "Hello  \t World \r\n\r\nsecond line\r\n\r\n\r\n"
+	for _, name := range []Canonicalization{CanonicalizationSimple, CanonicalizationRelaxed} {
+		c, _ := lookupCanonicalizer(name)
+		var want bytes.Buffer
+		if err := canonicalizeBody(&want, strings.NewReader(body), c); err != nil {
+			t.Fatalf("%v: canonicalizeBody() = %v", name, err)
+		}
+		// A one byte buffer makes the canonicalizer see every split
+		var got bytes.Buffer
+		if err := canonicalizeBody(&got, &oneByteReader{strings.NewReader(body)}, c); err != nil {
+			t.Fatalf("%v: canonicalizeBody() = %v", name, err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("%v: canonicalized body read byte by byte = %q, want %q", name, got.String(), want.String())
+		}
+	}
+}
+
+type oneByteReader struct {
+	r io.Reader
+}
+
+func (r *oneByteReader) Read(b []byte) (int, error) {
+	if len(b) > 1 {
+		b = b[:1]
+	}
+	return r.r.Read(b)
+}
+
+func TestBuildWitness_maxBodySize(t *testing.T) {
+	msg := testMessage + strings.Repeat("attachment line\r\n", 1000)
+	signed := testSign(t, msg, nil)
+	lookup := testLookupTXT(t, testRSAKey.Public())
+
+	_, err := BuildWitness(bytes.NewReader(signed), &WitnessOptions{LookupTXT: lookup, MaxBodySize: 1000})
+	if !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("BuildWitness() = %v, want ErrBodyTooLarge", err)
+	}
+
+	w, err := BuildWitness(bytes.NewReader(signed), &WitnessOptions{LookupTXT: lookup, MaxBodySize: 1 << 20})
+	if err != nil {
+		t.Fatalf("BuildWitness() = %v", err)
+	}
+	if !strings.HasSuffix(string(w.Body), "attachment line\r\n") {
+		t.Errorf("witness body doesn't end with the last line of the message")
+	}
+
+	_, err = VerifyWithOptions(bytes.NewReader(signed), &VerifyOptions{LookupTXT: lookup, MaxBodySize: 1000})
+	if !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("VerifyWithOptions() = %v, want ErrBodyTooLarge", err)
+	}
+}
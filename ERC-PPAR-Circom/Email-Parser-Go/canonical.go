@@ -1,8 +1,10 @@
 package dkim
 
 import (
+	"fmt"
 	"io"
 	"strings"
+	"sync"
 )
 
 // Canonicalization is a canonicalization algorithm.
@@ -13,14 +15,69 @@ const (
 	CanonicalizationRelaxed                  = "relaxed"
 )
 
-type canonicalizer interface {
+// A Canonicalizer implements a canonicalization algorithm, as described in
+// RFC 6376 section 3.4. A Canonicalizer must be safe for concurrent use.
+type Canonicalizer interface {
+	// CanonicalizeHeader canonicalizes a raw header field, including its name
+	// and its final CRLF. The result must end with CRLF.
 	CanonicalizeHeader(s string) string
+	// CanonicalizeBody returns a writer canonicalizing the body written to it
+	// and writing the result to w. The body may be written in chunks of any
+	// size. Close flushes the remaining data, it doesn't close w.
 	CanonicalizeBody(w io.Writer) io.WriteCloser
 }
 
-var canonicalizers = map[Canonicalization]canonicalizer{
-	CanonicalizationSimple:  new(simpleCanonicalizer),
-	CanonicalizationRelaxed: new(relaxedCanonicalizer),
+var (
+	canonicalizersMu sync.RWMutex
+	canonicalizers   = map[Canonicalization]Canonicalizer{
+		CanonicalizationSimple:  new(simpleCanonicalizer),
+		CanonicalizationRelaxed: new(relaxedCanonicalizer),
+	}
+)
+
+// RegisterCanonicalization makes a canonicalization algorithm available to
+// signers and verifiers under the provided name. It is meant to be called
+// from init functions, it panics if the name is invalid or already
+// registered, or if c is nil.
+//
+// Canonicalizers must be deterministic and idempotent, and their body
+// canonicalization must not depend on how the body is split into writes.
+func RegisterCanonicalization(name Canonicalization, c Canonicalizer) {
+	if c == nil {
+		panic("dkim: RegisterCanonicalization canonicalizer is nil")
+	}
+	if !isCanonicalizationName(string(name)) {
+		panic(fmt.Sprintf("dkim: invalid canonicalization name %q", name))
+	}
+
+	canonicalizersMu.Lock()
+	defer canonicalizersMu.Unlock()
+	if _, dup := canonicalizers[name]; dup {
+		panic(fmt.Sprintf("dkim: RegisterCanonicalization called twice for %q", name))
+	}
+	canonicalizers[name] = c
+}
+
+func lookupCanonicalizer(name Canonicalization) (Canonicalizer, bool) {
+	canonicalizersMu.RLock()
+	defer canonicalizersMu.RUnlock()
+	c, ok := canonicalizers[name]
+	return c, ok
+}
+
+// isCanonicalizationName checks that name can be used in the "c" tag, i.e.
+// that it's a hyphenated word (RFC 6376 section 3.5).
+func isCanonicalizationName(name string) bool {
+	if name == "" || name[0] == '-' || name[len(name)-1] == '-' {
+		return false
+	}
+	for _, ch := range name {
+		isAlnum := (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+		if !isAlnum && ch != '-' {
+			return false
+		}
+	}
+	return true
 }
 
 // crlfFixer fixes any lone LF without a preceding CR.
@@ -112,10 +169,12 @@ type relaxedCanonicalizer struct{}
 func (c *relaxedCanonicalizer) CanonicalizeHeader(s string) string {
 	k, v, ok := strings.Cut(s, ":")
 	if !ok {
-		return strings.TrimSpace(strings.ToLower(s)) + ":" + crlf
+		return strings.Trim(asciiToLower(s), " \t\r\n") + ":" + crlf
 	}
 
-	k = strings.TrimSpace(strings.ToLower(k))
+	// Only ASCII whitespace and letters are folded: RFC 6532 headers may
+	// contain UTF-8, which is signed as is
+	k = strings.Trim(asciiToLower(k), " \t\r\n")
 	v = strings.Join(strings.FieldsFunc(v, func(r rune) bool {
 		return r == ' ' || r == '\t' || r == '\n' || r == '\r'
 	}), " ")
@@ -128,15 +187,16 @@ type relaxedBodyCanonicalizer struct {
 	wsp       bool
 	written   bool
 	crlfFixer crlfFixer
-	canonical []byte
+	// buf is reused across writes to avoid allocating for each chunk
+	buf []byte
 }
 
-func (c *relaxedBodyCanonicalizer) Write(b []byte) ( int, error) {
+func (c *relaxedBodyCanonicalizer) Write(b []byte) (int, error) {
 	written := len(b)
 
 	b = c.crlfFixer.Fix(b)
 
-	canonical := make([]byte, 0, len(b))
+	canonical := c.buf[:0]
 	for _, ch := range b {
 		if ch == ' ' || ch == '\t' {
 			c.wsp = true
@@ -156,19 +216,20 @@ func (c *relaxedBodyCanonicalizer) Write(b []byte) ( int, error) {
 			canonical = append(canonical, ch)
 		}
 	}
+	c.buf = canonical
 
-	if !c.written && len(canonical) > 0 {
-		c.written = true
-		c.canonical = canonical
+	if len(canonical) == 0 {
+		return written, nil
 	}
+	c.written = true
 
 	_, err := c.w.Write(canonical)
-	return  written, err
+	return written, err
 }
 
 func (c *relaxedBodyCanonicalizer) Close() error {
 	if c.written {
-		if  _, err := c.w.Write([]byte(crlf)); err != nil {
+		if _, err := c.w.Write([]byte(crlf)); err != nil {
 			return err
 		}
 	}
@@ -179,11 +240,23 @@ func (c *relaxedCanonicalizer) CanonicalizeBody(w io.Writer) io.WriteCloser {
 	return &relaxedBodyCanonicalizer{w: w}
 }
 
+// limitedWriter writes the first N bytes to W, and silently discards the
+// rest.
 type limitedWriter struct {
 	W io.Writer
 	N int64
 }
 
+// limitBodyWriter returns a writer forwarding only the first n bytes to w. If
+// n is negative, w is returned as is and the returned limitedWriter is nil.
+func limitBodyWriter(w io.Writer, n int64) (io.Writer, *limitedWriter) {
+	if n < 0 {
+		return w, nil
+	}
+	lw := &limitedWriter{W: w, N: n}
+	return lw, lw
+}
+
 func (w *limitedWriter) Write(b []byte) (int, error) {
 	if w.N <= 0 {
 		return len(b), nil
@@ -191,8 +264,8 @@ func (w *limitedWriter) Write(b []byte) (int, error) {
 
 	skipped := 0
 	if int64(len(b)) > w.N {
-		b = b[:w.N]
 		skipped = int(int64(len(b)) - w.N)
+		b = b[:w.N]
 	}
 
 	n, err := w.W.Write(b)
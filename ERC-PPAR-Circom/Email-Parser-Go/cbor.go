@@ -0,0 +1,149 @@
+package dkim
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// cborWitness is the CBOR form of a Witness. Integer keys keep it compact,
+// and the reveal masks and values are derived from the body when decoding.
+type cborWitness struct {
+	Domain      string       `cbor:"1,keyasint,omitempty"`
+	Selector    string       `cbor:"2,keyasint,omitempty"`
+	Testing     bool         `cbor:"3,keyasint,omitempty"`
+	Header      []byte       `cbor:"4,keyasint"`
+	HeaderHash  []byte       `cbor:"5,keyasint"`
+	Time        *int64       `cbor:"6,keyasint,omitempty"`
+	TimeRange   *[2]int      `cbor:"7,keyasint,omitempty"`
+	Body        []byte       `cbor:"8,keyasint"`
+	BodyHash    []byte       `cbor:"9,keyasint"`
+	BodyLength  *int64       `cbor:"10,keyasint,omitempty"`
+	Signature   []byte       `cbor:"11,keyasint"`
+	Modulus     []byte       `cbor:"12,keyasint"`
+	Exponent    []byte       `cbor:"13,keyasint"`
+	Gmail       []byte       `cbor:"14,keyasint"`
+	BodyReveals []cborReveal `cbor:"15,keyasint,omitempty"`
+	KeyProof    *DNSSECProof `cbor:"16,keyasint,omitempty"`
+
+	SignatureIndex         int              `cbor:"17,keyasint,omitempty"`
+	HeaderCanonicalization Canonicalization `cbor:"18,keyasint,omitempty"`
+	BodyCanonicalization   Canonicalization `cbor:"19,keyasint,omitempty"`
+}
+
+type cborReveal struct {
+	Name   string   `cbor:"1,keyasint"`
+	Ranges [][2]int `cbor:"2,keyasint"`
+	Text   []byte   `cbor:"3,keyasint,omitempty"`
+}
+
+var cborEncMode, _ = cbor.CoreDetEncOptions().EncMode()
+
+// MarshalWitnessCBOR encodes a witness in a compact, deterministic CBOR
+// form, which can be decoded with UnmarshalWitnessCBOR.
+func MarshalWitnessCBOR(w *Witness) ([]byte, error) {
+	cw := &cborWitness{
+		Domain:     w.Domain,
+		Selector:   w.Selector,
+		Testing:    w.Testing,
+		Header:     w.Header,
+		HeaderHash: w.HeaderHash,
+		Body:       w.Body,
+		BodyHash:   w.BodyHash,
+		Signature:  bigBytes(w.Signature),
+		Modulus:    bigBytes(w.Modulus),
+		Exponent:   bigBytes(w.Exponent),
+		Gmail:      w.Gmail,
+		KeyProof:   w.KeyProof,
+
+		SignatureIndex:         w.SignatureIndex,
+		HeaderCanonicalization: w.HeaderCanonicalization,
+		BodyCanonicalization:   w.BodyCanonicalization,
+	}
+	if !w.Time.IsZero() {
+		t := w.Time.Unix()
+		cw.Time = &t
+		cw.TimeRange = &[2]int{w.TimeRange.Start, w.TimeRange.End}
+	}
+	if w.Partial {
+		l := w.BodyLength
+		cw.BodyLength = &l
+	}
+	for _, reveal := range w.BodyReveals {
+		cr := cborReveal{Name: reveal.Name, Text: reveal.Text}
+		for _, r := range reveal.Ranges {
+			cr.Ranges = append(cr.Ranges, [2]int{r.Start, r.End})
+		}
+		cw.BodyReveals = append(cw.BodyReveals, cr)
+	}
+	return cborEncMode.Marshal(cw)
+}
+
+// UnmarshalWitnessCBOR decodes a witness encoded by MarshalWitnessCBOR.
+func UnmarshalWitnessCBOR(b []byte) (*Witness, error) {
+	var cw cborWitness
+	if err := cbor.Unmarshal(b, &cw); err != nil {
+		return nil, fmt.Errorf("dkim: malformed CBOR witness: %v", err)
+	}
+
+	w := &Witness{
+		Domain:     cw.Domain,
+		Selector:   cw.Selector,
+		Testing:    cw.Testing,
+		Header:     cw.Header,
+		HeaderHash: cw.HeaderHash,
+		Body:       cw.Body,
+		BodyHash:   cw.BodyHash,
+		Signature:  bytesBig(cw.Signature),
+		Modulus:    bytesBig(cw.Modulus),
+		Exponent:   bytesBig(cw.Exponent),
+		Gmail:      cw.Gmail,
+		KeyProof:   cw.KeyProof,
+
+		SignatureIndex:         cw.SignatureIndex,
+		HeaderCanonicalization: cw.HeaderCanonicalization,
+		BodyCanonicalization:   cw.BodyCanonicalization,
+	}
+	if cw.Time != nil {
+		w.Time = time.Unix(*cw.Time, 0)
+	}
+	if cw.TimeRange != nil {
+		w.TimeRange = RevealRange{cw.TimeRange[0], cw.TimeRange[1]}
+	}
+	if cw.BodyLength != nil {
+		w.Partial = true
+		w.BodyLength = *cw.BodyLength
+	}
+	for _, cr := range cw.BodyReveals {
+		var ranges []RevealRange
+		for _, r := range cr.Ranges {
+			if r[0] < 0 || r[0] > r[1] || r[1] > len(w.Body) {
+				return nil, fmt.Errorf("dkim: reveal %q has an invalid range", cr.Name)
+			}
+			ranges = append(ranges, RevealRange{r[0], r[1]})
+		}
+		reveal := newReveal(cr.Name, w.Body, ranges)
+		if err := reveal.Check(w.Body); err != nil {
+			return nil, err
+		}
+		reveal.Text = cr.Text
+		w.BodyReveals = append(w.BodyReveals, reveal)
+	}
+	return w, nil
+}
+
+func bigBytes(x *big.Int) []byte {
+	if x == nil {
+		return nil
+	}
+	return x.Bytes()
+}
+
+func bytesBig(b []byte) *big.Int {
+	if b == nil {
+		return nil
+	}
+	return new(big.Int).SetBytes(b)
+}
@@ -0,0 +1,81 @@
+package dkim
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestWitnessCBOR(t *testing.T) {
+	w := testPartialWitness(t)
+	w.BodyReveals[0].Text = []byte("482911")
+	w.KeyProof = &DNSSECProof{
+		Name:   "test._domainkey.example.org.",
+		RRsets: []*DNSSECRRset{{Records: []string{"record"}, Signatures: []string{"signature"}}},
+	}
+
+	b, err := MarshalWitnessCBOR(w)
+	if err != nil {
+		t.Fatalf("MarshalWitnessCBOR() = %v", err)
+	}
+	again, err := MarshalWitnessCBOR(w)
+	if err != nil {
+		t.Fatalf("MarshalWitnessCBOR() = %v", err)
+	}
+	if !bytes.Equal(b, again) {
+		t.Errorf("MarshalWitnessCBOR() isn't deterministic")
+	}
+
+	got, err := UnmarshalWitnessCBOR(b)
+	if err != nil {
+		t.Fatalf("UnmarshalWitnessCBOR() = %v", err)
+	}
+	checkDecodedWitness(t, got, w)
+	if got.HeaderCanonicalization != w.HeaderCanonicalization || got.BodyCanonicalization != w.BodyCanonicalization {
+		t.Errorf("decoded canonicalization = %v/%v, want %v/%v", got.HeaderCanonicalization, got.BodyCanonicalization, w.HeaderCanonicalization, w.BodyCanonicalization)
+	}
+	if !bytes.Equal(got.BodyReveals[0].Text, w.BodyReveals[0].Text) {
+		t.Errorf("decoded reveal text = %q, want %q", got.BodyReveals[0].Text, w.BodyReveals[0].Text)
+	}
+	if !reflect.DeepEqual(got.KeyProof, w.KeyProof) {
+		t.Errorf("decoded key proof = %+v, want %+v", got.KeyProof, w.KeyProof)
+	}
+
+	// The decoded witness gives the same circuit inputs
+	signature, combined, claims := testSignals(t, w)
+	gotSignature, gotCombined, gotClaims := testSignals(t, got)
+	if !signalsEqual(gotSignature, signature) || !signalsEqual(gotCombined, combined) || !signalsEqual(gotClaims, claims) {
+		t.Errorf("decoded witness doesn't give the same circuit inputs")
+	}
+}
+
+func TestWitnessCBOR_minimal(t *testing.T) {
+	w := testWitness(t, testMessage, nil, nil)
+	b, err := MarshalWitnessCBOR(w)
+	if err != nil {
+		t.Fatalf("MarshalWitnessCBOR() = %v", err)
+	}
+	got, err := UnmarshalWitnessCBOR(b)
+	if err != nil {
+		t.Fatalf("UnmarshalWitnessCBOR() = %v", err)
+	}
+	checkDecodedWitness(t, got, w)
+	if got.Partial || got.KeyProof != nil || got.BodyReveals != nil {
+		t.Errorf("decoded witness has a body length, a key proof or reveals")
+	}
+}
+
+func TestWitnessCBOR_invalid(t *testing.T) {
+	w := testPartialWitness(t)
+	w.BodyReveals[0].Ranges[0].End = len(w.Body) + 1
+	b, err := MarshalWitnessCBOR(w)
+	if err != nil {
+		t.Fatalf("MarshalWitnessCBOR() = %v", err)
+	}
+	if _, err := UnmarshalWitnessCBOR(b); err == nil {
+		t.Errorf("UnmarshalWitnessCBOR() succeeded with a reveal range past the body")
+	}
+	if _, err := UnmarshalWitnessCBOR([]byte("not cbor")); err == nil {
+		t.Errorf("UnmarshalWitnessCBOR() succeeded with malformed data")
+	}
+}
@@ -0,0 +1,104 @@
+// Command dkim-keygen generates a DKIM private key and prints the DNS TXT
+// record publishing its public key.
+//
+// The private key is written as a PKCS #8 PEM file. For RSA keys, the record
+// is printed both with the public key encoded as SubjectPublicKeyInfo and as
+// RSAPublicKey (PKCS #1): verifiers accept both.
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	dkim "email-parser-go"
+	"golang.org/x/crypto/ed25519"
+)
+
+func main() {
+	var (
+		keyType  = flag.String("t", "rsa", "key type (rsa or ed25519)")
+		nBits    = flag.Int("b", 2048, "number of bits in the RSA key (1024 to 4096)")
+		filename = flag.String("f", "dkim.priv", "private key filename")
+		domain   = flag.String("d", "", "signing domain, to print the record name")
+		selector = flag.String("s", "", "selector, to print the record name")
+	)
+	flag.Parse()
+
+	var privKey crypto.Signer
+	switch *keyType {
+	case "rsa":
+		// RFC 8301 section 3.2: signers MUST use RSA keys of at least 1024
+		// bits
+		if *nBits < 1024 || *nBits > 4096 {
+			log.Fatalf("invalid RSA key size %v: must be between 1024 and 4096 bits", *nBits)
+		}
+		key, err := rsa.GenerateKey(rand.Reader, *nBits)
+		if err != nil {
+			log.Fatalf("failed to generate RSA key: %v", err)
+		}
+		privKey = key
+	case "ed25519":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			log.Fatalf("failed to generate Ed25519 key: %v", err)
+		}
+		privKey = key
+	default:
+		log.Fatalf("unsupported key type %q", *keyType)
+	}
+
+	privBytes, err := x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		log.Fatalf("failed to marshal private key: %v", err)
+	}
+	f, err := os.OpenFile(*filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		log.Fatalf("failed to create key file: %v", err)
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: privBytes}); err != nil {
+		log.Fatalf("failed to write key PEM block: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("failed to close key file: %v", err)
+	}
+	log.Printf("private key written to %v", *filename)
+
+	record, err := dkim.FormatKeyRecord(privKey.Public())
+	if err != nil {
+		log.Fatalf("failed to format key record: %v", err)
+	}
+
+	name := ""
+	if *domain != "" && *selector != "" {
+		name = dkim.KeyRecordName(*domain, *selector) + " IN TXT "
+	}
+	fmt.Println(name + formatTXT(record))
+	if pub, ok := privKey.Public().(*rsa.PublicKey); ok {
+		fmt.Println(name + formatTXT(dkim.FormatPKCS1KeyRecord(pub)))
+	}
+}
+
+// formatTXT splits a record into quoted strings of at most 255 bytes, the
+// maximum length of a TXT record string.
+func formatTXT(record string) string {
+	var s string
+	for len(record) > 0 {
+		n := len(record)
+		if n > 255 {
+			n = 255
+		}
+		if s != "" {
+			s += " "
+		}
+		s += `"` + record[:n] + `"`
+		record = record[n:]
+	}
+	return s
+}
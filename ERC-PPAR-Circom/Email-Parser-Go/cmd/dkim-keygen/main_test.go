@@ -0,0 +1,23 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatTXT(t *testing.T) {
+	tests := []struct {
+		record string
+		want   string
+	}{
+		{"v=DKIM1; p=abc", `"v=DKIM1; p=abc"`},
+		{strings.Repeat("a", 255), `"` + strings.Repeat("a", 255) + `"`},
+		{strings.Repeat("a", 256), `"` + strings.Repeat("a", 255) + `" "a"`},
+		{strings.Repeat("a", 600), `"` + strings.Repeat("a", 255) + `" "` + strings.Repeat("a", 255) + `" "` + strings.Repeat("a", 90) + `"`},
+	}
+	for _, tc := range tests {
+		if got := formatTXT(tc.record); got != tc.want {
+			t.Errorf("formatTXT() of %v bytes = %q, want %q", len(tc.record), got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Command dkim-verify verifies the DKIM signatures of the messages stored in
+// mbox files or Maildir directories, and writes a report with one line per
+// signature.
+//
+// Usage:
+//
+//	dkim-verify [options] <mbox or Maildir>...
+//
+// The report is either CSV (default) or JSON Lines, with the following
+// fields: location, message-id, from, d, s, verdict, class and error. The
+// verdict is the Authentication-Results DKIM result, "none" for messages
+// without signature. The class summarizes the failure: "temp", "perm",
+// "fail", "policy", or "message" if the message itself couldn't be read.
+//
+// Once done, a summary is logged: the number of messages, of signatures which
+// didn't pass, and of messages which couldn't be read or parsed, e.g. because
+// they exceed -max-size. The latter are counted apart, since none of their
+// signatures could be checked.
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"os"
+	"runtime"
+	"strings"
+
+	dkim "email-parser-go"
+)
+
+// A report line.
+type result struct {
+	Location  string `json:"location"`
+	MessageID string `json:"messageId"`
+	From      string `json:"from"`
+	Domain    string `json:"d"`
+	Selector  string `json:"s"`
+	Verdict   string `json:"verdict"`
+	Class     string `json:"class"`
+	Error     string `json:"error"`
+}
+
+var csvHeader = []string{"location", "message-id", "from", "d", "s", "verdict", "class", "error"}
+
+func main() {
+	var (
+		format  = flag.String("format", "csv", "report format (csv or jsonl)")
+		output  = flag.String("o", "", "report file (default stdout)")
+		workers = flag.Int("j", runtime.NumCPU(), "number of concurrent verifications")
+		maxSize = flag.Int64("max-size", 50<<20, "maximum message size in bytes, 0 for no limit")
+		keyDir  = flag.String("keys", "", "read key records from this directory instead of DNS")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: dkim-verify [options] <mbox or Maildir>...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *format != "csv" && *format != "jsonl" {
+		log.Fatalf("unknown report format %q", *format)
+	}
+	if *workers < 1 {
+		*workers = 1
+	}
+
+	options := &dkim.VerifyOptions{
+		MaxBodySize: *maxSize,
+		// Archives usually hold many messages signed with the same keys
+		KeyCache: dkim.NewKeyCache(nil),
+	}
+	if *keyDir != "" {
+		options.LookupTXT = dkim.KeyDirLookup(*keyDir)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	rw, err := newReportWriter(w, *format)
+	if err != nil {
+		log.Fatalf("failed to write report: %v", err)
+	}
+
+	msgs := make(chan *message)
+	go func() {
+		defer close(msgs)
+		for _, path := range flag.Args() {
+			if err := readArchive(path, *maxSize, msgs); err != nil {
+				log.Printf("failed to read %v: %v", path, err)
+			}
+		}
+	}()
+
+	// Verify messages concurrently, but write the report in order: jobs are
+	// queued in order, and the report waits for the result of each of them
+	type job struct {
+		msg     *message
+		results chan []*result
+	}
+	jobs := make(chan *job)
+	queue := make(chan *job, 2**workers)
+	go func() {
+		defer close(jobs)
+		defer close(queue)
+		for msg := range msgs {
+			j := &job{msg, make(chan []*result, 1)}
+			queue <- j
+			jobs <- j
+		}
+	}()
+	for i := 0; i < *workers; i++ {
+		go func() {
+			for j := range jobs {
+				j.results <- verifyMessage(j.msg, options)
+			}
+		}()
+	}
+
+	var sum summary
+	for j := range queue {
+		results := <-j.results
+		for _, res := range results {
+			if err := rw.Write(res); err != nil {
+				log.Fatalf("failed to write report: %v", err)
+			}
+		}
+		sum.add(results)
+	}
+	if err := rw.Flush(); err != nil {
+		log.Fatalf("failed to write report: %v", err)
+	}
+
+	log.Print(&sum)
+}
+
+// summary counts the results of the verified messages.
+type summary struct {
+	messages int
+	// fails counts the signatures which didn't pass.
+	fails int
+	// unreadable counts the messages which couldn't be read or parsed, and
+	// thus have no verifiable signature. They aren't counted in fails.
+	unreadable int
+}
+
+// add counts the results of a message.
+func (s *summary) add(results []*result) {
+	s.messages++
+	for _, res := range results {
+		if res.Class == "message" {
+			s.unreadable++
+			continue
+		}
+		switch dkim.AuthResult(res.Verdict) {
+		case dkim.AuthResultPass, dkim.AuthResultNone:
+		default:
+			s.fails++
+		}
+	}
+}
+
+func (s *summary) String() string {
+	return fmt.Sprintf("verified %v messages, %v signatures didn't pass, %v messages couldn't be read or parsed", s.messages, s.fails, s.unreadable)
+}
+
+// verifyMessage verifies the signatures of a message and returns one result
+// per signature.
+func verifyMessage(msg *message, options *dkim.VerifyOptions) []*result {
+	res := &result{Location: msg.Location, Verdict: string(dkim.AuthResultNone)}
+	if msg.Err != nil {
+		res.Class, res.Error = "message", msg.Err.Error()
+		return []*result{res}
+	}
+
+	if m, err := mail.ReadMessage(bytes.NewReader(msg.Data)); err == nil {
+		res.MessageID = strings.TrimSpace(m.Header.Get("Message-Id"))
+		res.From = m.Header.Get("From")
+		if addr, err := dkim.ParseFromAddress(res.From); err == nil {
+			res.From = addr.Address
+		}
+	}
+
+	verifs, err := dkim.VerifyWithOptions(bytes.NewReader(msg.Data), options)
+	if err != nil && err != dkim.ErrTooManySignatures {
+		res.Verdict = string(dkim.AuthResultPermError)
+		res.Class, res.Error = "message", err.Error()
+		return []*result{res}
+	}
+	if len(verifs) == 0 {
+		return []*result{res}
+	}
+
+	results := make([]*result, len(verifs))
+	for i, v := range verifs {
+		r := *res
+		r.Domain = v.Domain
+		r.Selector = v.Selector
+		r.Verdict = string(dkim.VerificationResult(v))
+		if v.Err != nil {
+			r.Class, r.Error = errorClass(v.Err), v.Err.Error()
+		}
+		results[i] = &r
+	}
+	return results
+}
+
+func errorClass(err error) string {
+	switch {
+	case dkim.IsTempFail(err):
+		return "temp"
+	case dkim.IsPermFail(err):
+		return "perm"
+	case dkim.IsPolicyFail(err):
+		return "policy"
+	default:
+		return "fail"
+	}
+}
+
+type reportWriter struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+func newReportWriter(w io.Writer, format string) (*reportWriter, error) {
+	if format == "jsonl" {
+		return &reportWriter{json: json.NewEncoder(w)}, nil
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	return &reportWriter{csv: cw}, nil
+}
+
+func (rw *reportWriter) Write(res *result) error {
+	if rw.json != nil {
+		return rw.json.Encode(res)
+	}
+	return rw.csv.Write([]string{
+		res.Location,
+		res.MessageID,
+		res.From,
+		res.Domain,
+		res.Selector,
+		res.Verdict,
+		res.Class,
+		res.Error,
+	})
+}
+
+func (rw *reportWriter) Flush() error {
+	if rw.csv == nil {
+		return nil
+	}
+	rw.csv.Flush()
+	return rw.csv.Error()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+
+	dkim "email-parser-go"
+)
+
+const testMessage = "From: Alice <alice@example.org>\r\n" +
+	"To: Guardian <guardian@example.com>\r\n" +
+	"Subject: Account recovery\r\n" +
+	"Message-ID: <recovery@example.org>\r\n" +
+	"\r\n" +
+	"Approve recovery code: 482911\r\n"
+
+func TestVerifyMessage(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+	record, err := dkim.FormatKeyRecord(pub)
+	if err != nil {
+		t.Fatalf("FormatKeyRecord() = %v", err)
+	}
+	var b bytes.Buffer
+	options := &dkim.SignOptions{Domain: "example.org", Selector: "test", Signer: priv}
+	if err := dkim.Sign(&b, strings.NewReader(testMessage), options); err != nil {
+		t.Fatalf("Sign() = %v", err)
+	}
+	signed := b.Bytes()
+	verifyOptions := &dkim.VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			return []string{record}, nil
+		},
+	}
+
+	tests := []struct {
+		name    string
+		msg     *message
+		maxSize int64
+		verdict dkim.AuthResult
+		class   string
+	}{
+		{"pass", &message{Data: signed}, 0, dkim.AuthResultPass, ""},
+		{"fail", &message{Data: bytes.Replace(signed, []byte("482911"), []byte("000000"), 1)}, 0, dkim.AuthResultFail, "fail"},
+		{"unsigned", &message{Data: []byte(testMessage)}, 0, dkim.AuthResultNone, ""},
+		{"unreadable", &message{Err: errors.New("message too large")}, 0, dkim.AuthResultNone, "message"},
+		{"body-too-large", &message{Data: signed}, 10, dkim.AuthResultPermError, "message"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.msg.Location = "inbox:1"
+			options := *verifyOptions
+			options.MaxBodySize = tc.maxSize
+			results := verifyMessage(tc.msg, &options)
+			if len(results) != 1 {
+				t.Fatalf("verifyMessage() returned %v results, want 1", len(results))
+			}
+			res := results[0]
+			if res.Verdict != string(tc.verdict) || res.Class != tc.class {
+				t.Errorf("verifyMessage() = %v (%q), want %v (%q)", res.Verdict, res.Class, tc.verdict, tc.class)
+			}
+			if res.Location != "inbox:1" {
+				t.Errorf("verifyMessage() location = %q, want %q", res.Location, "inbox:1")
+			}
+			if tc.msg.Err == nil && (res.MessageID != "<recovery@example.org>" || res.From != "alice@example.org") {
+				t.Errorf("verifyMessage() = %+v, want the Message-ID and From fields", res)
+			}
+		})
+	}
+}
+
+func TestSummary(t *testing.T) {
+	var sum summary
+	sum.add([]*result{{Verdict: "pass"}, {Verdict: "fail", Class: "fail"}})
+	sum.add([]*result{{Verdict: "none"}})
+	sum.add([]*result{{Verdict: "temperror", Class: "temp"}})
+	sum.add([]*result{{Verdict: "none", Class: "message"}})
+	sum.add([]*result{{Verdict: "permerror", Class: "message"}})
+
+	want := summary{messages: 5, fails: 2, unreadable: 2}
+	if sum != want {
+		t.Errorf("summary = %+v, want %+v", sum, want)
+	}
+	if s := sum.String(); s != "verified 5 messages, 2 signatures didn't pass, 2 messages couldn't be read or parsed" {
+		t.Errorf("summary.String() = %q", s)
+	}
+}
+
+func TestReportWriter(t *testing.T) {
+	res := &result{Location: "inbox:1", MessageID: "a@b", From: "alice@example.org", Domain: "example.org", Selector: "test", Verdict: "pass"}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"csv", "location,message-id,from,d,s,verdict,class,error\ninbox:1,a@b,alice@example.org,example.org,test,pass,,\n"},
+		{"jsonl", `{"location":"inbox:1","messageId":"a@b","from":"alice@example.org","d":"example.org","s":"test","verdict":"pass","class":"","error":""}` + "\n"},
+	}
+	for _, tc := range tests {
+		var b bytes.Buffer
+		rw, err := newReportWriter(&b, tc.format)
+		if err != nil {
+			t.Fatalf("newReportWriter() = %v", err)
+		}
+		if err := rw.Write(res); err != nil {
+			t.Fatalf("reportWriter.Write() = %v", err)
+		}
+		if err := rw.Flush(); err != nil {
+			t.Fatalf("reportWriter.Flush() = %v", err)
+		}
+		if b.String() != tc.want {
+			t.Errorf("%v report = %q, want %q", tc.format, b.String(), tc.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// A message read from an archive.
+type message struct {
+	// Location identifies the message: its file name for Maildir, the mbox
+	// file name and the message index for mbox.
+	Location string
+	Data     []byte
+	// Err is set if the message couldn't be read.
+	Err error
+}
+
+// readArchive sends the messages of an mbox file or a Maildir directory to
+// ch.
+func readArchive(path string, maxSize int64, ch chan<- *message) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return readMaildir(path, maxSize, ch)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return readMbox(path, f, maxSize, ch)
+}
+
+// readMaildir reads the messages stored in the "cur" and "new" directories
+// of a Maildir, including the ones of Maildir++ sub-folders.
+func readMaildir(dir string, maxSize int64, ch chan<- *message) error {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		switch filepath.Base(filepath.Dir(path)) {
+		case "cur", "new":
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		msg := &message{Location: path}
+		if fi, err := os.Stat(path); err != nil {
+			msg.Err = err
+		} else if maxSize > 0 && fi.Size() > maxSize {
+			msg.Err = fmt.Errorf("message too large (%v bytes)", fi.Size())
+		} else if b, err := os.ReadFile(path); err != nil {
+			msg.Err = err
+		} else {
+			msg.Data = fixLineEndings(b)
+		}
+		ch <- msg
+	}
+	return nil
+}
+
+// readMbox reads the messages of an mbox file. Lines matching ">+From " are
+// unescaped as in the mboxrd variant.
+func readMbox(name string, r io.Reader, maxSize int64, ch chan<- *message) error {
+	br := bufio.NewReader(r)
+
+	var (
+		msg      *message
+		buf      bytes.Buffer
+		tooLarge bool
+		n        int
+	)
+	flush := func() {
+		if msg == nil {
+			return
+		}
+		if tooLarge {
+			msg.Err = fmt.Errorf("message too large (more than %v bytes)", maxSize)
+		} else {
+			// The line break before the next "From " line is part of the
+			// mbox format. The buffer is reused for the next message, so
+			// its bytes are copied.
+			b := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+			msg.Data = fixLineEndings(bytes.Clone(b))
+		}
+		ch <- msg
+		msg = nil
+		buf.Reset()
+		tooLarge = false
+	}
+
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			if bytes.HasPrefix(line, []byte("From ")) {
+				flush()
+				n++
+				msg = &message{Location: fmt.Sprintf("%v:%v", name, n)}
+			} else if msg == nil {
+				return fmt.Errorf("%v: not an mbox file", name)
+			} else if !tooLarge {
+				if isEscapedFromLine(line) {
+					line = line[1:]
+				}
+				buf.Write(line)
+				if maxSize > 0 && int64(buf.Len()) > maxSize {
+					tooLarge = true
+					buf.Reset()
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	flush()
+	return nil
+}
+
+// isEscapedFromLine returns true if the line matches ">+From ".
+func isEscapedFromLine(line []byte) bool {
+	i := 0
+	for i < len(line) && line[i] == '>' {
+		i++
+	}
+	return i > 0 && bytes.HasPrefix(line[i:], []byte("From "))
+}
+
+// fixLineEndings converts the line endings of a message stored with LF line
+// endings back to CRLF, as they were when the message was signed.
+func fixLineEndings(b []byte) []byte {
+	if bytes.Contains(b, []byte("\r\n")) {
+		return b
+	}
+	return bytes.ReplaceAll(b, []byte("\n"), []byte("\r\n"))
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// collect returns the messages sent by read.
+func collect(t *testing.T, read func(ch chan<- *message) error) []*message {
+	t.Helper()
+	ch := make(chan *message)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(ch)
+		errCh <- read(ch)
+	}()
+	var msgs []*message
+	for msg := range ch {
+		msgs = append(msgs, msg)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("reading archive: %v", err)
+	}
+	return msgs
+}
+
+func TestReadMbox(t *testing.T) {
+	mbox := "From alice@example.org Tue Nov 14 22:13:20 2023\n" +
+		"Subject: first\n" +
+		"\n" +
+		">From the start\n" +
+		">>From here\n" +
+		"\n" +
+		"From bob@example.org Tue Nov 14 22:13:21 2023\n" +
+		"Subject: second\r\n" +
+		"\r\n" +
+		"body\r\n" +
+		"\n" +
+		"From carol@example.org Tue Nov 14 22:13:22 2023\n" +
+		"Subject: third\n" +
+		"\n" +
+		strings.Repeat("a", 100) + "\n"
+
+	msgs := collect(t, func(ch chan<- *message) error {
+		return readMbox("inbox", strings.NewReader(mbox), 50, ch)
+	})
+	if len(msgs) != 3 {
+		t.Fatalf("read %v messages, want 3", len(msgs))
+	}
+
+	want := []struct {
+		location string
+		data     string
+		err      bool
+	}{
+		{"inbox:1", "Subject: first\r\n\r\nFrom the start\r\n>From here\r\n", false},
+		{"inbox:2", "Subject: second\r\n\r\nbody\r\n", false},
+		{"inbox:3", "", true},
+	}
+	for i, msg := range msgs {
+		w := want[i]
+		if msg.Location != w.location {
+			t.Errorf("message %v location = %q, want %q", i, msg.Location, w.location)
+		}
+		if (msg.Err != nil) != w.err {
+			t.Errorf("message %v error = %v, want error = %v", i, msg.Err, w.err)
+		}
+		if string(msg.Data) != w.data {
+			t.Errorf("message %v data = %q, want %q", i, msg.Data, w.data)
+		}
+	}
+}
+
+func TestReadMbox_invalid(t *testing.T) {
+	ch := make(chan *message, 1)
+	if err := readMbox("inbox", strings.NewReader("Subject: not an mbox\n"), 0, ch); err == nil {
+		t.Errorf("readMbox() succeeded for a file not starting with a From line")
+	}
+}
+
+func TestReadMaildir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"cur/1:2,S":         "Subject: seen\n\nbody\n",
+		"new/2":             "Subject: new\r\n\r\nbody\r\n",
+		"tmp/3":             "Subject: being delivered\n\nbody\n",
+		".Archive/cur/4:2,": "Subject: archived\n\nbody\n",
+		"new/5":             "Subject: large\n\n" + strings.Repeat("a", 100) + "\n",
+		"maildirfolder":     "",
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs := collect(t, func(ch chan<- *message) error {
+		return readArchive(dir, 50, ch)
+	})
+
+	want := []struct {
+		name string
+		data string
+		err  bool
+	}{
+		{".Archive/cur/4:2,", "Subject: archived\r\n\r\nbody\r\n", false},
+		{"cur/1:2,S", "Subject: seen\r\n\r\nbody\r\n", false},
+		{"new/2", "Subject: new\r\n\r\nbody\r\n", false},
+		{"new/5", "", true},
+	}
+	if len(msgs) != len(want) {
+		t.Fatalf("read %v messages, want %v", len(msgs), len(want))
+	}
+	for i, msg := range msgs {
+		w := want[i]
+		if msg.Location != filepath.Join(dir, w.name) {
+			t.Errorf("message %v location = %q, want %q", i, msg.Location, w.name)
+		}
+		if (msg.Err != nil) != w.err {
+			t.Errorf("message %v error = %v, want error = %v", i, msg.Err, w.err)
+		}
+		if string(msg.Data) != w.data {
+			t.Errorf("message %v data = %q, want %q", i, msg.Data, w.data)
+		}
+	}
+}
+
+func TestIsEscapedFromLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{">From here\n", true},
+		{">>>From here\n", true},
+		{"From here\n", false},
+		{"> From here\n", false},
+		{">Fromage\n", false},
+	}
+	for _, tc := range tests {
+		if got := isEscapedFromLine([]byte(tc.line)); got != tc.want {
+			t.Errorf("isEscapedFromLine(%q) = %v, want %v", tc.line, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Command ppar-audit checks circuit input files without the original email.
+//
+// Usage:
+//
+//	ppar-audit [options] <signature-input.json> <combined-input.json> [claims.json]
+//
+// It rebuilds the signed header and body from the inputs, computes their
+// hashes again, reassembles the RSA values from their limbs and verifies the
+// signature. It reports the email the inputs come from and the result of each
+// check, and exits with status 1 if the inputs aren't consistent.
+//
+// With -keys, the key of the inputs is also compared to the published key
+// record: "dns" or "dir:PATH", see ppar-server. Otherwise, the key check is
+// reported as not checked: the inputs may be consistent, but nothing ties
+// them to the key published by the domain.
+//
+// The claims file written along with the circuit inputs, e.g. the body
+// reveals, is checked against the rebuilt header and body. Without it, the
+// checks of the claims are reported as not checked too.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	dkim "email-parser-go"
+)
+
+// A JSON report. Complete is false if the inputs are consistent but a check
+// was skipped.
+type report struct {
+	OK       bool              `json:"ok"`
+	Complete bool              `json:"complete"`
+	Error    string            `json:"error,omitempty"`
+	Domain   string            `json:"d,omitempty"`
+	Selector string            `json:"s,omitempty"`
+	Time     int64             `json:"t,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+	Checks   []reportCheck     `json:"checks,omitempty"`
+}
+
+type reportCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func main() {
+	var (
+		keys       = flag.String("keys", "", "compare the key to the key record from this provider (dns or dir:PATH)")
+		jsonOutput = flag.Bool("json", false, "write the report as JSON")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: ppar-audit [options] <signature-input.json> <combined-input.json> [claims.json]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 && flag.NArg() != 3 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	options := new(dkim.AuditOptions)
+	kind, arg, _ := strings.Cut(*keys, ":")
+	switch kind {
+	case "":
+	case "dns":
+		options.LookupTXT = net.LookupTXT
+	case "dir":
+		if arg == "" {
+			log.Fatalf("missing directory in key provider %q", *keys)
+		}
+		options.LookupTXT = dkim.KeyDirLookup(arg)
+	default:
+		log.Fatalf("unknown key provider %q", *keys)
+	}
+
+	signature := readInput(flag.Arg(0), true)
+	combined := readInput(flag.Arg(1), false)
+	var claims []dkim.Signal
+	if flag.NArg() == 3 {
+		claims = readInput(flag.Arg(2), false)
+	}
+	audit := dkim.AuditSignals(signature, combined, claims, options)
+
+	var err error
+	if *jsonOutput {
+		err = writeJSON(os.Stdout, audit)
+	} else {
+		err = writeText(os.Stdout, audit)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !audit.OK() {
+		os.Exit(1)
+	}
+}
+
+func readInput(path string, public bool) []dkim.Signal {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	signals, err := dkim.ReadCircuitInput(f, public)
+	if err != nil {
+		log.Fatalf("%v: %v", path, err)
+	}
+	return signals
+}
+
+func newReport(audit *dkim.WitnessAudit) *report {
+	r := &report{OK: audit.OK(), Complete: audit.OK() && audit.Complete()}
+	if audit.Err != nil {
+		r.Error = audit.Err.Error()
+		return r
+	}
+	w := audit.Witness
+	r.Domain, r.Selector = w.Domain, w.Selector
+	if !w.Time.IsZero() {
+		r.Time = w.Time.Unix()
+	}
+	r.Fields = audit.Fields
+	for _, c := range audit.Checks {
+		rc := reportCheck{Name: c.Name, OK: c.Err == nil && !c.Skipped, Skipped: c.Skipped}
+		if c.Err != nil {
+			rc.Error = c.Err.Error()
+		}
+		r.Checks = append(r.Checks, rc)
+	}
+	return r
+}
+
+func writeJSON(w io.Writer, audit *dkim.WitnessAudit) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(newReport(audit))
+}
+
+func writeText(w io.Writer, audit *dkim.WitnessAudit) error {
+	r := newReport(audit)
+	if r.Error != "" {
+		_, err := fmt.Fprintf(w, "FAIL: inputs can't be decoded: %v\n", r.Error)
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "domain:     %v\n", r.Domain)
+	fmt.Fprintf(&b, "selector:   %v\n", r.Selector)
+	if !audit.Witness.Time.IsZero() {
+		fmt.Fprintf(&b, "signed at:  %v\n", audit.Witness.Time.UTC())
+	}
+	for _, k := range []string{"from", "to", "subject", "date", "message-id"} {
+		if v, ok := r.Fields[k]; ok {
+			fmt.Fprintf(&b, "%-11v %v\n", k+":", v)
+		}
+	}
+	fmt.Fprintf(&b, "header:     %v bytes\n", len(audit.Witness.Header))
+	fmt.Fprintf(&b, "body:       %v bytes\n", len(audit.Witness.Body))
+	for _, reveal := range audit.Witness.BodyReveals {
+		fmt.Fprintf(&b, "reveal:     %v %q\n", reveal.Name, reveal.Value)
+	}
+	b.WriteString("\n")
+	for _, c := range r.Checks {
+		switch {
+		case c.Skipped:
+			fmt.Fprintf(&b, "skip  %v: not checked\n", c.Name)
+		case c.OK:
+			fmt.Fprintf(&b, "ok    %v\n", c.Name)
+		default:
+			fmt.Fprintf(&b, "FAIL  %v: %v\n", c.Name, c.Error)
+		}
+	}
+	switch {
+	case !r.OK:
+		b.WriteString("\ninputs are NOT consistent\n")
+	case !r.Complete:
+		var skipped []string
+		for _, c := range r.Checks {
+			if c.Skipped {
+				skipped = append(skipped, c.Name)
+			}
+		}
+		fmt.Fprintf(&b, "\ninputs are consistent, but not every check was performed: %v (see -keys and the claims file)\n", strings.Join(skipped, ", "))
+	default:
+		b.WriteString("\ninputs are consistent\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	dkim "email-parser-go"
+)
+
+const testMessage = "From: Alice <alice@example.org>\r\n" +
+	"To: Guardian <guardian@example.com>\r\n" +
+	"Subject: Account recovery\r\n" +
+	"\r\n" +
+	"Approve recovery code: 482911\r\n"
+
+// testSignals signs testMessage and returns the signals of its witness, with
+// the recovery code revealed, and a lookup function returning its key record.
+func testSignals(t *testing.T) (signature, combined, claims []dkim.Signal, lookupTXT func(string) ([]string, error)) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+	record, err := dkim.FormatKeyRecord(key.Public())
+	if err != nil {
+		t.Fatalf("FormatKeyRecord() = %v", err)
+	}
+	lookupTXT = func(domain string) ([]string, error) {
+		return []string{record}, nil
+	}
+
+	var b bytes.Buffer
+	options := &dkim.SignOptions{Domain: "example.org", Selector: "test", Signer: key}
+	if err := dkim.Sign(&b, strings.NewReader(testMessage), options); err != nil {
+		t.Fatalf("Sign() = %v", err)
+	}
+	w, err := dkim.BuildWitness(&b, &dkim.WitnessOptions{
+		LookupTXT:   lookupTXT,
+		BodyReveals: []*dkim.RevealSpec{{Name: "code", Anchor: "recovery code: "}},
+	})
+	if err != nil {
+		t.Fatalf("BuildWitness() = %v", err)
+	}
+	if signature, err = w.SignatureSignals(); err != nil {
+		t.Fatalf("Witness.SignatureSignals() = %v", err)
+	}
+	if combined, err = w.CombinedSignals(); err != nil {
+		t.Fatalf("Witness.CombinedSignals() = %v", err)
+	}
+	if claims, err = w.ClaimSignals(); err != nil {
+		t.Fatalf("Witness.ClaimSignals() = %v", err)
+	}
+	return signature, combined, claims, lookupTXT
+}
+
+func TestWriteText(t *testing.T) {
+	signature, combined, claims, lookupTXT := testSignals(t)
+
+	var b bytes.Buffer
+	if err := writeText(&b, dkim.AuditSignals(signature, combined, claims, nil)); err != nil {
+		t.Fatalf("writeText() = %v", err)
+	}
+	if !strings.Contains(b.String(), "skip  key: not checked\n") {
+		t.Errorf("report doesn't show the key as not checked:\n%v", b.String())
+	}
+	if !strings.HasSuffix(b.String(), "\ninputs are consistent, but not every check was performed: key (see -keys and the claims file)\n") {
+		t.Errorf("report without a key provider has an unqualified verdict:\n%v", b.String())
+	}
+	if !strings.Contains(b.String(), "reveal:     code \"482911\"\n") {
+		t.Errorf("report doesn't show the reveal:\n%v", b.String())
+	}
+
+	b.Reset()
+	if err := writeText(&b, dkim.AuditSignals(signature, combined, nil, nil)); err != nil {
+		t.Fatalf("writeText() = %v", err)
+	}
+	if !strings.HasSuffix(b.String(), "\ninputs are consistent, but not every check was performed: signature-time, reveals, key (see -keys and the claims file)\n") {
+		t.Errorf("report without claims:\n%v", b.String())
+	}
+
+	b.Reset()
+	if err := writeText(&b, dkim.AuditSignals(signature, combined, claims, &dkim.AuditOptions{LookupTXT: lookupTXT})); err != nil {
+		t.Fatalf("writeText() = %v", err)
+	}
+	if !strings.Contains(b.String(), "ok    key\n") || !strings.HasSuffix(b.String(), "\n\ninputs are consistent\n") {
+		t.Errorf("report with a key provider:\n%v", b.String())
+	}
+	if !strings.Contains(b.String(), "from:       Alice <alice@example.org>\n") {
+		t.Errorf("report doesn't show the From field:\n%v", b.String())
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	signature, combined, claims, lookupTXT := testSignals(t)
+
+	tests := []struct {
+		name     string
+		options  *dkim.AuditOptions
+		complete bool
+	}{
+		{"no-keys", nil, false},
+		{"keys", &dkim.AuditOptions{LookupTXT: lookupTXT}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := writeJSON(&b, dkim.AuditSignals(signature, combined, claims, tc.options)); err != nil {
+				t.Fatalf("writeJSON() = %v", err)
+			}
+			var r report
+			if err := json.Unmarshal(b.Bytes(), &r); err != nil {
+				t.Fatalf("decoding report: %v", err)
+			}
+			if !r.OK || r.Complete != tc.complete {
+				t.Errorf("report ok = %v, complete = %v, want true, %v", r.OK, r.Complete, tc.complete)
+			}
+			for _, c := range r.Checks {
+				if c.Name == "key" && (c.Skipped == tc.complete || c.OK != tc.complete) {
+					t.Errorf("key check = %+v", c)
+				}
+			}
+			if r.Domain != "example.org" || r.Selector != "test" {
+				t.Errorf("report d = %q, s = %q", r.Domain, r.Selector)
+			}
+		})
+	}
+}
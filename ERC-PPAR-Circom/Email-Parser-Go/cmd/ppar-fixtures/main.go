@@ -0,0 +1,70 @@
+// Command ppar-fixtures generates synthetic signed emails and the matching
+// DKIM key records, so that the parser and the circuits can be tested without
+// real emails.
+//
+// For each fixture, it writes NAME.eml and a selector._domainkey.domain file
+// holding the TXT record, which can be used as an offline key provider.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	dkim "email-parser-go"
+)
+
+func main() {
+	var (
+		dir       = flag.String("dir", ".", "output directory")
+		count     = flag.Int("n", 1, "number of fixtures to generate")
+		domain    = flag.String("d", "", "signing domain (default gmail.com)")
+		selector  = flag.String("s", "", "selector (default 20230601)")
+		keyAlgo   = flag.String("k", "rsa", "key algorithm (rsa or ed25519)")
+		rsaBits   = flag.Int("b", 2048, "RSA key size in bits")
+		from      = flag.String("from", "", "sender address, may be an internationalized one")
+		fromName  = flag.String("from-name", "", "sender display name, may contain UTF-8 (default Alice)")
+		to        = flag.String("to", "", "recipient address")
+		subject   = flag.String("subject", "", "subject")
+		multipart = flag.Bool("multipart", true, "generate multipart/alternative messages")
+	)
+	flag.Parse()
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	for i := 0; i < *count; i++ {
+		// Each fixture gets its own key, so use distinct selectors when
+		// generating several of them.
+		sel := *selector
+		if *count > 1 {
+			if sel == "" {
+				sel = "20230601"
+			}
+			sel = fmt.Sprintf("%v-%v", sel, i)
+		}
+
+		f, err := dkim.GenerateFixture(&dkim.FixtureOptions{
+			Domain:       *domain,
+			Selector:     sel,
+			KeyAlgorithm: *keyAlgo,
+			RSABits:      *rsaBits,
+			From:         *from,
+			FromName:     *fromName,
+			To:           *to,
+			Subject:      *subject,
+			Multipart:    *multipart,
+		})
+		if err != nil {
+			log.Fatalf("failed to generate fixture: %v", err)
+		}
+
+		name := fmt.Sprintf("fixture-%v", i)
+		if err := f.WriteFiles(*dir, name); err != nil {
+			log.Fatalf("failed to write fixture: %v", err)
+		}
+		fmt.Printf("%v.eml %v\n", name, dkim.KeyRecordName(f.Domain, f.Selector))
+	}
+}
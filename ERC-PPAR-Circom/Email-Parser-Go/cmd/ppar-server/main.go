@@ -0,0 +1,81 @@
+// Command ppar-server is an HTTP service generating the circuit inputs of
+// signed emails, so that clients don't need to run the parser locally.
+//
+// It exposes two endpoints, both taking a raw RFC 5322 message as request
+// body:
+//
+//	POST /witness  returns the signature and combined circuit inputs, and the
+//	               claims checked outside of the circuits
+//	POST /verify   returns the DKIM verification results
+//
+// Message contents are never logged. Only the method, path, status, size and
+// duration of each request are.
+//
+// Keys are retrieved with the provider selected with -keys:
+//
+//	dns          the system resolver (default)
+//	dnssec:ADDR  the recursive resolver at ADDR, with DNSSEC validation
+//	dir:PATH     the key record files in PATH, as written by ppar-fixtures
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	dkim "email-parser-go"
+)
+
+func main() {
+	var (
+		addr     = flag.String("addr", ":8080", "listening address")
+		maxSize  = flag.Int64("max-size", 10<<20, "maximum message size in bytes")
+		keys     = flag.String("keys", "dns", "key provider (dns, dnssec:ADDR or dir:PATH)")
+		cacheTTL = flag.Duration("cache-ttl", time.Hour, "key cache TTL, 0 to disable the cache")
+	)
+	flag.Parse()
+
+	s := &server{maxSize: *maxSize}
+	if err := s.setKeyProvider(*keys); err != nil {
+		log.Fatal(err)
+	}
+	if *cacheTTL > 0 && s.dnssec == nil {
+		s.keyCache = dkim.NewKeyCache(&dkim.KeyCacheOptions{TTL: *cacheTTL})
+	}
+
+	httpServer := &http.Server{
+		Addr:              *addr,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       time.Minute,
+		WriteTimeout:      time.Minute,
+	}
+	log.Printf("listening on %v", *addr)
+	log.Fatal(httpServer.ListenAndServe())
+}
+
+// setKeyProvider configures the key provider from its command-line
+// specification.
+func (s *server) setKeyProvider(spec string) error {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "dns":
+		// The default, net.LookupTXT
+	case "dnssec":
+		if arg == "" {
+			return fmt.Errorf("missing resolver address in key provider %q", spec)
+		}
+		s.dnssec = &dkim.DNSSECResolver{Addr: arg}
+	case "dir":
+		if arg == "" {
+			return fmt.Errorf("missing directory in key provider %q", spec)
+		}
+		s.lookupTXT = dkim.KeyDirLookup(arg)
+	default:
+		return fmt.Errorf("unknown key provider %q", spec)
+	}
+	return nil
+}
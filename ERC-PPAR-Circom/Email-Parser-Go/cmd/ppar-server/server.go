@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	dkim "email-parser-go"
+)
+
+type server struct {
+	// maxSize is the maximum request body size in bytes.
+	maxSize int64
+
+	// The key provider. If dnssec is set, lookupTXT and keyCache are unused.
+	lookupTXT func(domain string) ([]string, error)
+	dnssec    *dkim.DNSSECResolver
+	keyCache  *dkim.KeyCache
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/witness", s.handleWitness)
+	mux.HandleFunc("/verify", s.handleVerify)
+	return logRequests(mux)
+}
+
+type witnessResponse struct {
+	SignatureInput map[string]interface{} `json:"signatureInput"`
+	CombinedInput  map[string]interface{} `json:"combinedInput"`
+	Claims         map[string]interface{} `json:"claims"`
+	KeyProof       *dkim.DNSSECProof      `json:"keyProof,omitempty"`
+}
+
+func (s *server) handleWitness(w http.ResponseWriter, r *http.Request) {
+	msg, ok := s.readMessage(w, r)
+	if !ok {
+		return
+	}
+
+	witness, err := dkim.BuildWitness(bytes.NewReader(msg), &dkim.WitnessOptions{
+		LookupTXT:   s.lookupTXT,
+		KeyCache:    s.keyCache,
+		DNSSEC:      s.dnssec,
+		MaxBodySize: s.maxSize,
+	})
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &witnessResponse{
+		SignatureInput: witness.SignatureInput(),
+		CombinedInput:  witness.CombinedInput(),
+		Claims:         witness.ClaimsInput(),
+		KeyProof:       witness.KeyProof,
+	})
+}
+
+// verificationResponse is the JSON representation of a dkim.Verification.
+type verificationResponse struct {
+	Result       dkim.AuthResult `json:"result"`
+	Error        string          `json:"error,omitempty"`
+	Domain       string          `json:"domain,omitempty"`
+	Identifier   string          `json:"identifier,omitempty"`
+	Selector     string          `json:"selector,omitempty"`
+	Algorithm    string          `json:"algorithm,omitempty"`
+	HeaderKeys   []string        `json:"headerKeys,omitempty"`
+	Time         *time.Time      `json:"time,omitempty"`
+	Expiration   *time.Time      `json:"expiration,omitempty"`
+	KeyAlgorithm string          `json:"keyAlgorithm,omitempty"`
+	KeySize      int             `json:"keySize,omitempty"`
+	Testing      bool            `json:"testing,omitempty"`
+	Partial      bool            `json:"partial,omitempty"`
+}
+
+func (s *server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	msg, ok := s.readMessage(w, r)
+	if !ok {
+		return
+	}
+
+	options := &dkim.VerifyOptions{
+		LookupTXT:   s.lookupTXT,
+		KeyCache:    s.keyCache,
+		MaxBodySize: s.maxSize,
+	}
+	if s.dnssec != nil {
+		options.LookupTXT = s.dnssec.LookupTXT
+		options.KeyCache = nil
+	}
+	verifs, err := dkim.VerifyWithOptions(bytes.NewReader(msg), options)
+	if err != nil && err != dkim.ErrTooManySignatures {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	resp := make([]*verificationResponse, len(verifs))
+	for i, v := range verifs {
+		vr := &verificationResponse{
+			Result:       dkim.VerificationResult(v),
+			Domain:       v.Domain,
+			Identifier:   v.Identifier,
+			Selector:     v.Selector,
+			Algorithm:    v.Algorithm,
+			HeaderKeys:   v.HeaderKeys,
+			KeyAlgorithm: v.KeyAlgorithm,
+			KeySize:      v.KeySize,
+			Testing:      v.Testing,
+			Partial:      v.Partial,
+		}
+		if v.Err != nil {
+			vr.Error = v.Err.Error()
+		}
+		if !v.Time.IsZero() {
+			vr.Time = &v.Time
+		}
+		if !v.Expiration.IsZero() {
+			vr.Expiration = &v.Expiration
+		}
+		resp[i] = vr
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// readMessage reads the message from the request body. If it fails, an
+// error response is written and false is returned.
+func (s *server) readMessage(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return nil, false
+	}
+
+	msg, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxSize))
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return nil, false
+	}
+	if len(msg) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("empty message"))
+		return nil, false
+	}
+	return msg, true
+}
+
+// errorStatus returns the HTTP status code for an error.
+func errorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr), errors.Is(err, dkim.ErrBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case dkim.IsTempFail(err):
+		return http.StatusServiceUnavailable
+	default:
+		// The message is malformed or its signature is invalid
+		return http.StatusUnprocessableEntity
+	}
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &errorResponse{err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
+
+// statusRecorder records the status of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs the requests, without their content: messages contain
+// personal data.
+func logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		log.Printf("%v %v %v %v bytes %v", r.Method, r.URL.Path, rec.status, r.ContentLength, time.Since(start).Round(time.Millisecond))
+	})
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	dkim "email-parser-go"
+)
+
+const testMessage = "From: Alice <alice@example.org>\r\n" +
+	"To: Guardian <guardian@example.com>\r\n" +
+	"Subject: Account recovery\r\n" +
+	"\r\n" +
+	"Approve recovery code: 482911\r\n"
+
+// testServer signs testMessage and returns it along with a test server
+// serving the key.
+func testServer(t *testing.T, maxSize int64) (*httptest.Server, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+	record, err := dkim.FormatKeyRecord(key.Public())
+	if err != nil {
+		t.Fatalf("FormatKeyRecord() = %v", err)
+	}
+
+	var b bytes.Buffer
+	options := &dkim.SignOptions{Domain: "example.org", Selector: "test", Signer: key}
+	if err := dkim.Sign(&b, strings.NewReader(testMessage), options); err != nil {
+		t.Fatalf("Sign() = %v", err)
+	}
+
+	s := &server{
+		maxSize: maxSize,
+		lookupTXT: func(domain string) ([]string, error) {
+			if domain != "test._domainkey.example.org" {
+				return nil, errors.New("no key record for " + domain)
+			}
+			return []string{record}, nil
+		},
+		keyCache: dkim.NewKeyCache(nil),
+	}
+	ts := httptest.NewServer(s.handler())
+	t.Cleanup(ts.Close)
+	return ts, b.Bytes()
+}
+
+// captureLog redirects the log output to a buffer until the test ends.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func post(t *testing.T, url string, body []byte, v interface{}) int {
+	t.Helper()
+	resp, err := http.Post(url, "message/rfc822", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST %v = %v", url, err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("POST %v: Content-Type = %q, want application/json", url, ct)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("POST %v: decoding response: %v", url, err)
+	}
+	return resp.StatusCode
+}
+
+func TestWitness(t *testing.T) {
+	logs := captureLog(t)
+	ts, msg := testServer(t, 1<<20)
+
+	var resp witnessResponse
+	if status := post(t, ts.URL+"/witness", msg, &resp); status != http.StatusOK {
+		t.Fatalf("POST /witness status = %v, want %v", status, http.StatusOK)
+	}
+	for _, name := range []string{"hashed", "sign", "exp", "modulus"} {
+		if _, ok := resp.SignatureInput[name]; !ok {
+			t.Errorf("signature input has no %q signal", name)
+		}
+	}
+	for _, name := range []string{"header", "body", "gmailHash"} {
+		if _, ok := resp.CombinedInput[name]; !ok {
+			t.Errorf("combined input has no %q signal", name)
+		}
+	}
+	if _, ok := resp.Claims["signatureTime"]; !ok {
+		t.Errorf("claims have no signatureTime")
+	}
+	if resp.KeyProof != nil {
+		t.Errorf("response has a key proof without DNSSEC")
+	}
+
+	if strings.Contains(logs.String(), "482911") || strings.Contains(logs.String(), "alice") {
+		t.Errorf("message content was logged: %q", logs.String())
+	}
+	if !strings.Contains(logs.String(), "POST /witness 200") {
+		t.Errorf("request wasn't logged: %q", logs.String())
+	}
+}
+
+func TestVerify(t *testing.T) {
+	captureLog(t)
+	ts, msg := testServer(t, 1<<20)
+
+	var resp []verificationResponse
+	if status := post(t, ts.URL+"/verify", msg, &resp); status != http.StatusOK {
+		t.Fatalf("POST /verify status = %v, want %v", status, http.StatusOK)
+	}
+	if len(resp) != 1 {
+		t.Fatalf("POST /verify returned %v results, want 1", len(resp))
+	}
+	if v := resp[0]; v.Result != dkim.AuthResultPass || v.Domain != "example.org" || v.Selector != "test" || v.KeySize != 2048 {
+		t.Errorf("POST /verify = %+v, want a pass for example.org", v)
+	}
+
+	tampered := bytes.Replace(msg, []byte("482911"), []byte("000000"), 1)
+	if status := post(t, ts.URL+"/verify", tampered, &resp); status != http.StatusOK {
+		t.Fatalf("POST /verify status = %v, want %v", status, http.StatusOK)
+	}
+	if len(resp) != 1 || resp[0].Result != dkim.AuthResultFail || resp[0].Error == "" {
+		t.Errorf("POST /verify for a tampered message = %+v, want a failure", resp)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	captureLog(t)
+	ts, msg := testServer(t, 1000)
+	unsigned := []byte(testMessage)
+	large := append(append([]byte(nil), msg...), bytes.Repeat([]byte("a"), 1000)...)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   []byte
+		status int
+	}{
+		{"get", http.MethodGet, "/witness", nil, http.StatusMethodNotAllowed},
+		{"empty", http.MethodPost, "/witness", nil, http.StatusBadRequest},
+		{"too-large", http.MethodPost, "/witness", large, http.StatusRequestEntityTooLarge},
+		{"too-large-verify", http.MethodPost, "/verify", large, http.StatusRequestEntityTooLarge},
+		{"unsigned", http.MethodPost, "/witness", unsigned, http.StatusUnprocessableEntity},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, ts.URL+tc.path, bytes.NewReader(tc.body))
+			if err != nil {
+				t.Fatalf("NewRequest() = %v", err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("%v %v = %v", tc.method, tc.path, err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Errorf("%v %v status = %v, want %v", tc.method, tc.path, resp.StatusCode, tc.status)
+			}
+			var errResp errorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil || errResp.Error == "" {
+				t.Errorf("%v %v: response isn't a JSON error: %v", tc.method, tc.path, err)
+			}
+		})
+	}
+}
+
+func TestSetKeyProvider(t *testing.T) {
+	tests := []struct {
+		spec string
+		ok   bool
+	}{
+		{"dns", true},
+		{"dnssec:127.0.0.1:53", true},
+		{"dir:keys", true},
+		{"dnssec", false},
+		{"dir:", false},
+		{"ldap:example.org", false},
+	}
+	for _, tc := range tests {
+		s := new(server)
+		if err := s.setKeyProvider(tc.spec); (err == nil) != tc.ok {
+			t.Errorf("setKeyProvider(%q) = %v, want success = %v", tc.spec, err, tc.ok)
+		}
+	}
+}
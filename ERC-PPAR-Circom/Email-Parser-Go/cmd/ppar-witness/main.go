@@ -0,0 +1,244 @@
+// Command ppar-witness extracts the circuit inputs of a signed email and
+// writes them in the format expected by a proving stack.
+//
+// Usage:
+//
+//	ppar-witness [options] <message.eml>
+//
+// The output format is selected with -format:
+//
+//	json   snarkjs inputs: signature-input.json and combined-input.json
+//	gnark  gnark BN254 witnesses: signature.gnark and combined.gnark, along
+//	       with the signal layouts needed to decode them,
+//	       signature.layout.json and combined.layout.json
+//	wtns   circom witnesses: signature.wtns and combined.wtns, computed by
+//	       the witness calculators given with -signature-wasm and
+//	       -combined-wasm
+//	cbor   the whole witness in a compact form: witness.cbor
+//
+// Except with cbor, the claims checked outside of the circuits, such as the
+// signature time and the body reveals, are written to claims.json, see
+// ppar-audit.
+//
+// A manifest.json file is written along with the outputs. It records the
+// parser version, the signature and key used, the limb parameters and the
+// SHA-256 of the message and of every output file, and for -format wtns, the
+// paths and SHA-256 of the WebAssembly modules. The outputs only depend
+// on the message and the key: running the command again on the same message
+// with the same key source gives identical files. With -check, the files of
+// the output directory and the modules are checked against its manifest
+// instead.
+//
+// Keys are retrieved with the provider selected with -keys: "dns" (default),
+// "dnssec:ADDR" or "dir:PATH", see ppar-server.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	dkim "email-parser-go"
+)
+
+func main() {
+	var (
+		format        = flag.String("format", "json", "output format (json, gnark, wtns or cbor)")
+		dir           = flag.String("o", ".", "output directory")
+		keys          = flag.String("keys", "dns", "key provider (dns, dnssec:ADDR or dir:PATH)")
+		signatureWASM = flag.String("signature-wasm", "", "rsa_verify circuit WebAssembly module, for -format wtns")
+		combinedWASM  = flag.String("combined-wasm", "", "combined circuit WebAssembly module, for -format wtns")
+		node          = flag.String("node", "node", "Node.js executable, for -format wtns")
+		sigIndex      = flag.Int("signature", 0, "index of the signature to use, in header order")
+		check         = flag.Bool("check", false, "check the output directory against its manifest")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: ppar-witness [options] <message.eml>\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *check {
+		checkManifest(*dir)
+		return
+	}
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	options, err := witnessOptions(*keys)
+	if err != nil {
+		log.Fatal(err)
+	}
+	options.SignatureIndex = *sigIndex
+
+	msg, err := os.ReadFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	w, err := dkim.BuildWitness(bytes.NewReader(msg), options)
+	if err != nil {
+		log.Fatalf("failed to build witness: %v", err)
+	}
+	manifest, err := dkim.NewManifest(msg, w, *keys)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	out := &output{dir: *dir, manifest: manifest}
+
+	wasm := map[string]string{"signature": *signatureWASM, "combined": *combinedWASM}
+	out.writeWitness(w, *format, wasm, *node)
+
+	b, err := manifest.MarshalIndent()
+	if err != nil {
+		log.Fatal(err)
+	}
+	out.write("manifest.json", b)
+}
+
+// checkManifest checks the files of dir against its manifest.
+func checkManifest(dir string) {
+	f, err := os.Open(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	manifest, err := dkim.ReadManifest(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := manifest.Check(dir); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%v files and %v modules match the manifest\n", len(manifest.Files), len(manifest.Modules))
+}
+
+// witnessOptions returns the witness options using the key provider
+// specification.
+func witnessOptions(spec string) (*dkim.WitnessOptions, error) {
+	options := new(dkim.WitnessOptions)
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "dns":
+		// The default, net.LookupTXT
+	case "dnssec":
+		if arg == "" {
+			return nil, fmt.Errorf("missing resolver address in key provider %q", spec)
+		}
+		options.DNSSEC = &dkim.DNSSECResolver{Addr: arg}
+	case "dir":
+		if arg == "" {
+			return nil, fmt.Errorf("missing directory in key provider %q", spec)
+		}
+		options.LookupTXT = dkim.KeyDirLookup(arg)
+	default:
+		return nil, fmt.Errorf("unknown key provider %q", spec)
+	}
+	return options, nil
+}
+
+type circuit struct {
+	name    string
+	signals []dkim.Signal
+}
+
+// circuits returns the inputs of the rsa_verify and combined circuits.
+func circuits(w *dkim.Witness) []circuit {
+	signature, err := w.SignatureSignals()
+	if err != nil {
+		log.Fatal(err)
+	}
+	combined, err := w.CombinedSignals()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return []circuit{{"signature", signature}, {"combined", combined}}
+}
+
+// output writes the output files, and records them in the manifest.
+type output struct {
+	dir      string
+	manifest *dkim.Manifest
+}
+
+// writeWitness writes the outputs of w in format. The witness calculators of
+// the wtns format are given by circuit name in wasm.
+func (out *output) writeWitness(w *dkim.Witness, format string, wasm map[string]string, node string) {
+	switch format {
+	case "json", "gnark", "wtns":
+		out.writeJSON("claims.json", w.ClaimsInput())
+	}
+
+	switch format {
+	case "json":
+		out.writeJSON("signature-input.json", w.SignatureInput())
+		out.writeJSON("combined-input.json", w.CombinedInput())
+	case "gnark":
+		for _, c := range circuits(w) {
+			b, err := dkim.MarshalGnarkWitness(c.signals)
+			if err != nil {
+				log.Fatal(err)
+			}
+			out.write(c.name+".gnark", b)
+			out.writeJSON(c.name+".layout.json", dkim.Layout(c.signals))
+		}
+	case "wtns":
+		if wasm["signature"] == "" && wasm["combined"] == "" {
+			log.Fatal("-format wtns needs -signature-wasm or -combined-wasm")
+		}
+		for _, c := range circuits(w) {
+			if wasm[c.name] == "" {
+				continue
+			}
+			if err := out.manifest.AddModule(wasm[c.name]); err != nil {
+				log.Fatal(err)
+			}
+			calc := &dkim.WASMWitnessCalculator{WASM: wasm[c.name], Node: node}
+			wtns, err := calc.Calculate(c.signals)
+			if err != nil {
+				log.Fatalf("failed to compute %v witness: %v", c.name, err)
+			}
+			var b bytes.Buffer
+			if err := dkim.WriteWTNS(&b, wtns); err != nil {
+				log.Fatal(err)
+			}
+			out.write(c.name+".wtns", b.Bytes())
+		}
+	case "cbor":
+		b, err := dkim.MarshalWitnessCBOR(w)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out.write("witness.cbor", b)
+	default:
+		log.Fatalf("unknown format %q", format)
+	}
+}
+
+func (out *output) write(name string, b []byte) {
+	path := filepath.Join(out.dir, name)
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		log.Fatal(err)
+	}
+	if name != "manifest.json" {
+		out.manifest.AddFile(name, b)
+	}
+	fmt.Println(path)
+}
+
+func (out *output) writeJSON(name string, v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	out.write(name, b)
+}
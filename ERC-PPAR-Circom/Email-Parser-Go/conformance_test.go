@@ -0,0 +1,206 @@
+package dkim
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// conformanceHeaderFields and conformanceBodies are the inputs every
+// registered canonicalization is tested with. They cover the cases the
+// built-in algorithms handle specially: whitespace runs, folding, lone CR and
+// LF, trailing empty lines, missing final line break and 8-bit data.
+var conformanceHeaderFields = []string{
+	"Subject: Hello\r\n",
+	"subject:  Hello  World \r\n",
+	"SUBJECT \t: Hello\r\n",
+	"Subject: folded\r\n\tvalue\r\n",
+	"To: alice@example.org,\r\n bob@example.org\r\n",
+	"X-Empty:\r\n",
+	"X-8bit: caf\xc3\xa9\r\n",
+}
+
+var conformanceBodies = []string{
+	"",
+	"\r\n",
+	"\r\n\r\n\r\n",
+	"Hello\r\n",
+	"Hello",
+	"Hello\r\n\r\n\r\n",
+	"a  b \t\r\n\t c\r\n",
+	"lone\nline feeds\n",
+	"lone\rcarriage return\r\n",
+	"trailing carriage return\r",
+	" \r\n \r\n",
+	"caf\xc3\xa9\r\n",
+	strings.Repeat("long line ", 200) + "\r\n",
+}
+
+// lowercaseCanonicalizer is registered by the tests to check that custom
+// canonicalizations are used by signers and verifiers. It's the relaxed
+// canonicalization with lowercase header field values.
+type lowercaseCanonicalizer struct {
+	relaxedCanonicalizer
+}
+
+func (c *lowercaseCanonicalizer) CanonicalizeHeader(s string) string {
+	return strings.ToLower(c.relaxedCanonicalizer.CanonicalizeHeader(s))
+}
+
+const canonicalizationLowercase Canonicalization = "x-lowercase"
+
+func init() {
+	RegisterCanonicalization(canonicalizationLowercase, new(lowercaseCanonicalizer))
+}
+
+// registeredCanonicalizations returns the names of the registered
+// canonicalizations, sorted.
+func registeredCanonicalizations() []Canonicalization {
+	canonicalizersMu.RLock()
+	defer canonicalizersMu.RUnlock()
+	var names []Canonicalization
+	for name := range canonicalizers {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
+
+// TestCanonicalizationConformance checks that the registered canonicalization
+// algorithms behave as expected by signers and verifiers.
+//
+// The header canonicalization must return fields ending with CRLF. Both
+// canonicalizations must be deterministic and idempotent, and the body
+// canonicalization must not depend on how the body is split into writes.
+// Finally, messages signed with the algorithm must verify.
+func TestCanonicalizationConformance(t *testing.T) {
+	for _, name := range registeredCanonicalizations() {
+		t.Run(string(name), func(t *testing.T) {
+			c, _ := lookupCanonicalizer(name)
+			t.Run("header", func(t *testing.T) {
+				for _, kv := range conformanceHeaderFields {
+					testCanonicalizeHeader(t, c, kv)
+				}
+			})
+			t.Run("body", func(t *testing.T) {
+				for _, body := range conformanceBodies {
+					testCanonicalizeBody(t, c, body)
+				}
+			})
+			t.Run("sign", func(t *testing.T) {
+				header := "From: Alice <alice@example.org>\r\n" + strings.Join(conformanceHeaderFields, "")
+				for _, body := range conformanceBodies {
+					testSignVerify(t, header+crlf+body, &SignOptions{
+						HeaderCanonicalization: name,
+						BodyCanonicalization:   name,
+					})
+				}
+			})
+		})
+	}
+}
+
+func testCanonicalizeHeader(t *testing.T, c Canonicalizer, kv string) {
+	t.Helper()
+	can := c.CanonicalizeHeader(kv)
+	if !strings.HasSuffix(can, crlf) {
+		t.Errorf("canonicalized header field %q doesn't end with CRLF", kv)
+	}
+	if again := c.CanonicalizeHeader(kv); again != can {
+		t.Errorf("header canonicalization of %q isn't deterministic", kv)
+	}
+	if again := c.CanonicalizeHeader(can); again != can {
+		t.Errorf("header canonicalization of %q isn't idempotent: %q then %q", kv, can, again)
+	}
+}
+
+func testCanonicalizeBody(t *testing.T, c Canonicalizer, body string) {
+	t.Helper()
+	can, err := canonicalizeChunks(c, body, len(body))
+	if err != nil {
+		t.Fatalf("body canonicalization of %q: %v", body, err)
+	}
+	for _, n := range []int{1, 2, 3, 7} {
+		chunked, err := canonicalizeChunks(c, body, n)
+		if err != nil {
+			t.Fatalf("body canonicalization of %q: %v", body, err)
+		}
+		if chunked != can {
+			t.Errorf("body canonicalization of %q in chunks of %v bytes gives %q instead of %q", body, n, chunked, can)
+		}
+	}
+	again, err := canonicalizeChunks(c, can, len(can))
+	if err != nil {
+		t.Fatalf("body canonicalization of %q: %v", can, err)
+	}
+	if again != can {
+		t.Errorf("body canonicalization of %q isn't idempotent: %q then %q", body, can, again)
+	}
+}
+
+// canonicalizeChunks canonicalizes body, written in chunks of n bytes.
+func canonicalizeChunks(c Canonicalizer, body string, n int) (string, error) {
+	var buf bytes.Buffer
+	wc := c.CanonicalizeBody(&buf)
+	for len(body) > 0 {
+		chunk := body
+		if n > 0 && len(chunk) > n {
+			chunk = chunk[:n]
+		}
+		written, err := io.WriteString(wc, chunk)
+		if err != nil {
+			return "", err
+		}
+		if written != len(chunk) {
+			return "", fmt.Errorf("short write: %v bytes out of %v", written, len(chunk))
+		}
+		body = body[len(chunk):]
+	}
+	if err := wc.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func TestCanonicalizationLowercase(t *testing.T) {
+	signed := testSign(t, testMessage, &SignOptions{
+		HeaderCanonicalization: canonicalizationLowercase,
+		BodyCanonicalization:   CanonicalizationRelaxed,
+	})
+	if !bytes.Contains(signed, []byte("c=x-lowercase/relaxed")) {
+		t.Fatalf("signature doesn't use the registered canonicalization:\n%s", signed)
+	}
+
+	// The custom canonicalization tolerates case changes in header values
+	lookup := testLookupTXT(t, testRSAKey.Public())
+	upper := bytes.Replace(signed, []byte("Subject: Account recovery"), []byte("Subject: ACCOUNT RECOVERY"), 1)
+	if verif := testVerify(t, upper, &VerifyOptions{LookupTXT: lookup}); verif.Err != nil {
+		t.Errorf("Verification.Err = %v", verif.Err)
+	}
+}
+
+func TestRegisterCanonicalization_invalid(t *testing.T) {
+	tests := []struct {
+		name Canonicalization
+		c    Canonicalizer
+	}{
+		{"x-nil", nil},
+		{"", new(relaxedCanonicalizer)},
+		{"no/slash", new(relaxedCanonicalizer)},
+		{"-leading", new(relaxedCanonicalizer)},
+		{CanonicalizationRelaxed, new(relaxedCanonicalizer)},
+	}
+	for _, tc := range tests {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RegisterCanonicalization(%q) didn't panic", tc.name)
+				}
+			}()
+			RegisterCanonicalization(tc.name, tc.c)
+		}()
+	}
+}
@@ -0,0 +1,111 @@
+package dkim
+
+import (
+	"errors"
+	"strings"
+)
+
+// A HeaderDiff is a header field whose received value differs from the copy
+// recorded in the "z" tag of a signature, see RFC 6376 section 3.5.
+type HeaderDiff struct {
+	// The header field name.
+	Name string
+	// The value at signing time, and the received value. Received is empty
+	// if the field is missing from the received message.
+	Original string
+	Received string
+}
+
+// formatCopiedHeaderFields formats the value of the "z" tag for the given
+// raw header fields. Each copy is put on its own line to keep the signature
+// header field lines short.
+func formatCopiedHeaderFields(fields []string) string {
+	copies := make([]string, len(fields))
+	for i, kv := range fields {
+		k, v, _ := strings.Cut(strings.TrimSuffix(kv, crlf), ":")
+		copies[i] = strings.TrimSpace(k) + ":" + encodeDKIMQuotedPrintable(v)
+	}
+	return strings.Join(copies, "|"+crlf+" ")
+}
+
+// parseCopiedHeaderFields parses the value of the "z" tag. It returns the
+// header field names and their decoded values.
+func parseCopiedHeaderFields(s string) ([][2]string, error) {
+	var fields [][2]string
+	for _, c := range strings.Split(stripWhitespace(s), "|") {
+		k, v, ok := strings.Cut(c, ":")
+		if !ok || k == "" {
+			return nil, errors.New("dkim: malformed copied header field")
+		}
+		v, err := decodeDKIMQuotedPrintable(v)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, [2]string{k, v})
+	}
+	return fields, nil
+}
+
+// diffCopiedHeaderFields compares the header fields copied in the "z" tag
+// with the received ones. Values are compared once canonicalized, so that
+// changes which don't affect the signature aren't reported.
+func diffCopiedHeaderFields(h header, z string, can Canonicalizer) ([]HeaderDiff, error) {
+	fields, err := parseCopiedHeaderFields(z)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []HeaderDiff
+	picker := newHeaderPicker(h)
+	for _, field := range fields {
+		k, original := field[0], field[1]
+
+		kv := picker.Pick(k)
+		if kv == "" {
+			diffs = append(diffs, HeaderDiff{Name: k, Original: original})
+			continue
+		}
+		_, received, _ := strings.Cut(strings.TrimSuffix(kv, crlf), ":")
+
+		if can.CanonicalizeHeader(k+":"+original) != can.CanonicalizeHeader(k+":"+received) {
+			diffs = append(diffs, HeaderDiff{Name: k, Original: original, Received: received})
+		}
+	}
+	return diffs, nil
+}
+
+// encodeDKIMQuotedPrintable encodes s as DKIM-Quoted-Printable, as defined in
+// RFC 6376 section 2.11. "|" is encoded as well, since it separates the
+// copied header fields.
+func encodeDKIMQuotedPrintable(s string) string {
+	const hexDigits = "0123456789ABCDEF"
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch > 0x20 && ch < 0x7f && ch != ';' && ch != '=' && ch != '|' {
+			sb.WriteByte(ch)
+			continue
+		}
+		sb.WriteByte('=')
+		sb.WriteByte(hexDigits[ch>>4])
+		sb.WriteByte(hexDigits[ch&0x0f])
+	}
+	return sb.String()
+}
+
+func decodeDKIMQuotedPrintable(s string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '=' {
+			sb.WriteByte(s[i])
+			continue
+		}
+		if i+2 >= len(s) || !isHexDigit(s[i+1]) || !isHexDigit(s[i+2]) {
+			return "", errors.New("dkim: malformed quoted-printable value")
+		}
+		sb.WriteByte(unhex(s[i+1])<<4 | unhex(s[i+2]))
+		i += 2
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,83 @@
+package dkim
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDKIMQuotedPrintable(t *testing.T) {
+	tests := []struct {
+		s       string
+		encoded string
+	}{
+		{"", ""},
+		{"Account recovery", "Account=20recovery"},
+		{"a=b; c|d", "a=3Db=3B=20c=7Cd"},
+		{" folded\r\n\tvalue", "=20folded=0D=0A=09value"},
+		{"caf\xc3\xa9", "caf=C3=A9"},
+	}
+	for _, tc := range tests {
+		if got := encodeDKIMQuotedPrintable(tc.s); got != tc.encoded {
+			t.Errorf("encodeDKIMQuotedPrintable(%q) = %q, want %q", tc.s, got, tc.encoded)
+		}
+		if got, err := decodeDKIMQuotedPrintable(tc.encoded); err != nil || got != tc.s {
+			t.Errorf("decodeDKIMQuotedPrintable(%q) = %q, %v, want %q", tc.encoded, got, err, tc.s)
+		}
+	}
+
+	for _, s := range []string{"=", "=4", "=XY", "abc=2"} {
+		if _, err := decodeDKIMQuotedPrintable(s); err == nil {
+			t.Errorf("decodeDKIMQuotedPrintable(%q) = nil, want an error", s)
+		}
+	}
+}
+
+func TestParseCopiedHeaderFields(t *testing.T) {
+	z := formatCopiedHeaderFields([]string{"From: Alice <alice@example.org>\r\n", "Subject:a|b\r\n"})
+	fields, err := parseCopiedHeaderFields(z)
+	if err != nil {
+		t.Fatalf("parseCopiedHeaderFields(%q) = %v", z, err)
+	}
+	want := [][2]string{{"From", " Alice <alice@example.org>"}, {"Subject", "a|b"}}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("parseCopiedHeaderFields(%q) = %q, want %q", z, fields, want)
+	}
+
+	for _, z := range []string{":value", "From", "From:=ZZ"} {
+		if _, err := parseCopiedHeaderFields(z); err == nil {
+			t.Errorf("parseCopiedHeaderFields(%q) = nil, want an error", z)
+		}
+	}
+}
+
+func TestVerify_diagnoseHeaders(t *testing.T) {
+	signed := testSign(t, testMessage, &SignOptions{
+		CopyHeaderFields:       true,
+		HeaderCanonicalization: CanonicalizationRelaxed,
+	})
+	if !bytes.Contains(signed, []byte(" z=")) {
+		t.Fatalf("signature has no z= tag:\n%s", signed)
+	}
+	lookup := testLookupTXT(t, testRSAKey.Public())
+
+	// Whitespace changes don't break relaxed signatures and aren't reported
+	respaced := bytes.Replace(signed, []byte("Subject: Account recovery"), []byte("Subject:  Account   recovery"), 1)
+	if verif := testVerify(t, respaced, &VerifyOptions{LookupTXT: lookup, DiagnoseHeaders: true}); verif.Err != nil {
+		t.Errorf("Verification.Err = %v", verif.Err)
+	}
+
+	modified := bytes.Replace(signed, []byte("Subject: Account recovery"), []byte("Subject: Account deletion"), 1)
+	verif := testVerify(t, modified, &VerifyOptions{LookupTXT: lookup, DiagnoseHeaders: true})
+	if verif.Err == nil {
+		t.Fatal("Verification.Err = nil with a modified subject")
+	}
+	want := []HeaderDiff{{Name: "Subject", Original: " Account recovery", Received: " Account deletion"}}
+	if !reflect.DeepEqual(verif.HeaderDiffs, want) {
+		t.Errorf("HeaderDiffs = %+v, want %+v", verif.HeaderDiffs, want)
+	}
+
+	if verif := testVerify(t, modified, &VerifyOptions{LookupTXT: lookup}); verif.HeaderDiffs != nil {
+		t.Errorf("HeaderDiffs = %+v without DiagnoseHeaders", verif.HeaderDiffs)
+	}
+}
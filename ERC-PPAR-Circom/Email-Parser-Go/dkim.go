@@ -8,8 +8,8 @@
 // not the same as the one computed from the raw header.
 //
 // How can I publish my public key? You have to add a TXT record to your DNS
-// zone. See [RFC 6376 appendix C]. You can use the dkim-keygen tool included
-// in go-msgauth to generate the key and the TXT record.
+// zone. See [RFC 6376 appendix C]. You can use the dkim-keygen command
+// (cmd/dkim-keygen) to generate the key and the TXT record.
 //
 // [RFC 6376 appendix C]: https://tools.ietf.org/html/rfc6376#appendix-C
 package dkim
@@ -0,0 +1,166 @@
+package dkim
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRSAKey is shared by all tests, since generating RSA keys is slow. The
+// circuits expect 2048-bit keys.
+var testRSAKey = func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+const (
+	testDomain   = "example.org"
+	testSelector = "test"
+)
+
+// testTime is the signature time of the messages signed with testSign.
+var testTime = time.Unix(1700000000, 0)
+
+const testMessage = "From: Alice <alice@example.org>\r\n" +
+	"To: Guardian <guardian@example.com>\r\n" +
+	"Subject: Account recovery\r\n" +
+	"Date: Tue, 14 Nov 2023 22:13:20 +0000\r\n" +
+	"Message-ID: <recovery@example.org>\r\n" +
+	"\r\n" +
+	"Hi,\r\n" +
+	"\r\n" +
+	"Approve recovery code: 482911\r\n" +
+	"\r\n" +
+	"Alice\r\n"
+
+// testLookupTXT returns a key provider returning the key record of pub for
+// any domain.
+func testLookupTXT(t testing.TB, pub crypto.PublicKey) func(domain string) ([]string, error) {
+	t.Helper()
+	record, err := FormatKeyRecord(pub)
+	if err != nil {
+		t.Fatalf("FormatKeyRecord() = %v", err)
+	}
+	return func(domain string) ([]string, error) {
+		return []string{record}, nil
+	}
+}
+
+// testSign signs msg. The domain, selector, signer and clock default to
+// testDomain, testSelector, testRSAKey and testTime.
+func testSign(t testing.TB, msg string, options *SignOptions) []byte {
+	t.Helper()
+	o := SignOptions{}
+	if options != nil {
+		o = *options
+	}
+	if o.Domain == "" {
+		o.Domain = testDomain
+	}
+	if o.Selector == "" {
+		o.Selector = testSelector
+	}
+	if o.Signer == nil {
+		o.Signer = testRSAKey
+	}
+	if o.Now == nil {
+		o.Now = func() time.Time { return testTime }
+	}
+	var b bytes.Buffer
+	if err := Sign(&b, strings.NewReader(msg), &o); err != nil {
+		t.Fatalf("Sign() = %v", err)
+	}
+	return b.Bytes()
+}
+
+// testVerify verifies msg, which must have a single signature.
+func testVerify(t testing.TB, msg []byte, options *VerifyOptions) *Verification {
+	t.Helper()
+	verifs, err := VerifyWithOptions(bytes.NewReader(msg), options)
+	if err != nil {
+		t.Fatalf("VerifyWithOptions() = %v", err)
+	}
+	if len(verifs) != 1 {
+		t.Fatalf("VerifyWithOptions() returned %v verifications, want 1", len(verifs))
+	}
+	return verifs[0]
+}
+
+// testWitness signs msg with testRSAKey and builds its witness.
+func testWitness(t testing.TB, msg string, sign *SignOptions, options *WitnessOptions) *Witness {
+	t.Helper()
+	signed := testSign(t, msg, sign)
+	o := WitnessOptions{}
+	if options != nil {
+		o = *options
+	}
+	if o.LookupTXT == nil {
+		o.LookupTXT = testLookupTXT(t, testRSAKey.Public())
+	}
+	w, err := BuildWitness(bytes.NewReader(signed), &o)
+	if err != nil {
+		t.Fatalf("BuildWitness() = %v", err)
+	}
+	return w
+}
+
+// testSignBodyLength signs the first l bytes of the relaxed canonicalized body
+// of msg with testRSAKey, with a body length tag, and appends extra to the
+// body once signed. Sign doesn't generate body length tags.
+func testSignBodyLength(t testing.TB, msg string, l int64, extra string) []byte {
+	t.Helper()
+	bufr := bufio.NewReader(strings.NewReader(msg))
+	h, err := readHeader(bufr)
+	if err != nil {
+		t.Fatalf("readHeader() = %v", err)
+	}
+	can, _ := lookupCanonicalizer(CanonicalizationRelaxed)
+
+	var body bytes.Buffer
+	if err := canonicalizeBody(&body, bufr, can); err != nil {
+		t.Fatalf("canonicalizeBody() = %v", err)
+	}
+	if int64(body.Len()) < l {
+		t.Fatalf("body has %v bytes, less than %v", body.Len(), l)
+	}
+	bh := sha256.Sum256(body.Bytes()[:l])
+
+	keys := []string{"from", "to", "subject"}
+	sigField := fmt.Sprintf("DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed; d=%v; s=%v; t=%v; l=%v; h=%v; bh=%v; b=",
+		testDomain, testSelector, testTime.Unix(), l, strings.Join(keys, ":"), base64.StdEncoding.EncodeToString(bh[:]))
+	hasher := sha256.New()
+	if err := hashHeader(hasher, h, keys, can, sigField+crlf); err != nil {
+		t.Fatalf("hashHeader() = %v", err)
+	}
+	sig, err := rsa.SignPKCS1v15(rand.Reader, testRSAKey, crypto.SHA256, hasher.Sum(nil))
+	if err != nil {
+		t.Fatalf("SignPKCS1v15() = %v", err)
+	}
+	return []byte(sigField + base64.StdEncoding.EncodeToString(sig) + crlf + msg + extra)
+}
+
+// testSignVerify signs msg and checks that the signature verifies.
+func testSignVerify(t testing.TB, msg string, options *SignOptions) *Verification {
+	t.Helper()
+	signed := testSign(t, msg, options)
+	signer := testRSAKey.Public()
+	if options != nil && options.Signer != nil {
+		signer = options.Signer.Public()
+	}
+	verif := testVerify(t, signed, &VerifyOptions{LookupTXT: testLookupTXT(t, signer)})
+	if verif.Err != nil {
+		t.Errorf("signature of %q didn't verify: %v", msg, verif.Err)
+	}
+	return verif
+}
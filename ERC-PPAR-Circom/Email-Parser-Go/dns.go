@@ -0,0 +1,101 @@
+package dkim
+
+import (
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNSResolver retrieves TXT records by querying a DNS resolver directly,
+// without any validation. Unlike net.LookupTXT, it keeps the individual
+// strings of each record, so that exactly what the resolver returned can be
+// reproduced.
+//
+// Its LookupTXTStrings method is suitable for VerifyOptions.LookupTXTStrings.
+type DNSResolver struct {
+	// Addr is the address of the resolver, e.g. "1.1.1.1:53". If empty, the
+	// first name server of /etc/resolv.conf is used.
+	Addr string
+	// Net is the transport, "udp" (default) or "tcp". Truncated UDP
+	// responses are retried over TCP.
+	Net string
+	// Timeout is the timeout of each query. Defaults to 5 seconds.
+	Timeout time.Duration
+}
+
+// LookupTXT returns the TXT records of name, the strings of each record being
+// concatenated like net.LookupTXT does.
+func (r *DNSResolver) LookupTXT(name string) ([]string, error) {
+	records, err := r.LookupTXTStrings(name)
+	return joinTXTRecords(records), err
+}
+
+// LookupTXTStrings returns the TXT records of name, with their individual
+// strings. CNAME records are followed by the resolver.
+func (r *DNSResolver) LookupTXTStrings(name string) ([][]string, error) {
+	addr := r.Addr
+	if addr == "" {
+		conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+		if err != nil {
+			return nil, err
+		}
+		if len(conf.Servers) == 0 {
+			return nil, &net.DNSError{Err: "no name server configured", Name: name}
+		}
+		addr = net.JoinHostPort(conf.Servers[0], conf.Port)
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), dns.TypeTXT)
+	// Key records of 2048-bit RSA keys don't fit in 512 bytes
+	m.SetEdns0(4096, false)
+	resp, err := exchange(m, addr, r.Net, r.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var records [][]string
+	for _, rr := range resp.Answer {
+		if txt, ok := rr.(*dns.TXT); ok {
+			records = append(records, txt.Txt)
+		}
+	}
+	if len(records) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: name, Server: addr, IsNotFound: true}
+	}
+	return records, nil
+}
+
+// exchange sends the query m to the resolver at addr. The transport netw
+// defaults to UDP, and truncated UDP responses are retried over TCP. Response
+// codes other than success are returned as a *net.DNSError, temporary unless
+// the name doesn't exist.
+func exchange(m *dns.Msg, addr, netw string, timeout time.Duration) (*dns.Msg, error) {
+	if netw == "" {
+		netw = "udp"
+	}
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+
+	c := &dns.Client{Net: netw, Timeout: timeout}
+	resp, _, err := c.Exchange(m, addr)
+	if err == nil && resp.Truncated && netw == "udp" {
+		c.Net = "tcp"
+		resp, _, err = c.Exchange(m, addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	name := m.Question[0].Name
+	switch resp.Rcode {
+	case dns.RcodeSuccess:
+		return resp, nil
+	case dns.RcodeNameError:
+		return nil, &net.DNSError{Err: "no such host", Name: name, Server: addr, IsNotFound: true}
+	default:
+		return nil, &net.DNSError{Err: "server replied " + dns.RcodeToString[resp.Rcode], Name: name, Server: addr, IsTemporary: true}
+	}
+}
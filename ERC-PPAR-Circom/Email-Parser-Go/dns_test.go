@@ -0,0 +1,98 @@
+package dkim
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// testServeDNS starts a UDP DNS server on the loopback interface, stopped
+// when the test ends, and returns its address.
+func testServeDNS(t *testing.T, h dns.Handler) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() = %v", err)
+	}
+	started := make(chan struct{})
+	srv := &dns.Server{PacketConn: pc, Handler: h, NotifyStartedFunc: func() { close(started) }}
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+// testTXTServer answers TXT queries with the records of its map, and fails
+// other queries with a server failure.
+type testTXTServer map[string][][]string
+
+func (s testTXTServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	q := req.Question[0]
+	records, ok := s[strings.ToLower(q.Name)]
+	switch {
+	case q.Qtype != dns.TypeTXT:
+		resp.Rcode = dns.RcodeServerFailure
+	case !ok:
+		resp.Rcode = dns.RcodeNameError
+	}
+	for _, txt := range records {
+		resp.Answer = append(resp.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300},
+			Txt: txt,
+		})
+	}
+	w.WriteMsg(resp)
+}
+
+func TestDNSResolver(t *testing.T) {
+	records := [][]string{
+		{"v=spf1 -all"},
+		{"v=DKIM1; k=rsa; ", "p=MIIB", "IjAN"},
+	}
+	r := &DNSResolver{Addr: testServeDNS(t, testTXTServer{
+		"test._domainkey.example.org.":  records,
+		"empty._domainkey.example.org.": nil,
+	})}
+
+	got, err := r.LookupTXTStrings("test._domainkey.example.org")
+	if err != nil {
+		t.Fatalf("LookupTXTStrings() = %v", err)
+	}
+	if !reflect.DeepEqual(got, records) {
+		t.Errorf("LookupTXTStrings() = %q, want %q", got, records)
+	}
+
+	txts, err := r.LookupTXT("test._domainkey.example.org")
+	if err != nil {
+		t.Fatalf("LookupTXT() = %v", err)
+	}
+	want := []string{"v=spf1 -all", "v=DKIM1; k=rsa; p=MIIBIjAN"}
+	if !reflect.DeepEqual(txts, want) {
+		t.Errorf("LookupTXT() = %q, want %q", txts, want)
+	}
+
+	for _, name := range []string{"missing._domainkey.example.org", "empty._domainkey.example.org"} {
+		_, err := r.LookupTXTStrings(name)
+		if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+			t.Errorf("LookupTXTStrings(%q) = %v, want a not found error", name, err)
+		}
+	}
+}
+
+func TestDNSResolver_serverFailure(t *testing.T) {
+	r := &DNSResolver{Addr: testServeDNS(t, dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetRcode(req, dns.RcodeServerFailure)
+		w.WriteMsg(resp)
+	}))}
+
+	_, err := r.LookupTXTStrings("test._domainkey.example.org")
+	if netErr, ok := err.(net.Error); !ok || !netErr.Temporary() {
+		t.Errorf("LookupTXTStrings() = %v, want a temporary error", err)
+	}
+}
@@ -0,0 +1,482 @@
+package dkim
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// RootTrustAnchors are the DS records of the root zone key signing keys
+// (KSK-2017 and KSK-2024), as published by IANA.
+var RootTrustAnchors = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// maxCNAMEChain is the maximum number of CNAME records followed.
+const maxCNAMEChain = 8
+
+// DNSSECResolver retrieves key records along with the DNSSEC chain of trust
+// proving them, and validates the chain itself: the recursive resolver only
+// relays the records and doesn't need to be trusted.
+//
+// Its LookupTXT method is suitable for VerifyOptions.LookupTXT.
+type DNSSECResolver struct {
+	// Addr is the address of the recursive resolver, e.g. "1.1.1.1:53".
+	Addr string
+	// Net is the transport, "udp" (default) or "tcp". Truncated UDP
+	// responses are retried over TCP.
+	Net string
+	// Timeout is the timeout of each query. Defaults to 5 seconds.
+	Timeout time.Duration
+	// TrustAnchors are the DS records of the root zone keys, in presentation
+	// format. If nil, RootTrustAnchors are used.
+	TrustAnchors []string
+	// Now returns the time used to check the validity of the signatures. If
+	// nil, the current time is used.
+	Now func() time.Time
+}
+
+// A DNSSECError is returned when records can't be proven by a DNSSEC chain
+// of trust.
+type DNSSECError struct {
+	Name   string
+	Reason string
+}
+
+func (err *DNSSECError) Error() string {
+	return fmt.Sprintf("DNSSEC validation failed for %v: %v", err.Name, err.Reason)
+}
+
+// DNSSECProof is the DNSSEC chain of trust proving the TXT records of a name.
+// It can be stored along with a witness and validated later with Verify.
+type DNSSECProof struct {
+	// The queried name.
+	Name string `json:"name"`
+	// The signed RRsets, from the root zone keys down to the answer: the
+	// DNSKEY and DS RRsets of each zone, then the CNAME and TXT RRsets.
+	RRsets []*DNSSECRRset `json:"rrsets"`
+}
+
+// DNSSECRRset is a set of resource records and their signatures, in
+// presentation format.
+type DNSSECRRset struct {
+	Records    []string `json:"records"`
+	Signatures []string `json:"signatures"`
+}
+
+// LookupTXT returns the validated TXT records of name.
+func (r *DNSSECResolver) LookupTXT(name string) ([]string, error) {
+	txts, _, err := r.LookupTXTWithProof(name)
+	return txts, err
+}
+
+// LookupTXTStrings returns the validated TXT records of name, with their
+// individual strings. It's suitable for VerifyOptions.LookupTXTStrings.
+func (r *DNSSECResolver) LookupTXTStrings(name string) ([][]string, error) {
+	records, _, err := r.lookup(name)
+	return records, err
+}
+
+// LookupTXTWithProof returns the validated TXT records of name, and the
+// proof of their validity.
+func (r *DNSSECResolver) LookupTXTWithProof(name string) ([]string, *DNSSECProof, error) {
+	records, proof, err := r.lookup(name)
+	return joinTXTRecords(records), proof, err
+}
+
+func (r *DNSSECResolver) lookup(name string) ([][]string, *DNSSECProof, error) {
+	name = dns.Fqdn(name)
+	proof := &DNSSECProof{Name: name}
+	seen := make(map[string]bool)
+	add := func(set *DNSSECRRset) {
+		k := strings.Join(set.Records, "\n")
+		if !seen[k] {
+			seen[k] = true
+			proof.RRsets = append(proof.RRsets, set)
+		}
+	}
+
+	answer, err := r.query(name, dns.TypeTXT)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(answer) == 0 {
+		return nil, proof, nil
+	}
+
+	// Collect the chain of trust of each zone signing the answer
+	for _, set := range answer {
+		sig := set.sigs[0]
+		chain, err := r.queryChain(sig.SignerName)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, set := range chain {
+			add(set.format())
+		}
+	}
+	for _, set := range answer {
+		add(set.format())
+	}
+
+	records, err := proof.verify(name, r.trustAnchors(), r.now())
+	if err != nil {
+		return nil, proof, err
+	}
+	return records, proof, nil
+}
+
+// queryChain returns the DNSKEY and DS RRsets from the root zone down to
+// zone.
+func (r *DNSSECResolver) queryChain(zone string) ([]*signedRRset, error) {
+	var chain []*signedRRset
+	for {
+		keys, err := r.querySigned(zone, dns.TypeDNSKEY)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, keys)
+		if zone == "." {
+			break
+		}
+
+		ds, err := r.querySigned(zone, dns.TypeDS)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, ds)
+
+		parent := ds.sigs[0].SignerName
+		if !dns.IsSubDomain(parent, zone) || dns.CountLabel(parent) >= dns.CountLabel(zone) {
+			return nil, &DNSSECError{Name: zone, Reason: "DS record not signed by a parent zone"}
+		}
+		zone = parent
+	}
+
+	// Reverse the chain, to go from the root down
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+// querySigned queries the signed RRset of the given name and type.
+func (r *DNSSECResolver) querySigned(name string, qtype uint16) (*signedRRset, error) {
+	sets, err := r.query(name, qtype)
+	if err != nil {
+		return nil, err
+	}
+	for _, set := range sets {
+		if set.rrtype == qtype && strings.EqualFold(set.name, name) {
+			return set, nil
+		}
+	}
+	return nil, &DNSSECError{Name: name, Reason: fmt.Sprintf("no %v record found", dns.TypeToString[qtype])}
+}
+
+// query sends a query to the resolver, and groups the answer into signed
+// RRsets.
+func (r *DNSSECResolver) query(name string, qtype uint16) ([]*signedRRset, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.SetEdns0(4096, true)
+	// The records are validated locally, ask the resolver to return them
+	// even if it considers them bogus
+	m.CheckingDisabled = true
+
+	resp, err := exchange(m, r.Addr, r.Net, r.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	return groupRRsets(resp.Answer)
+}
+
+func (r *DNSSECResolver) trustAnchors() []string {
+	if r.TrustAnchors != nil {
+		return r.TrustAnchors
+	}
+	return RootTrustAnchors
+}
+
+func (r *DNSSECResolver) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return now()
+}
+
+// Verify validates the proof of the TXT records of name against the DS records
+// of the root zone, in presentation format, and returns the proven TXT
+// records, following CNAME records. Each TXT record is returned as a single
+// string, like net.LookupTXT does.
+//
+// The name of a key record is given by KeyRecordName. A proof for any other
+// name is rejected, even if its chain of trust is valid: otherwise a proof for
+// a key of another domain could be passed off as proving the signer's key.
+//
+// Wildcard expansions aren't supported, since proving them requires NSEC
+// records.
+func (p *DNSSECProof) Verify(name string, trustAnchors []string, t time.Time) ([]string, error) {
+	records, err := p.verify(name, trustAnchors, t)
+	if err != nil {
+		return nil, err
+	}
+	return joinTXTRecords(records), nil
+}
+
+// verify is like Verify, but returns the individual strings of the TXT
+// records.
+func (p *DNSSECProof) verify(name string, trustAnchors []string, t time.Time) ([][]string, error) {
+	fail := func(format string, v ...interface{}) error {
+		return &DNSSECError{Name: p.Name, Reason: fmt.Sprintf(format, v...)}
+	}
+
+	name = strings.ToLower(dns.Fqdn(name))
+	if !strings.EqualFold(dns.Fqdn(p.Name), name) {
+		return nil, fail("proof is not for %v", name)
+	}
+
+	trustedDS := make(map[string][]*dns.DS)
+	for _, s := range trustAnchors {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			return nil, fail("malformed trust anchor: %v", err)
+		}
+		ds, ok := rr.(*dns.DS)
+		if !ok {
+			return nil, fail("trust anchor is not a DS record")
+		}
+		zone := strings.ToLower(ds.Hdr.Name)
+		trustedDS[zone] = append(trustedDS[zone], ds)
+	}
+	trustedKeys := make(map[string][]*dns.DNSKEY)
+	answers := make(map[string]*signedRRset)
+
+	for _, set := range p.RRsets {
+		rrset, err := set.parse()
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		owner := strings.ToLower(rrset.name)
+
+		if rrset.rrtype == dns.TypeDNSKEY {
+			// The key set must be signed by a key matching a trusted DS
+			// record
+			keys := make([]*dns.DNSKEY, 0, len(rrset.rrs))
+			for _, rr := range rrset.rrs {
+				if key := rr.(*dns.DNSKEY); key.Flags&dns.ZONE != 0 {
+					keys = append(keys, key)
+				}
+			}
+			var dsKeys []*dns.DNSKEY
+			for _, key := range keys {
+				if matchDS(key, trustedDS[owner]) {
+					dsKeys = append(dsKeys, key)
+				}
+			}
+			if len(dsKeys) == 0 {
+				return nil, fail("no DNSKEY of %v matches a trusted DS record", owner)
+			}
+			if err := rrset.verify(owner, dsKeys, t); err != nil {
+				return nil, fail("DNSKEY of %v: %v", owner, err)
+			}
+			trustedKeys[owner] = keys
+			continue
+		}
+
+		zone := strings.ToLower(rrset.sigs[0].SignerName)
+		if !dns.IsSubDomain(zone, owner) {
+			return nil, fail("%v is signed by %v, which isn't a parent zone", owner, zone)
+		}
+		if err := rrset.verify(zone, trustedKeys[zone], t); err != nil {
+			return nil, fail("%v of %v: %v", dns.TypeToString[rrset.rrtype], owner, err)
+		}
+
+		switch rrset.rrtype {
+		case dns.TypeDS:
+			if owner == zone {
+				return nil, fail("DS of %v is signed by the zone itself", owner)
+			}
+			for _, rr := range rrset.rrs {
+				trustedDS[owner] = append(trustedDS[owner], rr.(*dns.DS))
+			}
+		case dns.TypeCNAME, dns.TypeTXT:
+			answers[dns.TypeToString[rrset.rrtype]+" "+owner] = rrset
+		}
+	}
+
+	for i := 0; ; i++ {
+		cname, ok := answers["CNAME "+name]
+		if !ok {
+			break
+		}
+		if i == maxCNAMEChain {
+			return nil, fail("too many CNAME records")
+		}
+		name = strings.ToLower(cname.rrs[0].(*dns.CNAME).Target)
+	}
+	set, ok := answers["TXT "+name]
+	if !ok {
+		return nil, fail("no signed TXT record for %v", name)
+	}
+	records := make([][]string, len(set.rrs))
+	for i, rr := range set.rrs {
+		records[i] = rr.(*dns.TXT).Txt
+	}
+	return records, nil
+}
+
+func joinTXTRecords(records [][]string) []string {
+	if records == nil {
+		return nil
+	}
+	txts := make([]string, len(records))
+	for i, record := range records {
+		txts[i] = strings.Join(record, "")
+	}
+	return txts
+}
+
+// signedRRset is an RRset along with the signatures covering it.
+type signedRRset struct {
+	name   string
+	rrtype uint16
+	rrs    []dns.RR
+	sigs   []*dns.RRSIG
+}
+
+// groupRRsets groups records by name and type, and attaches the signatures
+// to their RRset. Unsigned RRsets are rejected.
+func groupRRsets(rrs []dns.RR) ([]*signedRRset, error) {
+	var sets []*signedRRset
+	index := make(map[string]*signedRRset)
+	get := func(name string, rrtype uint16) *signedRRset {
+		k := strings.ToLower(name) + " " + dns.TypeToString[rrtype]
+		set, ok := index[k]
+		if !ok {
+			set = &signedRRset{name: name, rrtype: rrtype}
+			index[k] = set
+			sets = append(sets, set)
+		}
+		return set
+	}
+
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			set := get(hdr.Name, sig.TypeCovered)
+			set.sigs = append(set.sigs, sig)
+		} else {
+			set := get(hdr.Name, hdr.Rrtype)
+			set.rrs = append(set.rrs, rr)
+		}
+	}
+
+	for _, set := range sets {
+		if len(set.rrs) == 0 {
+			return nil, &DNSSECError{Name: set.name, Reason: "signature without records"}
+		}
+		if len(set.sigs) == 0 {
+			return nil, &DNSSECError{Name: set.name, Reason: fmt.Sprintf("unsigned %v records", dns.TypeToString[set.rrtype])}
+		}
+	}
+	return sets, nil
+}
+
+// verify checks that one of the signatures of the RRset is valid and made by
+// one of the keys of zone.
+func (set *signedRRset) verify(zone string, keys []*dns.DNSKEY, t time.Time) error {
+	if len(keys) == 0 {
+		return errors.New("no trusted key for " + zone)
+	}
+
+	err := errors.New("no valid signature")
+	for _, sig := range set.sigs {
+		if !strings.EqualFold(sig.SignerName, zone) {
+			continue
+		}
+		if int(sig.Labels) != dns.CountLabel(set.name) {
+			err = errors.New("wildcard expansions are not supported")
+			continue
+		}
+		if !sig.ValidityPeriod(t) {
+			err = errors.New("signature expired or not yet valid")
+			continue
+		}
+		for _, key := range keys {
+			if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+				continue
+			}
+			if sig.Verify(key, set.rrs) == nil {
+				return nil
+			}
+		}
+	}
+	return err
+}
+
+// format returns the proof of the record set. Records are stored with the
+// original TTL of their signature and sorted, so that the proof doesn't
+// depend on the resolver cache or on the order of the answer.
+func (set *signedRRset) format() *DNSSECRRset {
+	out := &DNSSECRRset{
+		Records:    make([]string, len(set.rrs)),
+		Signatures: make([]string, len(set.sigs)),
+	}
+	for i, rr := range set.rrs {
+		rr = dns.Copy(rr)
+		if len(set.sigs) > 0 {
+			rr.Header().Ttl = set.sigs[0].OrigTtl
+		}
+		out.Records[i] = rr.String()
+	}
+	for i, sig := range set.sigs {
+		sig = dns.Copy(sig).(*dns.RRSIG)
+		sig.Hdr.Ttl = sig.OrigTtl
+		out.Signatures[i] = sig.String()
+	}
+	sort.Strings(out.Records)
+	sort.Strings(out.Signatures)
+	return out
+}
+
+func (set *DNSSECRRset) parse() (*signedRRset, error) {
+	var rrs []dns.RR
+	for _, s := range append(append([]string(nil), set.Records...), set.Signatures...) {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			return nil, err
+		}
+		if rr == nil {
+			return nil, errors.New("empty record")
+		}
+		rrs = append(rrs, rr)
+	}
+
+	sets, err := groupRRsets(rrs)
+	if err != nil {
+		return nil, err
+	}
+	if len(sets) != 1 {
+		return nil, errors.New("records of an RRset must have the same name and type")
+	}
+	return sets[0], nil
+}
+
+// matchDS returns true if the key matches one of the DS records.
+func matchDS(key *dns.DNSKEY, dss []*dns.DS) bool {
+	for _, ds := range dss {
+		if ds.KeyTag != key.KeyTag() || ds.Algorithm != key.Algorithm {
+			continue
+		}
+		if kds := key.ToDS(ds.DigestType); kds != nil && strings.EqualFold(kds.Digest, ds.Digest) {
+			return true
+		}
+	}
+	return false
+}
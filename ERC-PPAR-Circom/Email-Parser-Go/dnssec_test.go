@@ -0,0 +1,221 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// testZone is a DNSSEC signed zone served by testDNSServer.
+type testZone struct {
+	name string
+	key  *dns.DNSKEY
+	priv crypto.Signer
+}
+
+func newTestZone(t *testing.T, name string) *testZone {
+	t.Helper()
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatalf("DNSKEY.Generate() = %v", err)
+	}
+	return &testZone{name: name, key: key, priv: priv.(crypto.Signer)}
+}
+
+// sign returns the signature of rrs by the zone key, valid around testTime.
+func (z *testZone) sign(t *testing.T, rrs []dns.RR) *dns.RRSIG {
+	t.Helper()
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Ttl: rrs[0].Header().Ttl},
+		Algorithm:  z.key.Algorithm,
+		KeyTag:     z.key.KeyTag(),
+		SignerName: z.name,
+		Inception:  uint32(testTime.Add(-time.Hour).Unix()),
+		Expiration: uint32(testTime.Add(24 * time.Hour).Unix()),
+	}
+	if err := sig.Sign(z.priv, rrs); err != nil {
+		t.Fatalf("RRSIG.Sign() = %v", err)
+	}
+	return sig
+}
+
+// testDNSServer answers queries with signed RRsets, like a recursive resolver
+// would.
+type testDNSServer struct {
+	t       *testing.T
+	records map[string][]dns.RR // by "name type", including the signatures
+}
+
+// add adds the RRset rrs signed by zone.
+func (s *testDNSServer) add(zone *testZone, rrs ...dns.RR) {
+	k := strings.ToLower(rrs[0].Header().Name) + " " + dns.TypeToString[rrs[0].Header().Rrtype]
+	s.records[k] = append(append([]dns.RR(nil), rrs...), zone.sign(s.t, rrs))
+}
+
+func (s *testDNSServer) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	q := req.Question[0]
+	if rrs, ok := s.records[strings.ToLower(q.Name)+" "+dns.TypeToString[q.Qtype]]; ok {
+		resp.Answer = rrs
+	} else {
+		resp.Rcode = dns.RcodeNameError
+	}
+	w.WriteMsg(resp)
+}
+
+// testDNSSEC starts a DNS server serving the signed key records of
+// test._domainkey.example.org, as two strings, and
+// other._domainkey.example.org. It returns a resolver using it.
+func testDNSSEC(t *testing.T, record string) *DNSSECResolver {
+	t.Helper()
+	root := newTestZone(t, ".")
+	org := newTestZone(t, "org.")
+	example := newTestZone(t, "example.org.")
+
+	s := &testDNSServer{t: t, records: make(map[string][]dns.RR)}
+	for _, z := range []*testZone{root, org, example} {
+		s.add(z, z.key)
+	}
+	s.add(root, org.key.ToDS(dns.SHA256))
+	s.add(org, example.key.ToDS(dns.SHA256))
+
+	hdr := func(name string) dns.RR_Header {
+		return dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}
+	}
+	half := len(record) / 2
+	s.add(example, &dns.TXT{Hdr: hdr("test._domainkey.example.org."), Txt: []string{record[:half], record[half:]}})
+	s.add(example, &dns.TXT{Hdr: hdr("other._domainkey.example.org."), Txt: []string{"v=DKIM1; p="}})
+
+	return &DNSSECResolver{
+		Addr:         testServeDNS(t, s),
+		TrustAnchors: []string{root.key.ToDS(dns.SHA256).String()},
+		Now:          func() time.Time { return testTime },
+	}
+}
+
+func TestDNSSECResolver(t *testing.T) {
+	record, err := FormatKeyRecord(testRSAKey.Public())
+	if err != nil {
+		t.Fatalf("FormatKeyRecord() = %v", err)
+	}
+	r := testDNSSEC(t, record)
+	name := KeyRecordName(testDomain, testSelector)
+
+	records, err := r.LookupTXTStrings(name)
+	if err != nil {
+		t.Fatalf("LookupTXTStrings() = %v", err)
+	}
+	if len(records) != 1 || len(records[0]) != 2 || strings.Join(records[0], "") != record {
+		t.Errorf("LookupTXTStrings() = %q, want the two strings of %q", records, record)
+	}
+
+	txts, proof, err := r.LookupTXTWithProof(name)
+	if err != nil {
+		t.Fatalf("LookupTXTWithProof() = %v", err)
+	}
+	if len(txts) != 1 || txts[0] != record {
+		t.Errorf("LookupTXTWithProof() = %q, want %q", txts, record)
+	}
+
+	// The proof is checked once serialized
+	b, err := json.Marshal(proof)
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v", err)
+	}
+	proof = new(DNSSECProof)
+	if err := json.Unmarshal(b, proof); err != nil {
+		t.Fatalf("json.Unmarshal() = %v", err)
+	}
+	txts, err = proof.Verify(strings.ToUpper(name), r.TrustAnchors, testTime)
+	if err != nil {
+		t.Fatalf("DNSSECProof.Verify() = %v", err)
+	}
+	if len(txts) != 1 || txts[0] != record {
+		t.Errorf("DNSSECProof.Verify() = %q, want %q", txts, record)
+	}
+
+	if _, err := r.LookupTXT("missing._domainkey.example.org"); err == nil {
+		t.Errorf("LookupTXT() for a missing name succeeded")
+	}
+}
+
+func TestDNSSECProof_Verify_invalid(t *testing.T) {
+	r := testDNSSEC(t, "v=DKIM1; p=")
+	name := KeyRecordName(testDomain, testSelector)
+	_, proof, err := r.LookupTXTWithProof(name)
+	if err != nil {
+		t.Fatalf("LookupTXTWithProof() = %v", err)
+	}
+	_, other, err := r.LookupTXTWithProof(KeyRecordName(testDomain, "other"))
+	if err != nil {
+		t.Fatalf("LookupTXTWithProof() = %v", err)
+	}
+
+	renamed := *other
+	renamed.Name = name + "."
+	tampered := *proof
+	tampered.RRsets = append([]*DNSSECRRset(nil), proof.RRsets...)
+	last := *tampered.RRsets[len(tampered.RRsets)-1]
+	last.Records = []string{strings.Replace(last.Records[0], `p="`, `p=AAAA"`, 1)}
+	tampered.RRsets[len(tampered.RRsets)-1] = &last
+
+	tests := []struct {
+		name    string
+		proof   *DNSSECProof
+		anchors []string
+		t       time.Time
+	}{
+		{"other-name", other, r.TrustAnchors, testTime},
+		{"renamed", &renamed, r.TrustAnchors, testTime},
+		{"tampered", &tampered, r.TrustAnchors, testTime},
+		{"expired", proof, r.TrustAnchors, testTime.Add(48 * time.Hour)},
+		{"not-yet-valid", proof, r.TrustAnchors, testTime.Add(-48 * time.Hour)},
+		{"root-anchors", proof, RootTrustAnchors, testTime},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.proof.Verify(name, tc.anchors, tc.t)
+			var dnssecErr *DNSSECError
+			if !errors.As(err, &dnssecErr) {
+				t.Errorf("DNSSECProof.Verify() = %v, want a DNSSECError", err)
+			}
+		})
+	}
+}
+
+func TestBuildWitness_dnssec(t *testing.T) {
+	record, err := FormatKeyRecord(testRSAKey.Public())
+	if err != nil {
+		t.Fatalf("FormatKeyRecord() = %v", err)
+	}
+	r := testDNSSEC(t, record)
+
+	signed := testSign(t, testMessage, nil)
+	w, err := BuildWitness(bytes.NewReader(signed), &WitnessOptions{DNSSEC: r})
+	if err != nil {
+		t.Fatalf("BuildWitness() = %v", err)
+	}
+	if w.KeyProof == nil {
+		t.Fatalf("witness has no key proof")
+	}
+	txts, err := w.KeyProof.Verify(KeyRecordName(w.Domain, w.Selector), r.TrustAnchors, testTime)
+	if err != nil {
+		t.Fatalf("DNSSECProof.Verify() = %v", err)
+	}
+	if len(txts) != 1 || txts[0] != record {
+		t.Errorf("DNSSECProof.Verify() = %q, want %q", txts, record)
+	}
+}
@@ -0,0 +1,163 @@
+package dkim
+
+import (
+	"crypto/rand"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// eaiVectors are header fields of internationalized messages (RFC 6532), with
+// their expected relaxed canonicalization. For From fields, address and name
+// are the expected parsed address and decoded display name.
+var eaiVectors = []struct {
+	field   string
+	relaxed string
+	address string
+	name    string
+}{
+	{
+		field:   "From: 用户 <用户@例子.公司>\r\n",
+		relaxed: "from:用户 <用户@例子.公司>\r\n",
+		address: "用户@例子.公司",
+		name:    "用户",
+	},
+	{
+		field:   "FROM:  José   Núñez\r\n <jose@exämple.es>\r\n",
+		relaxed: "from:José Núñez <jose@exämple.es>\r\n",
+		address: "jose@exämple.es",
+		name:    "José Núñez",
+	},
+	{
+		field:   "From: =?UTF-8?B?5p2O5piO?= <li.ming@example.com>\r\n",
+		relaxed: "from:=?UTF-8?B?5p2O5piO?= <li.ming@example.com>\r\n",
+		address: "li.ming@example.com",
+		name:    "李明",
+	},
+	{
+		field:   "From: =?ISO-8859-1?Q?Ren=E9?= <rene@example.fr>\r\n",
+		relaxed: "from:=?ISO-8859-1?Q?Ren=E9?= <rene@example.fr>\r\n",
+		address: "rene@example.fr",
+		name:    "René",
+	},
+	{
+		// Unknown charsets don't prevent the address from being parsed
+		field:   "From: =?x-unknown?Q?Ren=E9?= <rene@example.fr>\r\n",
+		relaxed: "from:=?x-unknown?Q?Ren=E9?= <rene@example.fr>\r\n",
+		address: "rene@example.fr",
+		name:    "Ren\ufffd",
+	},
+	{
+		field:   "From: \"Zoë <admin@example.org>\" <zoë@example.org>\r\n",
+		relaxed: "from:\"Zoë <admin@example.org>\" <zoë@example.org>\r\n",
+		address: "zoë@example.org",
+		name:    "Zoë <admin@example.org>",
+	},
+	{
+		field:   "From: δοκιμή@παράδειγμα.δοκιμή\r\n",
+		relaxed: "from:δοκιμή@παράδειγμα.δοκιμή\r\n",
+		address: "δοκιμή@παράδειγμα.δοκιμή",
+	},
+	{
+		field:   "Subject: =?UTF-8?Q?r=C3=A9cup=C3=A9ration?= du compte\r\n",
+		relaxed: "subject:=?UTF-8?Q?r=C3=A9cup=C3=A9ration?= du compte\r\n",
+	},
+	{
+		// U+00A0 NO-BREAK SPACE isn't whitespace for the relaxed
+		// canonicalization
+		field:   "Subject:\tRécupération\u00a0 du   compte \r\n",
+		relaxed: "subject:Récupération\u00a0 du compte\r\n",
+	},
+	{
+		// U+212A KELVIN SIGN is lowercased to "k" by Unicode case mapping,
+		// but only ASCII letters are folded in field names
+		field:   "X-\u212aey: value\r\n",
+		relaxed: "x-\u212aey:value\r\n",
+	},
+}
+
+func TestEAI_relaxed(t *testing.T) {
+	relaxed, _ := lookupCanonicalizer(CanonicalizationRelaxed)
+	for _, v := range eaiVectors {
+		if can := relaxed.CanonicalizeHeader(v.field); can != v.relaxed {
+			t.Errorf("relaxed canonicalization of %q = %q, want %q", v.field, can, v.relaxed)
+		}
+	}
+}
+
+func TestEAI_fromAddress(t *testing.T) {
+	for _, v := range eaiVectors {
+		if v.address == "" {
+			continue
+		}
+
+		addr, err := ParseFromAddress(strings.TrimPrefix(v.field[strings.Index(v.field, ":")+1:], " "))
+		if err != nil {
+			t.Errorf("ParseFromAddress(%q) = %v", v.field, err)
+			continue
+		}
+		if addr.Address != v.address || addr.Name != v.name {
+			t.Errorf("ParseFromAddress(%q) = %q <%v>, want %q <%v>", v.field, addr.Name, addr.Address, v.name, v.address)
+		}
+
+		for _, name := range []Canonicalization{CanonicalizationSimple, CanonicalizationRelaxed} {
+			c, _ := lookupCanonicalizer(name)
+			h := []byte("to:guardian@example.org\r\n" + c.CanonicalizeHeader(v.field) + "subject:Recovery\r\n")
+			reveal, err := FindFromAddress(h)
+			if err != nil {
+				t.Errorf("%v: FindFromAddress(%q) = %v", name, h, err)
+				continue
+			}
+			if string(reveal.Value) != v.address {
+				t.Errorf("%v: FindFromAddress(%q) = %q, want %q", name, h, reveal.Value, v.address)
+			}
+			if err := reveal.Check(h); err != nil {
+				t.Errorf("%v: Reveal.Check() = %v", name, err)
+			}
+		}
+	}
+}
+
+func TestEAI_folding(t *testing.T) {
+	for _, s := range []string{strings.Repeat("é", 100), strings.Repeat("用户", 50), "a" + strings.Repeat("👋", 40)} {
+		folded := foldHeaderField(" b=" + s)
+		for _, l := range strings.Split(strings.TrimSuffix(folded, crlf), crlf) {
+			if !utf8.ValidString(l) {
+				t.Errorf("folding %q splits a UTF-8 sequence: %q", s, l)
+			}
+		}
+		if unfolded := strings.ReplaceAll(strings.TrimSuffix(folded, crlf), crlf+" ", ""); unfolded != " b="+s {
+			t.Errorf("folding %q = %q, unfolded as %q", s, folded, unfolded)
+		}
+	}
+}
+
+func TestEAI_signVerify(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+
+	for _, v := range eaiVectors {
+		msg := v.field + "To: =?UTF-8?B?5a6I5oqk6ICF?= <守护者@例子.公司>\r\n" +
+			"Content-Type: text/plain; charset=utf-8\r\n" +
+			"\r\n" +
+			"Récupération du compte 用户\r\n"
+		if v.address == "" {
+			msg = "From: 用户 <用户@例子.公司>\r\n" + msg
+		}
+
+		for _, name := range []Canonicalization{CanonicalizationSimple, CanonicalizationRelaxed} {
+			testSignVerify(t, msg, &SignOptions{
+				Domain:                 "xn--fsqu00a.xn--55qx5d", // 例子.公司
+				Selector:               "eai",
+				Signer:                 priv,
+				HeaderCanonicalization: name,
+				BodyCanonicalization:   name,
+				HeaderKeys:             []string{"From", "To", "Subject", "X-\u212aey"},
+			})
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"mime/quotedprintable"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// FixtureOptions configures GenerateFixture. All fields are optional.
+type FixtureOptions struct {
+	// The signing domain and selector. Defaults to "gmail.com" and
+	// "20230601", like Gmail.
+	Domain   string
+	Selector string
+
+	// The key algorithm, "rsa" (default) or "ed25519", and the RSA key size
+	// in bits (default 2048).
+	KeyAlgorithm string
+	RSABits      int
+
+	// The sender and recipient addresses. Defaults to a random address in
+	// Domain and "guardian@example.org".
+	From string
+	To   string
+	// The display name of the sender. Defaults to "Alice".
+	FromName string
+	// The subject. Defaults to "Account recovery request".
+	Subject string
+	// The text content of the message. If empty, a recovery request with a
+	// random recovery code is generated.
+	Text string
+
+	// If Multipart is set, the message is a multipart/alternative message
+	// with quoted-printable text/plain and text/html parts, like the ones
+	// sent by Gmail.
+	Multipart bool
+
+	// The signature and Date header field time. Defaults to the current time.
+	Time time.Time
+}
+
+// A Fixture is a synthetic signed email, along with the key needed to verify
+// it. Fixtures allow testing the whole pipeline without personal data.
+type Fixture struct {
+	// The signed message.
+	Message []byte
+
+	Domain   string
+	Selector string
+	// The key used to sign the message, and its DNS TXT record.
+	Signer    crypto.Signer
+	KeyRecord string
+
+	// The recovery code included in the generated text, if any.
+	RecoveryCode string
+}
+
+// GenerateFixture generates a signed email with a freshly generated key.
+func GenerateFixture(options *FixtureOptions) (*Fixture, error) {
+	if options == nil {
+		options = new(FixtureOptions)
+	}
+
+	f := &Fixture{
+		Domain:   orDefault(options.Domain, "gmail.com"),
+		Selector: orDefault(options.Selector, "20230601"),
+	}
+
+	switch options.KeyAlgorithm {
+	case "", "rsa":
+		bits := options.RSABits
+		if bits == 0 {
+			bits = 2048
+		}
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, err
+		}
+		f.Signer = key
+	case "ed25519":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		f.Signer = key
+	default:
+		return nil, fmt.Errorf("dkim: unsupported key algorithm %q", options.KeyAlgorithm)
+	}
+
+	var err error
+	f.KeyRecord, err = FormatKeyRecord(f.Signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	t := options.Time
+	if t.IsZero() {
+		t = now()
+	}
+
+	text := options.Text
+	if text == "" {
+		code, err := rand.Int(rand.Reader, big.NewInt(1000000))
+		if err != nil {
+			return nil, err
+		}
+		f.RecoveryCode = fmt.Sprintf("%06d", code)
+		text = "Hi,\r\n\r\n" +
+			"I confirm that I am the guardian of this account and approve its recovery.\r\n\r\n" +
+			"Approve recovery code: " + f.RecoveryCode + "\r\n\r\n" +
+			"Best regards,\r\n" + orDefault(options.FromName, "Alice") + "\r\n"
+	}
+
+	from := options.From
+	if from == "" {
+		id, err := randomHex(4)
+		if err != nil {
+			return nil, err
+		}
+		from = "alice." + id + "@" + f.Domain
+	}
+	messageID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Date: " + t.Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("Message-ID: <CA+" + messageID + "@mail." + f.Domain + ">\r\n")
+	msg.WriteString("Subject: " + orDefault(options.Subject, "Account recovery request") + "\r\n")
+	msg.WriteString("From: " + orDefault(options.FromName, "Alice") + " <" + from + ">\r\n")
+	msg.WriteString("To: " + orDefault(options.To, "guardian@example.org") + "\r\n")
+	if options.Multipart {
+		id, err := randomHex(8)
+		if err != nil {
+			return nil, err
+		}
+		boundary := "000000000000" + id
+		msg.WriteString("Content-Type: multipart/alternative; boundary=\"" + boundary + "\"\r\n\r\n")
+
+		html := "<div dir=\"ltr\">" + strings.ReplaceAll(text, "\r\n", "<br>") + "</div>\r\n"
+		for _, part := range []struct{ mediaType, content string }{
+			{"text/plain", text},
+			{"text/html", html},
+		} {
+			msg.WriteString("--" + boundary + "\r\n")
+			msg.WriteString("Content-Type: " + part.mediaType + "; charset=\"UTF-8\"\r\n")
+			msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+			qp := quotedprintable.NewWriter(&msg)
+			if _, err := qp.Write([]byte(part.content)); err != nil {
+				return nil, err
+			}
+			if err := qp.Close(); err != nil {
+				return nil, err
+			}
+			msg.WriteString("\r\n")
+		}
+		msg.WriteString("--" + boundary + "--\r\n")
+	} else {
+		msg.WriteString("Content-Type: text/plain; charset=\"UTF-8\"\r\n\r\n")
+		msg.WriteString(text)
+	}
+
+	var signed bytes.Buffer
+	err = Sign(&signed, &msg, &SignOptions{
+		Domain:                 f.Domain,
+		Selector:               f.Selector,
+		Signer:                 f.Signer,
+		HeaderCanonicalization: CanonicalizationRelaxed,
+		BodyCanonicalization:   CanonicalizationRelaxed,
+		HeaderPreset:           HeaderPresetGmail,
+		Now:                    func() time.Time { return t },
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.Message = signed.Bytes()
+
+	return f, nil
+}
+
+// LookupTXT is an offline key provider returning the fixture's key record,
+// suitable for VerifyOptions.LookupTXT.
+func (f *Fixture) LookupTXT(domain string) ([]string, error) {
+	if !strings.EqualFold(domain, KeyRecordName(f.Domain, f.Selector)) {
+		return nil, fmt.Errorf("dkim: no fixture record for %v", domain)
+	}
+	return []string{f.KeyRecord}, nil
+}
+
+// WriteFiles writes the message to dir/name.eml, and the key record to
+// dir/selector._domainkey.domain, in lowercase, where it can be found by
+// KeyDirLookup.
+func (f *Fixture) WriteFiles(dir, name string) error {
+	record, err := keyRecordFile(KeyRecordName(f.Domain, f.Selector))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".eml"), f.Message, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, record), []byte(f.KeyRecord+"\n"), 0644)
+}
+
+// KeyDirLookup returns an offline key provider reading key records from the
+// files written by Fixture.WriteFiles in dir, suitable for
+// VerifyOptions.LookupTXT.
+func KeyDirLookup(dir string) func(domain string) ([]string, error) {
+	return func(domain string) ([]string, error) {
+		name, err := keyRecordFile(domain)
+		if err != nil {
+			return nil, err
+		}
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		return []string{strings.TrimSpace(string(b))}, nil
+	}
+}
+
+// keyRecordFile returns the name of the file holding the key record of
+// domain, see KeyDirLookup. DNS names are case-insensitive, so it's in
+// lowercase, without the trailing dot.
+func keyRecordFile(domain string) (string, error) {
+	name := strings.ToLower(strings.TrimSuffix(domain, "."))
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", errors.New("dkim: invalid key record name")
+	}
+	return name, nil
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
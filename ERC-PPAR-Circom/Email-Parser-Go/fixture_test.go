@@ -0,0 +1,130 @@
+package dkim
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGenerateFixture(t *testing.T) {
+	tests := []struct {
+		name    string
+		options FixtureOptions
+	}{
+		{"rsa", FixtureOptions{}},
+		{"rsa multipart", FixtureOptions{Multipart: true, FromName: "José Núñez"}},
+		{"ed25519", FixtureOptions{KeyAlgorithm: "ed25519", Domain: "example.org", Selector: "sel"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := GenerateFixture(&tc.options)
+			if err != nil {
+				t.Fatalf("GenerateFixture() = %v", err)
+			}
+			verif := testVerify(t, f.Message, &VerifyOptions{LookupTXT: f.LookupTXT})
+			if verif.Err != nil {
+				t.Fatalf("Verification.Err = %v", verif.Err)
+			}
+			if verif.Domain != f.Domain || verif.Selector != f.Selector {
+				t.Errorf("signed by %v/%v, want %v/%v", verif.Domain, verif.Selector, f.Domain, f.Selector)
+			}
+			if len(f.RecoveryCode) != 6 {
+				t.Errorf("RecoveryCode = %q, want 6 digits", f.RecoveryCode)
+			}
+		})
+	}
+}
+
+func TestGenerateFixture_witness(t *testing.T) {
+	f, err := GenerateFixture(&FixtureOptions{Multipart: true, Time: testTime})
+	if err != nil {
+		t.Fatalf("GenerateFixture() = %v", err)
+	}
+
+	// Write the fixture and read its key back like the commands do
+	dir := t.TempDir()
+	if err := f.WriteFiles(dir, "fixture"); err != nil {
+		t.Fatalf("WriteFiles() = %v", err)
+	}
+	w, err := BuildWitness(bytes.NewReader(f.Message), &WitnessOptions{
+		LookupTXT:   KeyDirLookup(dir),
+		DecodeMIME:  true,
+		BodyReveals: []*RevealSpec{{Name: "code", Anchor: "recovery code: "}},
+	})
+	if err != nil {
+		t.Fatalf("BuildWitness() = %v", err)
+	}
+	if string(w.BodyReveals[0].Text) != f.RecoveryCode {
+		t.Errorf("revealed code = %q, want %q", w.BodyReveals[0].Text, f.RecoveryCode)
+	}
+	if !w.Time.Equal(testTime) {
+		t.Errorf("Time = %v, want %v", w.Time, testTime)
+	}
+
+	signature, err := w.SignatureSignals()
+	if err != nil {
+		t.Fatalf("SignatureSignals() = %v", err)
+	}
+	combined, err := w.CombinedSignals()
+	if err != nil {
+		t.Fatalf("CombinedSignals() = %v", err)
+	}
+	claims, err := w.ClaimSignals()
+	if err != nil {
+		t.Fatalf("ClaimSignals() = %v", err)
+	}
+	if _, err := WitnessFromSignals(signature, combined, claims); err != nil {
+		t.Errorf("WitnessFromSignals() = %v", err)
+	}
+}
+
+func TestKeyDirLookup(t *testing.T) {
+	f, err := GenerateFixture(&FixtureOptions{KeyAlgorithm: "ed25519"})
+	if err != nil {
+		t.Fatalf("GenerateFixture() = %v", err)
+	}
+	dir := t.TempDir()
+	if err := f.WriteFiles(dir, "fixture"); err != nil {
+		t.Fatalf("WriteFiles() = %v", err)
+	}
+
+	lookup := KeyDirLookup(dir)
+	records, err := lookup(KeyRecordName(f.Domain, f.Selector) + ".")
+	if err != nil || len(records) != 1 || records[0] != f.KeyRecord {
+		t.Errorf("lookup() = %v, %v, want %q", records, err, f.KeyRecord)
+	}
+	for _, name := range []string{"", ".", "../fixture.eml", "a/b", "missing.example.org"} {
+		if _, err := lookup(name); err == nil {
+			t.Errorf("lookup(%q) = nil, want an error", name)
+		}
+	}
+}
+
+func TestKeyDirLookup_mixedCase(t *testing.T) {
+	f, err := GenerateFixture(&FixtureOptions{KeyAlgorithm: "ed25519", Domain: "Example.ORG", Selector: "Sel2024"})
+	if err != nil {
+		t.Fatalf("GenerateFixture() = %v", err)
+	}
+	dir := t.TempDir()
+	if err := f.WriteFiles(dir, "fixture"); err != nil {
+		t.Fatalf("WriteFiles() = %v", err)
+	}
+
+	// The message is verified with the name as written in its signature
+	verif := testVerify(t, f.Message, &VerifyOptions{LookupTXT: KeyDirLookup(dir)})
+	if verif.Err != nil {
+		t.Fatalf("Verification.Err = %v", verif.Err)
+	}
+	lookup := KeyDirLookup(dir)
+	for _, name := range []string{"sel2024._domainkey.example.org", "SEL2024._DOMAINKEY.EXAMPLE.ORG."} {
+		records, err := lookup(name)
+		if err != nil || len(records) != 1 || records[0] != f.KeyRecord {
+			t.Errorf("lookup(%q) = %v, %v, want %q", name, records, err, f.KeyRecord)
+		}
+	}
+}
+
+func TestGenerateFixture_invalid(t *testing.T) {
+	if _, err := GenerateFixture(&FixtureOptions{KeyAlgorithm: "dsa"}); err == nil {
+		t.Error("GenerateFixture() = nil with an unsupported key algorithm")
+	}
+}
@@ -0,0 +1,68 @@
+package dkim
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FreshnessPolicy restricts the signature timestamp, i.e. its "t" tag. A
+// recovery email must have been signed after the recovery request was made,
+// and recently enough.
+//
+// Signatures without a timestamp or outside of the allowed window fail with a
+// policy error.
+type FreshnessPolicy struct {
+	// NotBefore is the earliest accepted signature time, e.g. the time the
+	// recovery request nonce was issued. The signature must be strictly newer.
+	// If zero, there is no lower bound other than MaxAge.
+	NotBefore time.Time
+	// MaxAge is the maximum age of the signature. If zero, signatures can be
+	// arbitrarily old.
+	MaxAge time.Duration
+	// ClockSkew is how far in the future a signature can be, to tolerate
+	// clock differences between the signer and the verifier.
+	ClockSkew time.Duration
+}
+
+func (p *FreshnessPolicy) check(t, now time.Time) error {
+	if t.IsZero() {
+		return policyError("signature has no timestamp")
+	}
+	if !p.NotBefore.IsZero() && !t.After(p.NotBefore) {
+		return policyError(fmt.Sprintf("signature is older than the recovery request (signed at %v, request at %v)", t.Unix(), p.NotBefore.Unix()))
+	}
+	if p.MaxAge > 0 && now.Sub(t) > p.MaxAge {
+		return policyError(fmt.Sprintf("signature is too old (signed at %v, max age %v)", t.Unix(), p.MaxAge))
+	}
+	if t.Sub(now) > p.ClockSkew {
+		return policyError(fmt.Sprintf("signature is in the future (signed at %v, now %v)", t.Unix(), now.Unix()))
+	}
+	return nil
+}
+
+// findTimeTag returns the byte range of the "t" tag value in a
+// DKIM-Signature header field, canonicalized or not. The tag list is split
+// like parseHeaderParams does, so that text looking like a "t" tag inside
+// another tag value, e.g. a header field copied in the "z" tag, isn't taken
+// for it. It returns false if there is no such tag.
+func findTimeTag(sigField string) (RevealRange, bool) {
+	_, tags, ok := strings.Cut(sigField, ":")
+	if !ok {
+		return RevealRange{}, false
+	}
+	offset := len(sigField) - len(tags)
+	for _, tag := range strings.Split(tags, ";") {
+		key, value, ok := strings.Cut(tag, "=")
+		if ok && strings.TrimSpace(key) == "t" {
+			start := offset + len(key) + 1 + len(value) - len(strings.TrimLeft(value, " \t\r\n"))
+			end := start + len(strings.TrimSpace(value))
+			if start == end {
+				return RevealRange{}, false
+			}
+			return RevealRange{start, end}, true
+		}
+		offset += len(tag) + 1
+	}
+	return RevealRange{}, false
+}
@@ -0,0 +1,112 @@
+package dkim
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFreshnessPolicy(t *testing.T) {
+	request := testTime.Add(-time.Hour)
+	policy := &FreshnessPolicy{NotBefore: request, MaxAge: 24 * time.Hour, ClockSkew: time.Minute}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		now  time.Time
+		ok   bool
+	}{
+		{"fresh", testTime, testTime.Add(time.Hour), true},
+		{"no timestamp", time.Time{}, testTime, false},
+		{"before the request", request.Add(-time.Second), testTime, false},
+		{"at the request", request, testTime, false},
+		{"too old", testTime, testTime.Add(25 * time.Hour), false},
+		{"small clock skew", testTime, testTime.Add(-30 * time.Second), true},
+		{"in the future", testTime, testTime.Add(-time.Hour), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.check(tc.t, tc.now)
+			if tc.ok && err != nil {
+				t.Errorf("check() = %v", err)
+			} else if !tc.ok && !IsPolicyFail(err) {
+				t.Errorf("check() = %v, want a policy error", err)
+			}
+		})
+	}
+}
+
+func TestVerify_freshness(t *testing.T) {
+	signed := testSign(t, testMessage, nil)
+	lookup := testLookupTXT(t, testRSAKey.Public())
+	policy := &FreshnessPolicy{NotBefore: testTime.Add(-time.Hour), MaxAge: time.Hour}
+
+	for _, tc := range []struct {
+		now time.Time
+		ok  bool
+	}{
+		{testTime.Add(time.Minute), true},
+		{testTime.Add(2 * time.Hour), false},
+	} {
+		options := &VerifyOptions{LookupTXT: lookup, Freshness: policy, Now: func() time.Time { return tc.now }}
+		if verif := testVerify(t, signed, options); (verif.Err == nil) != tc.ok {
+			t.Errorf("at %v: Verification.Err = %v", tc.now.Unix(), verif.Err)
+		}
+
+		_, err := BuildWitness(bytes.NewReader(signed), &WitnessOptions{LookupTXT: lookup, Freshness: policy, Now: func() time.Time { return tc.now }})
+		if (err == nil) != tc.ok {
+			t.Errorf("at %v: BuildWitness() = %v", tc.now.Unix(), err)
+		}
+	}
+}
+
+func TestBuildWitness_signatureTime(t *testing.T) {
+	w := testWitness(t, testMessage, nil, nil)
+	if !w.Time.Equal(testTime) {
+		t.Errorf("Time = %v, want %v", w.Time, testTime)
+	}
+	tag := string(w.Header[w.TimeRange.Start:w.TimeRange.End])
+	if tag != strconv.FormatInt(testTime.Unix(), 10) {
+		t.Errorf("Header[TimeRange] = %q, want %v", tag, testTime.Unix())
+	}
+
+	if _, ok := w.CombinedInput()["signatureTime"]; ok {
+		t.Errorf("signatureTime is a combined circuit input")
+	}
+	input := w.ClaimsInput()
+	if input["signatureTime"] != tag {
+		t.Errorf("signatureTime input = %v, want %v", input["signatureTime"], tag)
+	}
+	if input["signatureTimeStart"] != strconv.Itoa(w.TimeRange.Start) || input["signatureTimeEnd"] != strconv.Itoa(w.TimeRange.End) {
+		t.Errorf("signatureTimeStart, signatureTimeEnd inputs = %v, %v, want %v", input["signatureTimeStart"], input["signatureTimeEnd"], w.TimeRange)
+	}
+}
+
+func TestFindTimeTag(t *testing.T) {
+	tests := []struct {
+		field string
+		value string
+	}{
+		{"dkim-signature:v=1; a=rsa-sha256; t=1700000000; x=1700003600; b=", "1700000000"},
+		{"DKIM-Signature: v=1;\r\n t =\r\n 1700000000; b=", "1700000000"},
+		{"dkim-signature:t=42; b=", "42"},
+		{"dkim-signature:v=1; st=1; b=", ""},
+		{"dkim-signature:v=1; b=t=1", ""},
+		{"dkim-signature:v=1; z=Subject:t=1; t=1700000000; b=", "1700000000"},
+		{"dkim-signature:v=1; z=X-Note:t=5|Date:t=6; b=", ""},
+		{"dkim-signature:v=1; t=; b=", ""},
+	}
+	for _, tc := range tests {
+		r, ok := findTimeTag(tc.field)
+		if tc.value == "" {
+			if ok {
+				t.Errorf("findTimeTag(%q) = %v, want no match", tc.field, r)
+			}
+			continue
+		}
+		if !ok || tc.field[r.Start:r.End] != tc.value {
+			t.Errorf("findTimeTag(%q) = %v, %v, want %q", tc.field, r, ok, tc.value)
+		}
+	}
+}
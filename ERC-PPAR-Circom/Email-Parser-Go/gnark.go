@@ -0,0 +1,97 @@
+package dkim
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// BN254ScalarField is the order of the scalar field of the BN254 curve, the
+// field of the circom and gnark circuits.
+var BN254ScalarField, _ = new(big.Int).SetString("21888242871839275222246405745257275088548364400416034343698204186575808495617", 10)
+
+// bn254ElementSize is the size of an encoded BN254 scalar field element.
+const bn254ElementSize = 32
+
+// MarshalGnarkWitness encodes signals as a gnark BN254 witness, as written
+// by witness.Witness.MarshalBinary: the number of public and secret elements
+// as big-endian uint32, then the vector of elements, prefixed by its length,
+// each element as 32 big-endian bytes. Public signals come first, in the
+// order of signals.
+func MarshalGnarkWitness(signals []Signal) ([]byte, error) {
+	var public, secret []*big.Int
+	for _, s := range signals {
+		for _, v := range s.Values {
+			if v.Sign() < 0 || v.Cmp(BN254ScalarField) >= 0 {
+				return nil, fmt.Errorf("dkim: input %q has a value outside of the BN254 scalar field", s.Name)
+			}
+		}
+		if s.Public {
+			public = append(public, s.Values...)
+		} else {
+			secret = append(secret, s.Values...)
+		}
+	}
+
+	n := len(public) + len(secret)
+	b := make([]byte, 12, 12+n*bn254ElementSize)
+	binary.BigEndian.PutUint32(b[0:], uint32(len(public)))
+	binary.BigEndian.PutUint32(b[4:], uint32(len(secret)))
+	binary.BigEndian.PutUint32(b[8:], uint32(n))
+	for _, v := range append(public, secret...) {
+		b = append(b, v.FillBytes(make([]byte, bn254ElementSize))...)
+	}
+	return b, nil
+}
+
+// UnmarshalGnarkWitness decodes a gnark BN254 witness encoded by
+// MarshalGnarkWitness. Since the witness only holds field elements, the
+// signals are described by layout.
+func UnmarshalGnarkWitness(b []byte, layout []SignalLayout) ([]Signal, error) {
+	if len(b) < 12 {
+		return nil, errors.New("dkim: gnark witness too short")
+	}
+	nbPublic := int(binary.BigEndian.Uint32(b[0:]))
+	nbSecret := int(binary.BigEndian.Uint32(b[4:]))
+	n := int(binary.BigEndian.Uint32(b[8:]))
+	b = b[12:]
+	if n != nbPublic+nbSecret || len(b) != n*bn254ElementSize {
+		return nil, errors.New("dkim: malformed gnark witness")
+	}
+
+	var wantPublic, wantSecret int
+	for _, l := range layout {
+		if err := l.check(); err != nil {
+			return nil, err
+		}
+		if l.Public {
+			wantPublic += l.Len
+		} else {
+			wantSecret += l.Len
+		}
+	}
+	if nbPublic != wantPublic || nbSecret != wantSecret {
+		return nil, fmt.Errorf("dkim: gnark witness has %v public and %v secret elements, layout expects %v and %v", nbPublic, nbSecret, wantPublic, wantSecret)
+	}
+
+	elements := make([]*big.Int, n)
+	for i := range elements {
+		elements[i] = new(big.Int).SetBytes(b[i*bn254ElementSize : (i+1)*bn254ElementSize])
+		if elements[i].Cmp(BN254ScalarField) >= 0 {
+			return nil, errors.New("dkim: gnark witness element outside of the BN254 scalar field")
+		}
+	}
+
+	public, secret := elements[:nbPublic], elements[nbPublic:]
+	signals := make([]Signal, len(layout))
+	for i, l := range layout {
+		values := &secret
+		if l.Public {
+			values = &public
+		}
+		signals[i] = l.signal((*values)[:l.Len])
+		*values = (*values)[l.Len:]
+	}
+	return signals, nil
+}
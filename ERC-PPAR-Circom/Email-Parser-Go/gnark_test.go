@@ -0,0 +1,83 @@
+package dkim
+
+import (
+	"encoding/binary"
+	"math/big"
+	"testing"
+)
+
+func TestGnarkWitness(t *testing.T) {
+	w := testPartialWitness(t)
+	signature, combined, claims := testSignals(t, w)
+
+	b, err := MarshalGnarkWitness(combined)
+	if err != nil {
+		t.Fatalf("MarshalGnarkWitness() = %v", err)
+	}
+	// The gmailHash, headerHash and bodyHash inputs come first
+	if nbPublic := binary.BigEndian.Uint32(b); nbPublic != 6 {
+		t.Errorf("gnark witness has %v public elements, want 6", nbPublic)
+	}
+	decoded, err := UnmarshalGnarkWitness(b, Layout(combined))
+	if err != nil {
+		t.Fatalf("UnmarshalGnarkWitness() = %v", err)
+	}
+	if !signalsEqual(decoded, combined) {
+		t.Errorf("UnmarshalGnarkWitness() doesn't return the marshaled signals")
+	}
+
+	b, err = MarshalGnarkWitness(signature)
+	if err != nil {
+		t.Fatalf("MarshalGnarkWitness() = %v", err)
+	}
+	decodedSignature, err := UnmarshalGnarkWitness(b, Layout(signature))
+	if err != nil {
+		t.Fatalf("UnmarshalGnarkWitness() = %v", err)
+	}
+
+	got, err := WitnessFromSignals(decodedSignature, decoded, claims)
+	if err != nil {
+		t.Fatalf("WitnessFromSignals() = %v", err)
+	}
+	checkDecodedWitness(t, got, w)
+}
+
+func TestGnarkWitness_invalid(t *testing.T) {
+	signals := []Signal{
+		{Name: "a", Public: true, Scalar: true, Values: []*big.Int{big.NewInt(1)}},
+		{Name: "b", Values: []*big.Int{big.NewInt(2), big.NewInt(3)}},
+	}
+	if _, err := MarshalGnarkWitness([]Signal{{Name: "a", Scalar: true, Values: []*big.Int{BN254ScalarField}}}); err == nil {
+		t.Errorf("MarshalGnarkWitness() succeeded with a value outside of the field")
+	}
+	b, err := MarshalGnarkWitness(signals)
+	if err != nil {
+		t.Fatalf("MarshalGnarkWitness() = %v", err)
+	}
+	layout := Layout(signals)
+
+	outside := append([]byte(nil), b...)
+	BN254ScalarField.FillBytes(outside[len(outside)-bn254ElementSize:])
+	private := Layout(signals)
+	private[0].Public = false
+
+	tests := []struct {
+		name   string
+		b      []byte
+		layout []SignalLayout
+	}{
+		{"short", b[:8], layout},
+		{"truncated", b[:len(b)-1], layout},
+		{"outside-field", outside, layout},
+		{"public-mismatch", b, private},
+		{"length-mismatch", b, layout[:1]},
+		{"invalid-layout", b, []SignalLayout{{Name: "a", Public: true, Scalar: true, Len: 2}, layout[1]}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := UnmarshalGnarkWitness(tc.b, tc.layout); err == nil {
+				t.Errorf("UnmarshalGnarkWitness() succeeded")
+			}
+		})
+	}
+}
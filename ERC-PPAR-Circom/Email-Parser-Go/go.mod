@@ -2,7 +2,12 @@ module email-parser-go
 
 go 1.24.4
 
-require golang.org/x/crypto v0.39.0
+require (
+	github.com/fxamacker/cbor/v2 v2.7.0
+	github.com/miekg/dns v1.1.62
+	golang.org/x/crypto v0.39.0
+	golang.org/x/sync v0.8.0
+)
 
 require (
 	github.com/bits-and-blooms/bitset v1.14.2 // indirect
@@ -10,7 +15,6 @@ require (
 	github.com/consensys/bavard v0.1.13 // indirect
 	github.com/consensys/gnark v0.11.0 // indirect
 	github.com/consensys/gnark-crypto v0.14.0 // indirect
-	github.com/fxamacker/cbor/v2 v2.7.0 // indirect
 	github.com/google/pprof v0.0.0-20240727154555-813a5fbdbec8 // indirect
 	github.com/ingonyama-zk/icicle v1.1.0 // indirect
 	github.com/ingonyama-zk/iciclegnark v0.1.0 // indirect
@@ -22,7 +26,9 @@ require (
 	github.com/vocdoni/circom2gnark v1.0.0 // indirect
 	github.com/x448/float16 v0.8.4 // indirect
 	golang.org/x/exp v0.0.0-20240823005443-9b4947da3948 // indirect
-	golang.org/x/sync v0.8.0 // indirect
+	golang.org/x/mod v0.20.0 // indirect
+	golang.org/x/net v0.28.0 // indirect
 	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/tools v0.24.0 // indirect
 	rsc.io/tmplfunc v0.0.3 // indirect
 )
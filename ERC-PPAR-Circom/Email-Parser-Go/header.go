@@ -2,13 +2,12 @@ package dkim
 
 import (
 	"bufio"
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
-	"net/textproto"
 	"sort"
 	"strings"
+	"unicode/utf8"
 )
 
 const crlf = "\r\n"
@@ -16,26 +15,14 @@ const crlf = "\r\n"
 type header []string
 
 func readHeader(r *bufio.Reader) (header, error) {
-	tr := textproto.NewReader(r)
-
-	var h header
-	for {
-		l, err := tr.ReadLine()
-		if err != nil {
-			return h, fmt.Errorf("failed to read header: %v", err)
-		}
-
-		if len(l) == 0 {
-			break
-		} else if len(h) > 0 && (l[0] == ' ' || l[0] == '\t') {
-			// This is a continuation line
-			h[len(h)-1] += l + crlf
-		} else {
-			h = append(h, l+crlf)
-		}
+	raw, err := ReadRawHeader(r)
+	if err == nil && len(raw.Fields) == 0 && !raw.HasBody {
+		err = io.EOF
 	}
-
-	return h, nil
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %v", err)
+	}
+	return raw.header(), nil
 }
 
 func writeHeader(w io.Writer, h header) error {
@@ -48,19 +35,28 @@ func writeHeader(w io.Writer, h header) error {
 	return err
 }
 
+// foldHeaderField folds kv into lines of at most 75 bytes. Lines are never
+// split in the middle of a UTF-8 sequence, as allowed by RFC 6532 headers.
 func foldHeaderField(kv string) string {
-	buf := bytes.NewBufferString(kv)
+	const maxLen = 75 // 78 - len("\r\n\s")
 
-	line := make([]byte, 75) // 78 - len("\r\n\s")
-	first := true
 	var fold strings.Builder
-	for len, err := buf.Read(line); err != io.EOF; len, err = buf.Read(line) {
-		if first {
-			first = false
-		} else {
+	for first := true; first || kv != ""; first = false {
+		if !first {
 			fold.WriteString("\r\n ")
 		}
-		fold.Write(line[:len])
+		n := len(kv)
+		if n > maxLen {
+			n = maxLen
+			for n > 0 && !utf8.RuneStart(kv[n]) {
+				n--
+			}
+			if n == 0 {
+				n = maxLen
+			}
+		}
+		fold.WriteString(kv[:n])
+		kv = kv[n:]
 	}
 
 	return fold.String() + crlf
@@ -150,14 +146,14 @@ func newHeaderPicker(h header) *headerPicker {
 }
 
 func (p *headerPicker) Pick(key string) string {
-	key = strings.ToLower(key)
+	key = asciiToLower(key)
 
 	at := p.picked[key]
 	for i := len(p.h) - 1; i >= 0; i-- {
 		kv := p.h[i]
 		k, _ := parseHeaderField(kv)
 
-		if !strings.EqualFold(k, key) {
+		if !asciiEqualFold(k, key) {
 			continue
 		}
 
@@ -170,3 +166,27 @@ func (p *headerPicker) Pick(key string) string {
 
 	return ""
 }
+
+// asciiToLower lowercases the ASCII letters of s. Field names are ASCII, but
+// a malformed RFC 6532 header may contain UTF-8 ones: unlike strings.ToLower,
+// their bytes are left untouched, so that the signer and the verifier agree
+// whatever their Unicode tables.
+func asciiToLower(s string) string {
+	for i := 0; i < len(s); i++ {
+		if 'A' <= s[i] && s[i] <= 'Z' {
+			b := []byte(s)
+			for j := i; j < len(b); j++ {
+				if 'A' <= b[j] && b[j] <= 'Z' {
+					b[j] += 'a' - 'A'
+				}
+			}
+			return string(b)
+		}
+	}
+	return s
+}
+
+// asciiEqualFold reports whether a and b are equal under ASCII case folding.
+func asciiEqualFold(a, b string) bool {
+	return len(a) == len(b) && asciiToLower(a) == asciiToLower(b)
+}
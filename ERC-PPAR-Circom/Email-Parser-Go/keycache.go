@@ -0,0 +1,202 @@
+package dkim
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// KeyCacheOptions configures a KeyCache. All fields are optional.
+type KeyCacheOptions struct {
+	// TTL is how long a retrieved key is cached. Defaults to one hour.
+	TTL time.Duration
+	// NegativeTTL is how long a permanent failure, e.g. a missing or
+	// revoked key, is cached. Defaults to five minutes. Temporary failures
+	// are never cached.
+	NegativeTTL time.Duration
+	// MaxEntries is the maximum number of cached keys. The least recently
+	// used entries are evicted first. Defaults to 1000.
+	MaxEntries int
+	// Now returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+}
+
+// KeyCacheStats holds the counters of a KeyCache.
+type KeyCacheStats struct {
+	// Hits counts the queries answered from the cache, including failures.
+	Hits uint64
+	// NegativeHits counts the hits for cached failures.
+	NegativeHits uint64
+	// Misses counts the queries which needed a lookup.
+	Misses uint64
+	// Shared counts the misses which didn't trigger a lookup because an
+	// identical one was already in progress.
+	Shared uint64
+	// Evictions counts the entries evicted to respect MaxEntries.
+	Evictions uint64
+	// Entries is the current number of cached entries.
+	Entries int
+}
+
+// HitRate returns the ratio of queries answered from the cache, between 0
+// and 1.
+func (s KeyCacheStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// KeyCache caches the public keys retrieved when verifying signatures. It
+// also de-duplicates concurrent queries for the same key. A KeyCache is safe
+// for concurrent use, and can be shared by several VerifyOptions using the
+// same key source and TXT record policy.
+type KeyCache struct {
+	ttl, negativeTTL time.Duration
+	maxEntries       int
+	now              func() time.Time
+
+	group singleflight.Group
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // of *keyCacheEntry, most recently used first
+	stats   KeyCacheStats
+}
+
+type keyCacheEntry struct {
+	key     string
+	res     *queryResult
+	err     error
+	expires time.Time
+}
+
+type keyQueryResult struct {
+	res *queryResult
+	err error
+}
+
+// NewKeyCache creates a new key cache.
+func NewKeyCache(options *KeyCacheOptions) *KeyCache {
+	if options == nil {
+		options = new(KeyCacheOptions)
+	}
+	c := &KeyCache{
+		ttl:         options.TTL,
+		negativeTTL: options.NegativeTTL,
+		maxEntries:  options.MaxEntries,
+		now:         options.Now,
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+	}
+	if c.ttl == 0 {
+		c.ttl = time.Hour
+	}
+	if c.negativeTTL == 0 {
+		c.negativeTTL = 5 * time.Minute
+	}
+	if c.maxEntries <= 0 {
+		c.maxEntries = 1000
+	}
+	if c.now == nil {
+		c.now = time.Now
+	}
+	return c
+}
+
+// Stats returns the current counters of the cache.
+func (c *KeyCache) Stats() KeyCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
+
+// Purge removes all entries from the cache.
+func (c *KeyCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// query returns the cached result of a key query, or calls query and caches
+// its result.
+func (c *KeyCache) query(method QueryMethod, domain, selector string, query func() (*queryResult, error)) (*queryResult, error) {
+	key := string(method) + " " + strings.ToLower(KeyRecordName(domain, selector))
+
+	if res, err, ok := c.get(key); ok {
+		return res, err
+	}
+
+	leader := false
+	v, _, _ := c.group.Do(key, func() (interface{}, error) {
+		leader = true
+		res, err := query()
+		c.add(key, res, err)
+		return keyQueryResult{res, err}, nil
+	})
+	if !leader {
+		c.mu.Lock()
+		c.stats.Shared++
+		c.mu.Unlock()
+	}
+	qr := v.(keyQueryResult)
+	return qr.res, qr.err
+}
+
+func (c *KeyCache) get(key string) (*queryResult, error, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if ok {
+		entry := elem.Value.(*keyCacheEntry)
+		if c.now().Before(entry.expires) {
+			c.lru.MoveToFront(elem)
+			c.stats.Hits++
+			if entry.err != nil {
+				c.stats.NegativeHits++
+			}
+			return entry.res, entry.err, true
+		}
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+
+	c.stats.Misses++
+	return nil, nil, false
+}
+
+func (c *KeyCache) add(key string, res *queryResult, err error) {
+	ttl := c.ttl
+	if err != nil {
+		if !IsPermFail(err) {
+			return
+		}
+		ttl = c.negativeTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &keyCacheEntry{key: key, res: res, err: err, expires: c.now().Add(ttl)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+
+	for c.lru.Len() > c.maxEntries {
+		elem := c.lru.Back()
+		c.lru.Remove(elem)
+		delete(c.entries, elem.Value.(*keyCacheEntry).key)
+		c.stats.Evictions++
+	}
+}
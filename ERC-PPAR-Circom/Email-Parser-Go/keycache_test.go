@@ -0,0 +1,233 @@
+package dkim
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testKeyCache returns a cache whose clock can be advanced with the returned
+// function.
+func testKeyCache(options KeyCacheOptions) (*KeyCache, func(time.Duration)) {
+	now := testTime
+	var mu sync.Mutex
+	options.Now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		now = now.Add(d)
+	}
+	return NewKeyCache(&options), advance
+}
+
+// countingQuery returns a query function returning res and err, and a
+// function returning how many times it was called.
+func countingQuery(res *queryResult, err error) (func() (*queryResult, error), func() int) {
+	var mu sync.Mutex
+	n := 0
+	query := func() (*queryResult, error) {
+		mu.Lock()
+		n++
+		mu.Unlock()
+		return res, err
+	}
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return n
+	}
+	return query, count
+}
+
+func TestKeyCache_ttl(t *testing.T) {
+	c, advance := testKeyCache(KeyCacheOptions{TTL: time.Minute})
+	want := &queryResult{KeyAlgo: "rsa"}
+	query, count := countingQuery(want, nil)
+
+	for i := 0; i < 3; i++ {
+		res, err := c.query(QueryMethodDNSTXT, testDomain, testSelector, query)
+		if err != nil || res != want {
+			t.Fatalf("query() = %v, %v, want %v, <nil>", res, err, want)
+		}
+	}
+	if n := count(); n != 1 {
+		t.Errorf("lookups before expiry = %v, want 1", n)
+	}
+
+	// Names are case-insensitive
+	if _, err := c.query(QueryMethodDNSTXT, "EXAMPLE.org", "Test", query); err != nil {
+		t.Fatalf("query() = %v", err)
+	}
+	if n := count(); n != 1 {
+		t.Errorf("lookups with a differently cased name = %v, want 1", n)
+	}
+
+	advance(time.Minute)
+	if _, err := c.query(QueryMethodDNSTXT, testDomain, testSelector, query); err != nil {
+		t.Fatalf("query() = %v", err)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("lookups after expiry = %v, want 2", n)
+	}
+
+	stats := c.Stats()
+	wantStats := KeyCacheStats{Hits: 3, Misses: 2, Entries: 1}
+	if stats != wantStats {
+		t.Errorf("Stats() = %+v, want %+v", stats, wantStats)
+	}
+	if rate := stats.HitRate(); rate != 0.6 {
+		t.Errorf("HitRate() = %v, want 0.6", rate)
+	}
+}
+
+func TestKeyCache_failures(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		cached bool
+	}{
+		{"permfail", permFailError("no key for signature"), true},
+		{"tempfail", tempFailError("key unavailable"), false},
+		{"other", errors.New("dkim: unexpected failure"), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, advance := testKeyCache(KeyCacheOptions{NegativeTTL: time.Minute})
+			query, count := countingQuery(nil, tc.err)
+
+			for i := 0; i < 2; i++ {
+				if _, err := c.query(QueryMethodDNSTXT, testDomain, testSelector, query); err != tc.err {
+					t.Fatalf("query() = %v, want %v", err, tc.err)
+				}
+			}
+			wantLookups := 2
+			if tc.cached {
+				wantLookups = 1
+			}
+			if n := count(); n != wantLookups {
+				t.Errorf("lookups = %v, want %v", n, wantLookups)
+			}
+
+			var wantNegative uint64
+			if tc.cached {
+				wantNegative = 1
+			}
+			if stats := c.Stats(); stats.NegativeHits != wantNegative {
+				t.Errorf("Stats().NegativeHits = %v, want %v", stats.NegativeHits, wantNegative)
+			}
+
+			advance(time.Minute)
+			c.query(QueryMethodDNSTXT, testDomain, testSelector, query)
+			if n := count(); n != wantLookups+1 {
+				t.Errorf("lookups after the negative TTL = %v, want %v", n, wantLookups+1)
+			}
+		})
+	}
+}
+
+func TestKeyCache_eviction(t *testing.T) {
+	c, _ := testKeyCache(KeyCacheOptions{MaxEntries: 2})
+	query, count := countingQuery(&queryResult{KeyAlgo: "rsa"}, nil)
+
+	c.query(QueryMethodDNSTXT, "a.example", testSelector, query)
+	c.query(QueryMethodDNSTXT, "b.example", testSelector, query)
+	// Make a.example the most recently used entry, so that b.example is
+	// evicted when c.example is added
+	c.query(QueryMethodDNSTXT, "a.example", testSelector, query)
+	c.query(QueryMethodDNSTXT, "c.example", testSelector, query)
+	if n := count(); n != 3 {
+		t.Fatalf("lookups = %v, want 3", n)
+	}
+
+	c.query(QueryMethodDNSTXT, "a.example", testSelector, query)
+	if n := count(); n != 3 {
+		t.Errorf("lookups for the most recently used entry = %v, want 3", n)
+	}
+	c.query(QueryMethodDNSTXT, "b.example", testSelector, query)
+	if n := count(); n != 4 {
+		t.Errorf("lookups for the evicted entry = %v, want 4", n)
+	}
+
+	stats := c.Stats()
+	if stats.Evictions != 2 || stats.Entries != 2 {
+		t.Errorf("Stats() = %+v, want 2 evictions and 2 entries", stats)
+	}
+
+	c.Purge()
+	if stats := c.Stats(); stats.Entries != 0 {
+		t.Errorf("Stats().Entries after Purge() = %v, want 0", stats.Entries)
+	}
+	c.query(QueryMethodDNSTXT, "a.example", testSelector, query)
+	if n := count(); n != 5 {
+		t.Errorf("lookups after Purge() = %v, want 5", n)
+	}
+}
+
+func TestKeyCache_concurrent(t *testing.T) {
+	c, _ := testKeyCache(KeyCacheOptions{})
+	want := &queryResult{KeyAlgo: "rsa"}
+	release := make(chan struct{})
+	query, count := countingQuery(want, nil)
+	blockingQuery := func() (*queryResult, error) {
+		<-release
+		return query()
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make([]*queryResult, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = c.query(QueryMethodDNSTXT, testDomain, testSelector, blockingQuery)
+		}(i)
+	}
+	close(release)
+	wg.Wait()
+
+	for i, res := range results {
+		if res != want {
+			t.Errorf("query() #%v = %v, want %v", i, res, want)
+		}
+	}
+	// Each query was either answered from the cache, shared with a
+	// concurrent lookup, or triggered a lookup itself
+	stats := c.Stats()
+	if got := stats.Hits + stats.Shared + uint64(count()); got != n {
+		t.Errorf("hits + shared + lookups = %v, want %v (%+v)", got, n, stats)
+	}
+	if stats.Hits+stats.Misses != n {
+		t.Errorf("hits + misses = %v, want %v", stats.Hits+stats.Misses, n)
+	}
+}
+
+func TestVerify_keyCache(t *testing.T) {
+	signed := testSign(t, testMessage, nil)
+	lookup := testLookupTXT(t, testRSAKey.Public())
+	lookups := 0
+	options := &VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			lookups++
+			return lookup(domain)
+		},
+		KeyCache: NewKeyCache(nil),
+	}
+
+	for i := 0; i < 3; i++ {
+		if verif := testVerify(t, signed, options); verif.Err != nil {
+			t.Fatalf("signature didn't verify: %v", verif.Err)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("lookups = %v, want 1", lookups)
+	}
+	if stats := options.KeyCache.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Stats() = %+v, want 2 hits and 1 miss", stats)
+	}
+}
@@ -0,0 +1,51 @@
+package dkim
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// FormatKeyRecord formats the DNS TXT record publishing a public key, as
+// described in RFC 6376 section 3.6.1. RSA keys are encoded as
+// SubjectPublicKeyInfo.
+//
+// Supported keys are *rsa.PublicKey and ed25519.PublicKey.
+func FormatKeyRecord(pub crypto.PublicKey) (string, error) {
+	var keyAlgo string
+	var b []byte
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		keyAlgo = "rsa"
+		var err error
+		b, err = x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return "", err
+		}
+	case ed25519.PublicKey:
+		keyAlgo = "ed25519"
+		b = pub
+	default:
+		return "", fmt.Errorf("dkim: unsupported key algorithm %T", pub)
+	}
+
+	return "v=DKIM1; k=" + keyAlgo + "; p=" + base64.StdEncoding.EncodeToString(b), nil
+}
+
+// FormatPKCS1KeyRecord formats the DNS TXT record publishing an RSA public
+// key encoded as RSAPublicKey (PKCS #1), the other form accepted by
+// verifiers (see RFC 6376 erratum 3017).
+func FormatPKCS1KeyRecord(pub *rsa.PublicKey) string {
+	b := x509.MarshalPKCS1PublicKey(pub)
+	return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(b)
+}
+
+// KeyRecordName returns the DNS name of the TXT record holding the key of a
+// selector.
+func KeyRecordName(domain, selector string) string {
+	return selector + "._domainkey." + domain
+}
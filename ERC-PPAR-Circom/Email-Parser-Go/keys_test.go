@@ -0,0 +1,57 @@
+package dkim
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestFormatKeyRecord(t *testing.T) {
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() = %v", err)
+	}
+	rsaPub := testRSAKey.Public().(*rsa.PublicKey)
+	spki, err := FormatKeyRecord(rsaPub)
+	if err != nil {
+		t.Fatalf("FormatKeyRecord() = %v", err)
+	}
+	ed, err := FormatKeyRecord(edPub)
+	if err != nil {
+		t.Fatalf("FormatKeyRecord() = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		record string
+		algo   string
+		size   int
+	}{
+		{"rsa", spki, "rsa", 2048},
+		{"rsa pkcs1", FormatPKCS1KeyRecord(rsaPub), "rsa", 2048},
+		{"ed25519", ed, "ed25519", 256},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := parsePublicKey(tc.record)
+			if err != nil {
+				t.Fatalf("parsePublicKey(%q) = %v", tc.record, err)
+			}
+			if res.KeyAlgo != tc.algo || res.KeySize() != tc.size {
+				t.Errorf("parsed %v key of %v bits, want %v key of %v bits", res.KeyAlgo, res.KeySize(), tc.algo, tc.size)
+			}
+		})
+	}
+
+	if _, err := FormatKeyRecord("not a key"); err == nil {
+		t.Error("FormatKeyRecord() = nil with an unsupported key")
+	}
+}
+
+func TestKeyRecordName(t *testing.T) {
+	if got, want := KeyRecordName("example.org", "sel"), "sel._domainkey.example.org"; got != want {
+		t.Errorf("KeyRecordName() = %q, want %q", got, want)
+	}
+}
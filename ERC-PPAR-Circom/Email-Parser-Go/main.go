@@ -19,290 +19,418 @@ package dkim
 /*----------------------------------------------------------------------------------------*/
 
 	import (
+		"bufio"
+		"bytes"
 		"crypto"
 		"crypto/rsa"
-		"math/big"
-		"fmt"
-		"strings"
-
 		"crypto/subtle"
-		
-
-		"bufio"
-		"io"
 		"encoding/json"
+		"fmt"
+		"io"
+		"math/big"
 		"os"
-		"bytes"
+		"strings"
+		"time"
 	)
 	
 	
 	
 	// --- Test Data Setup ---
 	var (
-		Email = func() string {
-			data, err := os.ReadFile("../Example/Raw-Email.tx")
-			if err != nil {
-				panic(fmt.Sprintf("Failed to read ../Example/Raw-Email.tx: %v", err))
-			}
-			return string(data)
-		}()
-		
+		EmailPath = "../Example/Raw-Email.tx"
+		SignatureInputPath = "../input-files/signature-input.json"
+		CombinedInputPath = "../input-files/combined-input.json"
+		ClaimsInputPath = "../input-files/claims.json"
 	)
-	
+
+	// WitnessOptions allows to customize the witness generation.
+	type WitnessOptions struct {
+		// LookupTXT returns the DNS TXT records for the given domain name. If nil,
+		// net.LookupTXT is used.
+		LookupTXT func(domain string) ([]string, error)
+		// LookupTXTStrings and TXTRecordPolicy configure the key lookup, see
+		// VerifyOptions.
+		LookupTXTStrings func(domain string) ([][]string, error)
+		TXTRecordPolicy TXTRecordPolicy
+		// KeyCache caches the retrieved keys, see VerifyOptions.
+		KeyCache *KeyCache
+		// If DNSSEC is set, the key is retrieved with its DNSSEC chain of
+		// trust, which is included in the witness. LookupTXT,
+		// LookupTXTStrings and KeyCache are ignored.
+		DNSSEC *DNSSECResolver
+		// MaxBodySize is the maximum size of the message body in bytes, both
+		// as read and once canonicalized. Larger messages are rejected with
+		// ErrBodyTooLarge before they are fully read. If zero, there is no
+		// maximum.
+		MaxBodySize int64
+
+		// BodyReveals lists the parts of the canonicalized body to disclose.
+		BodyReveals []*RevealSpec
+		// RejectTestingKeys rejects keys whose record has the "y" flag, i.e.
+		// domains testing DKIM.
+		RejectTestingKeys bool
+		// Freshness restricts the signature time, see VerifyOptions.
+		Freshness *FreshnessPolicy
+		// Now returns the reference time for Freshness. If nil, the current
+		// time is used.
+		Now func() time.Time
+		// AllowBodyLength accepts signatures with a body length tag. The
+		// witness then only contains the signed prefix of the body.
+		AllowBodyLength bool
+		// If DecodeMIME is set, BodyReveals are matched against the decoded
+		// content of the first text/plain MIME part instead of the raw body.
+		DecodeMIME bool
+		// SignatureIndex selects the signature the witness is built for, by
+		// position in the header. The first one is used by default.
+		SignatureIndex int
+	}
+
+	// A Witness holds the circuit inputs extracted from a signed email.
+	type Witness struct {
+		Domain string
+		Selector string
+		// Testing is true if the key record has the "y" flag.
+		Testing bool
+		// The position of the signature in the header, see
+		// WitnessOptions.SignatureIndex.
+		SignatureIndex int
+		HeaderCanonicalization Canonicalization
+		BodyCanonicalization Canonicalization
+
+		// The canonicalized signed header fields, as hashed by the signer.
+		Header []byte
+		HeaderHash []byte
+		// The signature time, from its "t" tag, and the position of the tag
+		// value in Header. If the signature has no time, Time is zero.
+		Time time.Time
+		TimeRange RevealRange
+		// The canonicalized body. If Partial is set, only the first
+		// BodyLength bytes covered by the signature are included.
+		Body []byte
+		BodyHash []byte
+		Partial bool
+		BodyLength int64
+
+		Signature *big.Int
+		Modulus *big.Int
+		Exponent *big.Int
+
+		// The address found in the signed From header field.
+		Gmail []byte
+		// The disclosed parts of Body, one per WitnessOptions.BodyReveals entry.
+		BodyReveals []*Reveal
+		// The DNSSEC proof of the key record, if WitnessOptions.DNSSEC is set.
+		KeyProof *DNSSECProof
+	}
+
 	func EmailSignatureVerification() {
-		sigArray := new(big.Int)
-		googlePubKeyN := new(big.Int)
-		googlePubKeyE := new(big.Int)
+		data, err := os.ReadFile(EmailPath)
+		if err != nil {
+			fmt.Println("Error reading email:", err)
+			return
+		}
 
-		headerHelper := []byte{}
-		headerHash := []byte{}
-		body := []byte{}
-		bodyHashed := []byte{}
+		w, err := BuildWitness(bytes.NewReader(data), nil)
+		if err != nil {
+			fmt.Println("Error building witness:", err)
+			return
+		}
 
+		if err := writeJSON(SignatureInputPath, w.SignatureInput()); err != nil {
+			fmt.Println("Error writing JSON to file:", err)
+		}
+		if err := writeJSON(CombinedInputPath, w.CombinedInput()); err != nil {
+			fmt.Println("Error writing JSON to file:", err)
+		}
+		if err := writeJSON(ClaimsInputPath, w.ClaimsInput()); err != nil {
+			fmt.Println("Error writing JSON to file:", err)
+		}
+	}
 
-		r := strings.NewReader(Email)
+	// BuildWitness parses a raw email and extracts the circuit inputs of one of
+	// its DKIM signatures, the first one unless WitnessOptions.SignatureIndex
+	// is set.
+	//
+	// The body hash is checked, but the signature itself is not verified.
+	func BuildWitness(r io.Reader, options *WitnessOptions) (*Witness, error) {
+		if options == nil {
+			options = new(WitnessOptions)
+		}
 
 		bufr := bufio.NewReader(r)
-		h, _ := readHeader(bufr)
-		
-	
+		h, err := readHeader(bufr)
+		if err != nil {
+			return nil, err
+		}
 
 		var signatures []*signature
 		for i, kv := range h {
 			k, v := parseHeaderField(kv)
-			if strings.EqualFold(k, headerFieldName) {
+			if asciiEqualFold(k, headerFieldName) {
 				signatures = append(signatures, &signature{i, v})
 			}
 		}
+		if len(signatures) == 0 {
+			return nil, permFailError("no signature found")
+		}
 
-		if len(signatures) == 1 {
-			// If there is only one signature - just verify it.
-			sigValue := signatures[0].v
-			sigField := h[signatures[0].i]
-			
-			params, err := parseHeaderParams(sigValue)
+		if options.SignatureIndex < 0 || options.SignatureIndex >= len(signatures) {
+			return nil, fmt.Errorf("dkim: no signature at index %v, the message has %v", options.SignatureIndex, len(signatures))
+		}
+		sigValue := signatures[options.SignatureIndex].v
+		sigField := h[signatures[options.SignatureIndex].i]
+		
+		params, err := parseHeaderParams(sigValue)
+		if err != nil {
+			return nil, permFailError("malformed signature tags: " + err.Error())
+		}
 
-			domain := params["d"]
-			selector := params["s"]
+		if params["v"] != "1" {
+			return nil, permFailError("incompatible signature version")
+		}
+		for _, tag := range requiredTags {
+			if _, ok := params[tag]; !ok {
+				return nil, permFailError("signature missing required tag")
+			}
+		}
 
+		w := &Witness{
+			Domain: stripWhitespace(params["d"]),
+			Selector: stripWhitespace(params["s"]),
+			SignatureIndex: options.SignatureIndex,
+		}
 
+		if timeStr, ok := params["t"]; ok {
+			w.Time, err = parseTime(timeStr)
 			if err != nil {
-				return 
+				return nil, permFailError("malformed time: " + err.Error())
 			}
-
-		
-			if params["v"] != "1" {
-				return 
+		}
+		if options.Freshness != nil {
+			if err := options.Freshness.check(w.Time, options.verifyOptions().currentTime()); err != nil {
+				return nil, err
 			}
+		}
 		
-		
-			headerKeys := parseTagList(params["h"])
-			ok := false
-			for _, k := range headerKeys {
-				if strings.EqualFold(k, "from") {
-					ok = true
-					break
-				}
-			}
-			
-			if !ok {
-				return 
+		headerKeys := parseTagList(params["h"])
+		ok := false
+		for _, k := range headerKeys {
+			if asciiEqualFold(k, "from") {
+				ok = true
+				break
 			}
+		}
 		
-			// Query public key
-			methods := []string{string(QueryMethodDNSTXT)}
-			if methodsStr, ok := params["q"]; ok {
-				methods = parseTagList(methodsStr)
-			}
-			var res *queryResult
-			for _, method := range methods {
-				if query, ok := queryMethods[QueryMethod(method)]; ok {
-					res, err = query(domain, stripWhitespace(selector), nil)
-					break
-				}
-			}
-			verif := res.Verifier.Public().(*rsa.PublicKey)
-			googlePubKeyN = verif.N
-			googlePubKeyE = big.NewInt(int64(verif.E))
-
-			
-			
-
+		if !ok {
+			return nil, permFailError("From field not signed")
+		}
 		
-			// Parse algos
-			keyAlgo, hashAlgo, ok := strings.Cut(stripWhitespace(params["a"]), "-")
-			if !ok {
-				return //verif, permFailError("malformed algorithm name")
-			}
-			
-			// Check hash algo
-			if res.HashAlgos != nil {
-				ok := false
-				for _, algo := range res.HashAlgos {
-					if algo == hashAlgo {
-						ok = true
-						break
-					}
-				}
-				if !ok {
-					return //verif, permFailError("inappropriate hash algorithm")
-				}
-			}
-			var hash crypto.Hash
-			switch hashAlgo {
-			case "sha1":
-				// RFC 8301 section 3.1: rsa-sha1 MUST NOT be used for signing or
-				// verifying.
-				return //verif, permFailError("hash algorithm too weak")
-			case "sha256":
-				hash = crypto.SHA256
-			default:
-				return //verif, permFailError("unsupported hash algorithm")
+		// Query public key
+		keyOptions := options.verifyOptions()
+		if options.DNSSEC != nil {
+			keyOptions.KeyCache = nil
+			keyOptions.LookupTXTStrings = func(name string) ([][]string, error) {
+				records, proof, err := options.DNSSEC.lookup(name)
+				w.KeyProof = proof
+				return records, err
 			}
+		}
+		res, hash, err := queryKey(w.Domain, params, keyOptions)
+		if err != nil {
+			return nil, err
+		}
+		identifier := "@" + w.Domain
+		if i, ok := params["i"]; ok {
+			identifier = stripWhitespace(i)
+		}
+		if err := checkKeyFlags(res, w.Domain, identifier); err != nil {
+			return nil, err
+		}
+		w.Testing = res.Testing()
+		if w.Testing && options.RejectTestingKeys {
+			return nil, errTestingKey
+		}
 
-			// Check key algo
-			if res.KeyAlgo != keyAlgo {
-				return //verif, permFailError("inappropriate key algorithm")
-			}
+		// The circuits only support RSA signatures.
+		pub, ok := res.Verifier.Public().(*rsa.PublicKey)
+		if !ok {
+			return nil, permFailError("unsupported key algorithm for witness")
+		}
+		w.Modulus = pub.N
+		w.Exponent = big.NewInt(int64(pub.E))
 		
-			if res.Services != nil {
-				ok := false
-				for _, s := range res.Services {
-					if s == "email" {
-						ok = true
-						break
-					}
-				}
-				if !ok {
-					return //verif, permFailError("inappropriate service")
-				}
-			}
+		headerCan, bodyCan := parseCanonicalization(params["c"])
+		w.HeaderCanonicalization, w.BodyCanonicalization = headerCan, bodyCan
 		
-			headerCan, bodyCan := parseCanonicalization(params["c"])
-			
-			if _, ok := canonicalizers[headerCan]; !ok {
-				return //verif, permFailError("unsupported header canonicalization algorithm")
-			}
-			if _, ok := canonicalizers[bodyCan]; !ok {
-				return //verif, permFailError("unsupported body canonicalization algorithm")
-			}
+		headerCanonicalizer, ok := lookupCanonicalizer(headerCan)
+		if !ok {
+			return nil, permFailError("unsupported header canonicalization algorithm")
+		}
+		bodyCanonicalizer, ok := lookupCanonicalizer(bodyCan)
+		if !ok {
+			return nil, permFailError("unsupported body canonicalization algorithm")
+		}
 		
-			// The body length "l" parameter is insecure, because it allows parts of
-			// the message body to not be signed. Reject messages which have it set.
-			if _, ok := params["l"]; ok {
-				// TODO: technically should be policyError
-				return //verif, failError("message contains an insecure body length tag")
-			}
+		bodyLength, err := parseBodyLength(params, options.AllowBodyLength)
+		if err != nil {
+			return nil, err
+		}
+		if bodyLength >= 0 {
+			w.Partial = true
+			w.BodyLength = bodyLength
+		}
 		
-			// Parse body hash and signature
-			bodyHashed, err = decodeBase64String(params["bh"])
+		// Parse body hash and signature
+		w.BodyHash, err = decodeBase64String(params["bh"])
+		if err != nil {
+			return nil, permFailError("malformed body hash: " + err.Error())
+		}
+		sig, err := decodeBase64String(params["b"])
+		if err != nil {
+			return nil, permFailError("malformed signature: " + err.Error())
+		}
+		w.Signature = new(big.Int).SetBytes(sig)
+
+		// Check body hash, keeping the canonicalized body for the circuit
+		hasher := hash.New()
+		capture := &bodyCapture{Max: options.MaxBodySize}
+		body := newBodyReader(bufr, options.MaxBodySize)
+		bodyWriter, lw := limitBodyWriter(io.MultiWriter(hasher, capture), bodyLength)
+		if err := canonicalizeBody(bodyWriter, body, bodyCanonicalizer); err != nil {
+			return nil, err
+		}
+		if lw != nil && lw.N > 0 {
+			return nil, failError("body is shorter than the body length tag")
+		}
+		
+		if subtle.ConstantTimeCompare(hasher.Sum(nil), w.BodyHash) != 1 {
+			return nil, failError("body hash did not verify")
+		}
 
-			if err != nil {
-				return //verif, permFailError("malformed body hash: " + err.Error())
-			}
-			sig, err := decodeBase64String(params["b"])
-			sigArray = new(big.Int).SetBytes(sig)
-			if err != nil {
-				return //verif, permFailError("malformed signature: " + err.Error())
+		w.Body = capture.Bytes()
+		
+		// Compute data hash
+		hasher.Reset()
+		
+		picker := newHeaderPicker(h)
+		for _, key := range headerKeys {
+			kv := picker.Pick(key)
+			if kv == "" {
+				// The field MAY contain names of header fields that do not exist
+				// when signed; nonexistent header fields do not contribute to the
+				// signature computation
+				continue
 			}
+			kv = headerCanonicalizer.CanonicalizeHeader(kv)
 
-			// Check body hash
-			var canonBodyBuf bytes.Buffer
-			hasher := hash.New()
-			multiWriter := io.MultiWriter(hasher, &canonBodyBuf)
-			wc := canonicalizers[bodyCan].CanonicalizeBody(multiWriter)
-			
-			if _, err := io.Copy(wc, bufr); err != nil {
-				return //verif, err
-			}
+			w.Header = append(w.Header, kv...)
 
-			
-			if err := wc.Close(); err != nil {
-				return //verif, err
+			if _, err := hasher.Write([]byte(kv)); err != nil {
+				return nil, err
 			}
-			
-			if subtle.ConstantTimeCompare(hasher.Sum(nil), bodyHashed) != 1 {
-				return 
+		}
+		canSigField := removeSignature(sigField)
+		canSigField = headerCanonicalizer.CanonicalizeHeader(canSigField)
+		canSigField = strings.TrimRight(canSigField, "\r\n")
+		if !w.Time.IsZero() {
+			r, ok := findTimeTag(canSigField)
+			if !ok {
+				return nil, permFailError("time tag not found in the signature field")
 			}
+			if t, err := parseTime(canSigField[r.Start:r.End]); err != nil || !t.Equal(w.Time) {
+				return nil, permFailError("time tag range doesn't match the signature time")
+			}
+			w.TimeRange = RevealRange{len(w.Header) + r.Start, len(w.Header) + r.End}
+		}
+		w.Header = append(w.Header, canSigField...)
+		if _, err := hasher.Write([]byte(canSigField)); err != nil {
+			return nil, err
+		}
+		w.HeaderHash = hasher.Sum(nil)
 
-			body = canonBodyBuf.Bytes()
+		from, err := FindFromAddress(w.Header)
+		if err != nil {
+			return nil, err
+		}
+		w.Gmail = from.Value
 
-		
-			// Compute data hash
-			hasher.Reset()
-			
+		var text *BodyPart
+		if options.DecodeMIME && len(options.BodyReveals) > 0 {
 			picker := newHeaderPicker(h)
-			for _, key := range headerKeys {
-				kv := picker.Pick(key)
-				if kv == "" {
-					// The field MAY contain names of header fields that do not exist
-					// when signed; nonexistent header fields do not contribute to the
-					// signature computation
-					continue
-				}
-				kv = canonicalizers[headerCan].CanonicalizeHeader(kv)
-
-				headerHelper = append(headerHelper, kv...)
+			contentType := unfoldHeaderValue(picker.Pick("Content-Type"))
+			encoding := unfoldHeaderValue(picker.Pick("Content-Transfer-Encoding"))
+			parts, err := ParseBodyParts(contentType, encoding, w.Body)
+			if err != nil {
+				return nil, err
+			}
+			if text = TextPart(parts); text == nil {
+				return nil, fmt.Errorf("dkim: no text/plain part in body")
+			}
+		}
 
-				if _, err := hasher.Write([]byte(kv)); err != nil {
-					return //verif, err
+		names := make(map[string]bool)
+		for _, spec := range options.BodyReveals {
+			if spec != nil {
+				if names[spec.Name] {
+					return nil, fmt.Errorf("dkim: duplicate reveal %q", spec.Name)
 				}
+				names[spec.Name] = true
 			}
-			canSigField := removeSignature(sigField)
-			canSigField = canonicalizers[headerCan].CanonicalizeHeader(canSigField)
-			canSigField = strings.TrimRight(canSigField, "\r\n")
-			headerHelper = append(headerHelper, canSigField...)
-			if _, err := hasher.Write([]byte(canSigField)); err != nil {
-				return //verif, err
+			var reveal *Reveal
+			if text != nil {
+				reveal, err = text.Reveal(w.Body, spec)
+			} else {
+				reveal, err = FindReveal(w.Body, spec)
 			}
-			hashed := hasher.Sum(nil) 
-			headerHash = hashed
-
-			
+			if err != nil {
+				return nil, err
+			}
+			if err := reveal.Check(w.Body); err != nil {
+				return nil, err
+			}
+			w.BodyReveals = append(w.BodyReveals, reveal)
 		}
 
-		headerHelperStr := ByteToString(headerHelper)
-		
-		
+		return w, nil
+	}
 
-		// Params for signature verify
-		jsonHeaderHash := BigIntToArray(64, 4, new(big.Int).SetBytes(headerHash))
-		jsonSig := BigIntToArray(64, 32, sigArray)
-		jsonKeyN := BigIntToArray(64, 32, googlePubKeyN)
-		jsonKeyE := BigIntToArray(64, 32, googlePubKeyE)
-		
+	func (options *WitnessOptions) verifyOptions() *VerifyOptions {
+		return &VerifyOptions{
+			LookupTXT: options.LookupTXT,
+			LookupTXTStrings: options.LookupTXTStrings,
+			TXTRecordPolicy: options.TXTRecordPolicy,
+			KeyCache: options.KeyCache,
+			RejectTestingKeys: options.RejectTestingKeys,
+			Freshness: options.Freshness,
+			Now: options.Now,
+		}
+	}
 
+	// SignatureInput returns the inputs of the rsa_verify circuit.
+	func (w *Witness) SignatureInput() map[string]interface{} {
+		jsonHeaderHash := BigIntToArray(64, 4, new(big.Int).SetBytes(w.HeaderHash))
+		jsonSig := BigIntToArray(64, 32, w.Signature)
+		jsonKeyN := BigIntToArray(64, 32, w.Modulus)
+		jsonKeyE := BigIntToArray(64, 32, w.Exponent)
 
-		jsonObjSig := map[string]interface{}{
+		return map[string]interface{}{
 			"hashed": BigToString(jsonHeaderHash),
 			"sign" : BigToString(jsonSig),
 			"exp" : BigToString(jsonKeyE),
 			"modulus": BigToString(jsonKeyN),
 		}
-		jsonBytesSig, err := json.MarshalIndent(jsonObjSig, "", "  ")
-		if err != nil {
-			t.Log("Error marshaling JSON:", err)
-		} else {
-			// t.Log(string(jsonBytes))
-			err := os.WriteFile("../input-files/signature-input.json", jsonBytesSig, 0644)
-			if err != nil {
-				t.Log("Error writing JSON to file:", err)
-		}
-		}
-
-
+	}
 
-		// Params for gmail-hash-verify
-		gmail := contains(headerHelper, []byte("from:")[0])
-		highIntHash, lowIntHash := prepareHashInput([]byte(gmail))
-		headerHashHigh := new(big.Int).SetBytes(headerHash[0:16])
-		headerHashLow := new(big.Int).SetBytes(headerHash[16:32])
-		bhHigh := new(big.Int).SetBytes(bodyHashed[0:16])
-		bhLow := new(big.Int).SetBytes(bodyHashed[16:32])
-		bodyHelperStr := ByteToString(body)
+	// CombinedInput returns the inputs of the combined circuit.
+	func (w *Witness) CombinedInput() map[string]interface{} {
+		highIntHash, lowIntHash := prepareHashInput(w.Gmail)
+		headerHashHigh := new(big.Int).SetBytes(w.HeaderHash[0:16])
+		headerHashLow := new(big.Int).SetBytes(w.HeaderHash[16:32])
+		bhHigh := new(big.Int).SetBytes(w.BodyHash[0:16])
+		bhLow := new(big.Int).SetBytes(w.BodyHash[16:32])
 
 		jsonObj := map[string]interface{}{
-			"header": headerHelperStr,
+			"header": ByteToString(w.Header),
 			"gmailHash": []string{
 				highIntHash.String(),
 				lowIntHash.String(),
@@ -311,27 +439,64 @@ package dkim
 				headerHashHigh.String(),
 				headerHashLow.String(),
 			},
-			"body": bodyHelperStr,
+			"body": ByteToString(w.Body),
 			"bodyHash": []string{
 				bhHigh.String(),
 				bhLow.String(),
 			},
 		}
-		jsonBytes, err := json.MarshalIndent(jsonObj, "", "  ")
-		if err != nil {
-			t.Log("Error marshaling JSON:", err)
-		} else {
-			// t.Log(string(jsonBytes))
-			err := os.WriteFile("../input-files/combined-input.json", jsonBytes, 0644)
-			if err != nil {
-				t.Log("Error writing JSON to file:", err)
+
+		return jsonObj
+	}
+
+	// ClaimsInput returns the values disclosed about the email besides the
+	// inputs of the circuits, in the same form: the signature time, the body
+	// length and the body reveals. The combined circuit doesn't
+	// declare them, so they are kept apart from CombinedInput: they are
+	// checked against the header and body of the inputs by AuditSignals, but
+	// the proof doesn't bind them.
+	func (w *Witness) ClaimsInput() map[string]interface{} {
+		jsonObj := map[string]interface{}{}
+
+		// The signature time and the offsets of its tag value in Header, so
+		// that the freshness of the signature can be checked without the
+		// email.
+		if !w.Time.IsZero() {
+			jsonObj["signatureTime"] = fmt.Sprintf("%v", w.Time.Unix())
+			jsonObj["signatureTimeStart"] = fmt.Sprintf("%v", w.TimeRange.Start)
+			jsonObj["signatureTimeEnd"] = fmt.Sprintf("%v", w.TimeRange.End)
 		}
+
+		// With a body length tag, only a prefix of the body is signed, and
+		// the combined circuit only hashes that prefix: the proof doesn't
+		// tell such messages apart, the claims do.
+		if w.Partial {
+			jsonObj["bodyLength"] = fmt.Sprintf("%v", w.BodyLength)
 		}
 
-		
-		
-		
+		// Each body reveal adds its mask and the offsets of its ranges, e.g.
+		// "codeMask", "codeStart" and "codeEnd" for a reveal named "code".
+		for _, reveal := range w.BodyReveals {
+			var starts, ends []string
+			for _, r := range reveal.Ranges {
+				starts = append(starts, fmt.Sprintf("%v", r.Start))
+				ends = append(ends, fmt.Sprintf("%v", r.End))
+			}
+			mask, start, end := revealSignalNames(reveal.Name)
+			jsonObj[mask] = ByteToString(reveal.Mask)
+			jsonObj[start] = starts
+			jsonObj[end] = ends
+		}
+
+		return jsonObj
+	}
 
+	func writeJSON(path string, v interface{}) error {
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, b, 0644)
 	}
 
 	func bytesToBits(bytes []byte) []int {
@@ -356,35 +521,6 @@ package dkim
 		return bits
 	}
 
-	func contains(slice []byte, item byte) []byte {
-		index := -1
-		for i, v := range slice {
-			if v == item {
-				index = i
-				break
-			}
-		}
-		fromIndex := -1
-		toIndex := -1
-		if index != -1 {
-			for i := index; i < len(slice); i++ {
-				if slice[i] == []byte("<")[0] {
-					fromIndex = i+1
-					continue
-				}
-				if slice[i] == []byte(">")[0] {
-					toIndex = i
-					break
-				}
-			}
-		}
-		if fromIndex != -1 && toIndex != -1 {
-			gmail := slice[fromIndex:toIndex]
-			return gmail
-		}
-		return []byte{}
-	}
-
 	func prepareHashInput(message []byte) (*big.Int, *big.Int) {
 		paddedMessage := make([]byte, 32)
 
@@ -0,0 +1,89 @@
+package dkim
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+func TestBuildWitness_bodyLength(t *testing.T) {
+	prefix := "Hi,\r\n\r\nApprove recovery code: 482911\r\n"
+	signed := testSignBodyLength(t, testMessage, int64(len(prefix)), "Appended by an attacker\r\n")
+	lookup := testLookupTXT(t, testRSAKey.Public())
+
+	if _, err := BuildWitness(bytes.NewReader(signed), &WitnessOptions{LookupTXT: lookup}); !IsPolicyFail(err) {
+		t.Errorf("BuildWitness() = %v, want a policy error", err)
+	}
+
+	w, err := BuildWitness(bytes.NewReader(signed), &WitnessOptions{LookupTXT: lookup, AllowBodyLength: true})
+	if err != nil {
+		t.Fatalf("BuildWitness() = %v", err)
+	}
+	if !w.Partial || w.BodyLength != int64(len(prefix)) || string(w.Body) != prefix {
+		t.Errorf("Partial, BodyLength, Body = %v, %v, %q, want true, %v, %q", w.Partial, w.BodyLength, w.Body, len(prefix), prefix)
+	}
+
+	// The combined circuit has no body length input
+	if got, want := w.ClaimsInput()["bodyLength"], fmt.Sprint(len(prefix)); got != want {
+		t.Errorf("bodyLength claim = %v, want %v", got, want)
+	}
+	if _, ok := w.CombinedInput()["bodyLength"]; ok {
+		t.Error("bodyLength set in the combined circuit input")
+	}
+
+	full := testWitness(t, testMessage, nil, nil)
+	if _, ok := full.ClaimsInput()["bodyLength"]; ok {
+		t.Error("bodyLength claim set without a body length tag")
+	}
+}
+
+func TestWitnessFromSignals_bodyLength(t *testing.T) {
+	prefix := "Hi,\r\n\r\nApprove recovery code: 482911\r\n"
+	signed := testSignBodyLength(t, testMessage, int64(len(prefix)), "Appended\r\n")
+	w, err := BuildWitness(bytes.NewReader(signed), &WitnessOptions{
+		LookupTXT:       testLookupTXT(t, testRSAKey.Public()),
+		AllowBodyLength: true,
+	})
+	if err != nil {
+		t.Fatalf("BuildWitness() = %v", err)
+	}
+	signature, err := w.SignatureSignals()
+	if err != nil {
+		t.Fatalf("SignatureSignals() = %v", err)
+	}
+	combined, err := w.CombinedSignals()
+	if err != nil {
+		t.Fatalf("CombinedSignals() = %v", err)
+	}
+	claims, err := w.ClaimSignals()
+	if err != nil {
+		t.Fatalf("ClaimSignals() = %v", err)
+	}
+
+	decoded, err := WitnessFromSignals(signature, combined, claims)
+	if err != nil {
+		t.Fatalf("WitnessFromSignals() = %v", err)
+	}
+	if !decoded.Partial || decoded.BodyLength != w.BodyLength {
+		t.Errorf("decoded Partial, BodyLength = %v, %v, want true, %v", decoded.Partial, decoded.BodyLength, w.BodyLength)
+	}
+
+	// The body length tag is read back from the header without the claims
+	if decoded, err := WitnessFromSignals(signature, combined, nil); err != nil || decoded.BodyLength != w.BodyLength {
+		t.Errorf("WitnessFromSignals() without claims = %v, body length %v", err, decoded.BodyLength)
+	}
+
+	if _, err := WitnessFromSignals(signature, combined, []Signal{}); err == nil {
+		t.Error("WitnessFromSignals() = nil without the body length claim")
+	}
+	wrong := replaceSignal(claims, "bodyLength", big.NewInt(w.BodyLength+1))
+	if _, err := WitnessFromSignals(signature, combined, wrong); err == nil {
+		t.Error("WitnessFromSignals() = nil with another body length claim")
+	}
+
+	body := append(signalValues(combined, "body"), big.NewInt('a'))
+	if _, err := WitnessFromSignals(signature, replaceSignal(combined, "body", body...), nil); err == nil {
+		t.Error("WitnessFromSignals() = nil with a body longer than the body length tag")
+	}
+}
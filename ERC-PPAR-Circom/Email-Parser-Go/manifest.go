@@ -0,0 +1,194 @@
+package dkim
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ParserVersion identifies the witness generation in manifests. It changes
+// whenever the circuit inputs generated for a given message and key change:
+// the golden outputs of the ppar-witness tests are pinned to it.
+const ParserVersion = "1.1.0"
+
+// ManifestVersion is the version of the manifest format.
+const ManifestVersion = 1
+
+// A Manifest records how circuit inputs were generated, so that they can be
+// generated again and compared when a recovery is disputed. It only depends
+// on the message, the key and the options: generating the inputs of the same
+// message with the same key source gives the same manifest.
+type Manifest struct {
+	Version int    `json:"version"`
+	Parser  string `json:"parser"`
+	// The hex-encoded SHA-256 of the message.
+	Message string `json:"message"`
+
+	Domain         string `json:"domain"`
+	Selector       string `json:"selector"`
+	SignatureIndex int    `json:"signatureIndex"`
+	// The signature time, as a Unix time, or zero.
+	SignatureTime int64 `json:"signatureTime,omitempty"`
+	// The header and body canonicalizations, e.g. "relaxed/relaxed".
+	Canonicalization string `json:"canonicalization"`
+
+	// KeySource describes where the key was retrieved from, e.g. "dns",
+	// "dnssec:ADDR" or "dir:PATH" as given to the commands.
+	KeySource string `json:"keySource"`
+	// The hex-encoded SHA-256 of the DER-encoded SubjectPublicKeyInfo of
+	// the key.
+	KeyFingerprint string `json:"keyFingerprint"`
+
+	Limbs ManifestLimbs `json:"limbs"`
+	// The output files, sorted by name.
+	Files []ManifestFile `json:"files"`
+	// The WebAssembly modules the witnesses were computed with, by path as
+	// given to the command, sorted by path.
+	Modules []ManifestFile `json:"modules,omitempty"`
+}
+
+// ManifestLimbs records how big integers are split into limbs, see
+// BigIntToArray.
+type ManifestLimbs struct {
+	// The size of a limb, in bits.
+	Bits int `json:"bits"`
+	// The number of limbs of the RSA signature, modulus and exponent, and of
+	// the header hash.
+	RSA  int `json:"rsa"`
+	Hash int `json:"hash"`
+}
+
+// A ManifestFile is a file recorded in a manifest.
+type ManifestFile struct {
+	Name string `json:"name"`
+	// The hex-encoded SHA-256 of the file.
+	SHA256 string `json:"sha256"`
+}
+
+// NewManifest returns the manifest of a witness built from message. Output
+// files are added with AddFile.
+func NewManifest(message []byte, w *Witness, keySource string) (*Manifest, error) {
+	if w.Modulus == nil || w.Exponent == nil || !w.Exponent.IsInt64() {
+		return nil, errors.New("dkim: witness has no valid RSA key")
+	}
+	der, err := x509.MarshalPKIXPublicKey(&rsa.PublicKey{N: w.Modulus, E: int(w.Exponent.Int64())})
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{
+		Version:          ManifestVersion,
+		Parser:           ParserVersion,
+		Message:          sha256Hex(message),
+		Domain:           w.Domain,
+		Selector:         w.Selector,
+		SignatureIndex:   w.SignatureIndex,
+		Canonicalization: string(w.HeaderCanonicalization) + "/" + string(w.BodyCanonicalization),
+		KeySource:        keySource,
+		KeyFingerprint:   sha256Hex(der),
+		Limbs: ManifestLimbs{
+			Bits: limbBits,
+			RSA:  rsaLimbs,
+			Hash: hashLimbs,
+		},
+		Files: []ManifestFile{},
+	}
+	if !w.Time.IsZero() {
+		m.SignatureTime = w.Time.Unix()
+	}
+	return m, nil
+}
+
+// AddFile records an output file. A file already recorded with the same name
+// is replaced.
+func (m *Manifest) AddFile(name string, b []byte) {
+	m.Files = addManifestFile(m.Files, ManifestFile{Name: name, SHA256: sha256Hex(b)})
+}
+
+// AddModule records the WebAssembly module at path a witness was computed
+// with.
+func (m *Manifest) AddModule(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	m.Modules = addManifestFile(m.Modules, ManifestFile{Name: path, SHA256: sha256Hex(b)})
+	return nil
+}
+
+// addManifestFile inserts f in files sorted by name, replacing a file with
+// the same name.
+func addManifestFile(files []ManifestFile, f ManifestFile) []ManifestFile {
+	i := sort.Search(len(files), func(i int) bool { return files[i].Name >= f.Name })
+	if i < len(files) && files[i].Name == f.Name {
+		files[i] = f
+		return files
+	}
+	files = append(files, ManifestFile{})
+	copy(files[i+1:], files[i:])
+	files[i] = f
+	return files
+}
+
+// MarshalIndent encodes the manifest as indented JSON.
+func (m *Manifest) MarshalIndent() ([]byte, error) {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// ReadManifest reads a manifest encoded by Manifest.MarshalIndent.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("dkim: malformed manifest: %v", err)
+	}
+	if m.Version != ManifestVersion {
+		return nil, fmt.Errorf("dkim: unsupported manifest version %v", m.Version)
+	}
+	return &m, nil
+}
+
+// Check checks the output files recorded in the manifest against the files
+// in dir, and the WebAssembly modules against the files at their paths.
+// Relative module paths are relative to the current directory, as when they
+// were given to the command.
+func (m *Manifest) Check(dir string) error {
+	for _, f := range m.Files {
+		if f.Name != filepath.Base(f.Name) {
+			return fmt.Errorf("dkim: invalid file name %q in manifest", f.Name)
+		}
+		b, err := os.ReadFile(filepath.Join(dir, f.Name))
+		if err != nil {
+			return err
+		}
+		if sha256Hex(b) != f.SHA256 {
+			return fmt.Errorf("dkim: %v doesn't match the manifest", f.Name)
+		}
+	}
+	for _, f := range m.Modules {
+		b, err := os.ReadFile(f.Name)
+		if err != nil {
+			return err
+		}
+		if sha256Hex(b) != f.SHA256 {
+			return fmt.Errorf("dkim: module %v doesn't match the manifest", f.Name)
+		}
+	}
+	return nil
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,140 @@
+package dkim
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewManifest(t *testing.T) {
+	w := testWitness(t, testMessage, nil, nil)
+	m, err := NewManifest([]byte(testMessage), w, "dir:keys")
+	if err != nil {
+		t.Fatalf("NewManifest() = %v", err)
+	}
+	if m.Version != ManifestVersion || m.Parser != ParserVersion {
+		t.Errorf("manifest version = %v, parser = %q", m.Version, m.Parser)
+	}
+	if m.Domain != testDomain || m.Selector != testSelector || m.SignatureTime != testTime.Unix() {
+		t.Errorf("manifest = %+v, want the signature of the witness", m)
+	}
+	if m.Canonicalization != "simple/simple" || m.KeySource != "dir:keys" || len(m.KeyFingerprint) != 64 {
+		t.Errorf("manifest = %+v", m)
+	}
+	if m.Limbs != (ManifestLimbs{Bits: limbBits, RSA: rsaLimbs, Hash: hashLimbs}) {
+		t.Errorf("manifest limbs = %+v", m.Limbs)
+	}
+
+	// The manifest only depends on the message and the key
+	other, err := NewManifest([]byte(testMessage), testWitness(t, testMessage, nil, nil), "dir:keys")
+	if err != nil {
+		t.Fatalf("NewManifest() = %v", err)
+	}
+	if !reflect.DeepEqual(m, other) {
+		t.Errorf("NewManifest() = %+v, then %+v", m, other)
+	}
+
+	w.Modulus = nil
+	if _, err := NewManifest([]byte(testMessage), w, "dns"); err == nil {
+		t.Errorf("NewManifest() succeeded without a key")
+	}
+}
+
+func TestManifest_AddFile(t *testing.T) {
+	m := &Manifest{Files: []ManifestFile{}}
+	m.AddFile("b", []byte("b"))
+	m.AddFile("c", []byte("c"))
+	m.AddFile("a", []byte("a"))
+	m.AddFile("b", []byte("other"))
+
+	var names []string
+	for _, f := range m.Files {
+		names = append(names, f.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Errorf("manifest files = %v, want [a b c]", names)
+	}
+	if m.Files[1].SHA256 != sha256Hex([]byte("other")) {
+		t.Errorf("AddFile() didn't replace the file with the same name")
+	}
+}
+
+func TestManifest_Check(t *testing.T) {
+	dir := t.TempDir()
+	modules := t.TempDir()
+	m, err := NewManifest([]byte(testMessage), testWitness(t, testMessage, nil, nil), "dns")
+	if err != nil {
+		t.Fatalf("NewManifest() = %v", err)
+	}
+	files := map[string]string{
+		filepath.Join(dir, "signature.wtns"):          "signature",
+		filepath.Join(dir, "combined.wtns"):           "combined",
+		filepath.Join(modules, "rsa_verify.wasm"):     "rsa_verify module",
+		filepath.Join(modules, "combined.wasm"):       "combined module",
+		filepath.Join(modules, "generate_witness.js"): "",
+	}
+	for path, data := range files {
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.AddFile("signature.wtns", []byte("signature"))
+	m.AddFile("combined.wtns", []byte("combined"))
+	for _, name := range []string{"rsa_verify.wasm", "combined.wasm"} {
+		if err := m.AddModule(filepath.Join(modules, name)); err != nil {
+			t.Fatalf("AddModule() = %v", err)
+		}
+	}
+	if err := m.AddModule(filepath.Join(modules, "missing.wasm")); err == nil {
+		t.Errorf("AddModule() succeeded for a missing module")
+	}
+	if len(m.Modules) != 2 || m.Modules[0].Name != filepath.Join(modules, "combined.wasm") {
+		t.Errorf("manifest modules = %+v", m.Modules)
+	}
+
+	// The manifest is read back as written
+	b, err := m.MarshalIndent()
+	if err != nil {
+		t.Fatalf("MarshalIndent() = %v", err)
+	}
+	m, err = ReadManifest(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ReadManifest() = %v", err)
+	}
+	if err := m.Check(dir); err != nil {
+		t.Fatalf("Check() = %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(modules, "combined.wasm"), []byte("other module"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Check(dir); err == nil || !strings.Contains(err.Error(), "module") {
+		t.Errorf("Check() = %v, want a module mismatch", err)
+	}
+	if err := os.WriteFile(filepath.Join(modules, "combined.wasm"), []byte("combined module"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "combined.wtns"), []byte("other"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Check(dir); err == nil || !strings.Contains(err.Error(), "combined.wtns") {
+		t.Errorf("Check() = %v, want a combined.wtns mismatch", err)
+	}
+
+	m.Files = []ManifestFile{{Name: "../combined.wtns"}}
+	if err := m.Check(dir); err == nil {
+		t.Errorf("Check() succeeded with a file outside of the directory")
+	}
+}
+
+func TestReadManifest_invalid(t *testing.T) {
+	for _, s := range []string{"", "{", `{"version": 2}`} {
+		if _, err := ReadManifest(strings.NewReader(s)); err == nil {
+			t.Errorf("ReadManifest(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package dkim
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// A BodyPart is a leaf MIME part of a canonicalized body. Its decoded content
+// can be mapped back to the raw bytes of the body, so that the circuit keeps
+// operating on the signed bytes while callers work on human-readable text.
+type BodyPart struct {
+	// The lowercase media type, e.g. "text/plain", and its parameters.
+	MediaType string
+	Params    map[string]string
+	// The lowercase Content-Transfer-Encoding of the part.
+	Encoding string
+
+	// The raw content of the part is Body[Start:End], where Body is the
+	// canonicalized body the part was parsed from.
+	Start int
+	End   int
+
+	// The decoded content of the part.
+	Text []byte
+
+	// rawStart[i] and rawEnd[i] delimit the raw bytes encoding Text[i].
+	rawStart []int
+	rawEnd   []int
+}
+
+// ParseBodyParts splits a canonicalized body into its leaf MIME parts.
+// contentType and encoding are the values of the message Content-Type and
+// Content-Transfer-Encoding header fields, and may be empty.
+func ParseBodyParts(contentType, encoding string, body []byte) ([]*BodyPart, error) {
+	return parseBodyParts(contentType, encoding, body, 0, len(body))
+}
+
+func parseBodyParts(contentType, encoding string, body []byte, start, end int) ([]*BodyPart, error) {
+	mediaType := "text/plain"
+	params := map[string]string{"charset": "us-ascii"}
+	if contentType != "" {
+		var err error
+		mediaType, params, err = mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, fmt.Errorf("dkim: malformed Content-Type: %v", err)
+		}
+	}
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		part := &BodyPart{
+			MediaType: mediaType,
+			Params:    params,
+			Encoding:  encoding,
+			Start:     start,
+			End:       end,
+		}
+		if err := part.decode(body); err != nil {
+			return nil, err
+		}
+		return []*BodyPart{part}, nil
+	}
+
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, fmt.Errorf("dkim: %v body has no boundary", mediaType)
+	}
+	delim := []byte("--" + boundary)
+
+	var parts []*BodyPart
+	partStart := -1
+	for offset := start; offset < end; {
+		lineEnd := bytes.Index(body[offset:end], []byte(crlf))
+		next := end
+		if lineEnd < 0 {
+			lineEnd = end
+		} else {
+			lineEnd += offset
+			next = lineEnd + len(crlf)
+		}
+
+		line := body[offset:lineEnd]
+		if bytes.HasPrefix(line, delim) {
+			rest := bytes.TrimRight(line[len(delim):], " \t")
+			closing := bytes.Equal(rest, []byte("--"))
+			if closing || len(rest) == 0 {
+				if partStart >= 0 {
+					// The CRLF preceding the delimiter belongs to it.
+					partEnd := offset - len(crlf)
+					if partEnd < partStart {
+						partEnd = partStart
+					}
+					sub, err := parseMIMEEntity(body, partStart, partEnd)
+					if err != nil {
+						return nil, err
+					}
+					parts = append(parts, sub...)
+				}
+				if closing {
+					return parts, nil
+				}
+				partStart = next
+			}
+		}
+		offset = next
+	}
+
+	return nil, fmt.Errorf("dkim: %v body is missing its closing boundary", mediaType)
+}
+
+// parseMIMEEntity parses the header and content of body[start:end].
+func parseMIMEEntity(body []byte, start, end int) ([]*BodyPart, error) {
+	var h header
+	offset := start
+	for {
+		if offset >= end {
+			// No content, only header fields
+			break
+		}
+		lineEnd := bytes.Index(body[offset:end], []byte(crlf))
+		if lineEnd < 0 {
+			lineEnd = end - offset
+		}
+		l := string(body[offset : offset+lineEnd])
+		offset += lineEnd + len(crlf)
+		if offset > end {
+			offset = end
+		}
+
+		if len(l) == 0 {
+			break
+		} else if len(h) > 0 && (l[0] == ' ' || l[0] == '\t') {
+			h[len(h)-1] += l + crlf
+		} else {
+			h = append(h, l+crlf)
+		}
+	}
+
+	picker := newHeaderPicker(h)
+	contentType := unfoldHeaderValue(picker.Pick("Content-Type"))
+	encoding := unfoldHeaderValue(picker.Pick("Content-Transfer-Encoding"))
+	return parseBodyParts(contentType, encoding, body, offset, end)
+}
+
+// unfoldHeaderValue returns the value of a raw header field, with folding
+// whitespace removed.
+func unfoldHeaderValue(kv string) string {
+	_, v := parseHeaderField(kv)
+	return strings.NewReplacer("\r\n", "", "\n", "").Replace(v)
+}
+
+func (p *BodyPart) decode(body []byte) error {
+	raw := body[p.Start:p.End]
+
+	switch p.Encoding {
+	case "", "7bit", "8bit", "binary":
+		for i, ch := range raw {
+			p.appendDecoded(ch, p.Start+i, p.Start+i+1)
+		}
+	case "quoted-printable":
+		for i := 0; i < len(raw); {
+			ch := raw[i]
+			if ch != '=' {
+				p.appendDecoded(ch, p.Start+i, p.Start+i+1)
+				i++
+				continue
+			}
+
+			// Soft line break, possibly preceded by transport padding
+			j := i + 1
+			for j < len(raw) && (raw[j] == ' ' || raw[j] == '\t') {
+				j++
+			}
+			if j == len(raw) || bytes.HasPrefix(raw[j:], []byte(crlf)) {
+				i = j + len(crlf)
+				continue
+			}
+
+			if i+2 < len(raw) && isHexDigit(raw[i+1]) && isHexDigit(raw[i+2]) {
+				p.appendDecoded(unhex(raw[i+1])<<4|unhex(raw[i+2]), p.Start+i, p.Start+i+3)
+				i += 3
+				continue
+			}
+
+			// Be lenient with malformed escapes, like most mail clients.
+			p.appendDecoded(ch, p.Start+i, p.Start+i+1)
+			i++
+		}
+	case "base64":
+		var quad []byte
+		var pos []int
+		for i, ch := range raw {
+			if ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n' {
+				continue
+			}
+			quad = append(quad, ch)
+			pos = append(pos, p.Start+i)
+			if len(quad) < 4 {
+				continue
+			}
+
+			var dec [3]byte
+			n, err := base64.StdEncoding.Decode(dec[:], quad)
+			if err != nil {
+				return fmt.Errorf("dkim: malformed base64 part: %v", err)
+			}
+			for _, b := range dec[:n] {
+				p.appendDecoded(b, pos[0], pos[3]+1)
+			}
+			quad, pos = quad[:0], pos[:0]
+		}
+		if len(quad) > 0 {
+			return fmt.Errorf("dkim: malformed base64 part: truncated input")
+		}
+	default:
+		return fmt.Errorf("dkim: unsupported Content-Transfer-Encoding %q", p.Encoding)
+	}
+	return nil
+}
+
+func (p *BodyPart) appendDecoded(b byte, rawStart, rawEnd int) {
+	p.Text = append(p.Text, b)
+	p.rawStart = append(p.rawStart, rawStart)
+	p.rawEnd = append(p.rawEnd, rawEnd)
+}
+
+// RawRange maps the range [start, end) of Text to the range of raw body bytes
+// encoding it. For base64 parts, the raw range is widened to whole 4-character
+// groups.
+func (p *BodyPart) RawRange(start, end int) (RevealRange, error) {
+	if start < 0 || end > len(p.Text) || start >= end {
+		return RevealRange{}, fmt.Errorf("dkim: invalid text range [%v, %v)", start, end)
+	}
+	return RevealRange{p.rawStart[start], p.rawEnd[end-1]}, nil
+}
+
+// Reveal finds the part of the decoded text described by spec, and maps it
+// back to the canonicalized body the part was parsed from. The returned
+// Reveal's mask and value refer to the raw body bytes, and its Text field
+// holds the decoded revealed text.
+func (p *BodyPart) Reveal(body []byte, spec *RevealSpec) (*Reveal, error) {
+	if p.End > len(body) {
+		return nil, fmt.Errorf("dkim: body doesn't contain the MIME part")
+	}
+
+	textReveal, err := FindReveal(p.Text, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	reveal := &Reveal{
+		Name: textReveal.Name,
+		Mask: make([]byte, len(body)),
+		Text: textReveal.Value,
+	}
+	for _, tr := range textReveal.Ranges {
+		r, err := p.RawRange(tr.Start, tr.End)
+		if err != nil {
+			return nil, err
+		}
+		// Ranges from adjacent base64 groups may overlap
+		if n := len(reveal.Ranges); n > 0 && r.Start <= reveal.Ranges[n-1].End {
+			if r.End > reveal.Ranges[n-1].End {
+				reveal.Ranges[n-1].End = r.End
+			}
+			continue
+		}
+		reveal.Ranges = append(reveal.Ranges, r)
+	}
+	for _, r := range reveal.Ranges {
+		for i := r.Start; i < r.End; i++ {
+			reveal.Mask[i] = 1
+		}
+		reveal.Value = append(reveal.Value, body[r.Start:r.End]...)
+	}
+	return reveal, nil
+}
+
+// TextPart returns the first text/plain part, or nil if there is none.
+func TextPart(parts []*BodyPart) *BodyPart {
+	for _, p := range parts {
+		if p.MediaType == "text/plain" {
+			return p
+		}
+	}
+	return nil
+}
+
+func isHexDigit(ch byte) bool {
+	return ('0' <= ch && ch <= '9') || ('a' <= ch && ch <= 'f') || ('A' <= ch && ch <= 'F')
+}
+
+func unhex(ch byte) byte {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return ch - '0'
+	case 'a' <= ch && ch <= 'f':
+		return ch - 'a' + 10
+	default:
+		return ch - 'A' + 10
+	}
+}
@@ -0,0 +1,162 @@
+package dkim
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const mimeContentType = `multipart/alternative; boundary="b1"`
+
+const mimeBody = "--b1\r\n" +
+	"Content-Type: text/plain; charset=\"UTF-8\"\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"R=C3=A9cup=C3=A9ration: approve recovery code: 482911, a very long line th=\r\n" +
+	"at is soft-wrapped\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/html; charset=\"UTF-8\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"PGRpdj5jb2RlOiA0ODI5MTE8L2Rpdj4=\r\n" +
+	"--b1--\r\n"
+
+func TestParseBodyParts(t *testing.T) {
+	parts, err := ParseBodyParts(mimeContentType, "", []byte(mimeBody))
+	if err != nil {
+		t.Fatalf("ParseBodyParts() = %v", err)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("got %v parts, want 2", len(parts))
+	}
+
+	tests := []struct {
+		mediaType string
+		encoding  string
+		text      string
+	}{
+		{"text/plain", "quoted-printable", "Récupération: approve recovery code: 482911, a very long line that is soft-wrapped"},
+		{"text/html", "base64", "<div>code: 482911</div>"},
+	}
+	for i, tc := range tests {
+		p := parts[i]
+		if p.MediaType != tc.mediaType || p.Encoding != tc.encoding {
+			t.Errorf("part %v is %v %v, want %v %v", i, p.MediaType, p.Encoding, tc.mediaType, tc.encoding)
+		}
+		if string(p.Text) != tc.text {
+			t.Errorf("part %v text = %q, want %q", i, p.Text, tc.text)
+		}
+	}
+	if p := TextPart(parts); p != parts[0] {
+		t.Errorf("TextPart() = %v, want the first part", p)
+	}
+}
+
+func TestParseBodyParts_singlePart(t *testing.T) {
+	body := []byte("Hello=20World\r\n")
+	parts, err := ParseBodyParts("", "Quoted-Printable", body)
+	if err != nil {
+		t.Fatalf("ParseBodyParts() = %v", err)
+	}
+	if len(parts) != 1 || parts[0].MediaType != "text/plain" || string(parts[0].Text) != "Hello World\r\n" {
+		t.Errorf("ParseBodyParts() = %+v", parts)
+	}
+}
+
+func TestParseBodyParts_invalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		encoding    string
+		body        string
+	}{
+		{"malformed content type", "multipart/", "", ""},
+		{"no boundary", "multipart/mixed", "", "--b1--\r\n"},
+		{"no closing boundary", mimeContentType, "", "--b1\r\n\r\nHello\r\n"},
+		{"malformed base64", "text/plain", "base64", "SGVsbG8\r\n"},
+		{"unsupported encoding", "text/plain", "x-uuencode", "Hello\r\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseBodyParts(tc.contentType, tc.encoding, []byte(tc.body)); err == nil {
+				t.Error("ParseBodyParts() = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestBodyPart_Reveal(t *testing.T) {
+	body := []byte(mimeBody)
+	parts, err := ParseBodyParts(mimeContentType, "", body)
+	if err != nil {
+		t.Fatalf("ParseBodyParts() = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		part *BodyPart
+		spec *RevealSpec
+		text string
+		raw  string
+	}{
+		{
+			name: "quoted-printable",
+			part: parts[0],
+			spec: &RevealSpec{Name: "word", Regexp: regexp.MustCompile(`^\S+:`)},
+			text: "Récupération:",
+			raw:  "R=C3=A9cup=C3=A9ration:",
+		},
+		{
+			name: "soft line break",
+			part: parts[0],
+			spec: &RevealSpec{Name: "word", Regexp: regexp.MustCompile(`that`)},
+			text: "that",
+			raw:  "th=\r\nat",
+		},
+		{
+			name: "base64",
+			part: parts[1],
+			spec: &RevealSpec{Name: "code", Regexp: regexp.MustCompile(`\d+`)},
+			text: "482911",
+			raw:  "OiA0ODI5MTE8",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reveal, err := tc.part.Reveal(body, tc.spec)
+			if err != nil {
+				t.Fatalf("Reveal() = %v", err)
+			}
+			if string(reveal.Text) != tc.text {
+				t.Errorf("Text = %q, want %q", reveal.Text, tc.text)
+			}
+			if string(reveal.Value) != tc.raw {
+				t.Errorf("Value = %q, want %q", reveal.Value, tc.raw)
+			}
+			if err := reveal.Check(body); err != nil {
+				t.Errorf("Check() = %v", err)
+			}
+		})
+	}
+}
+
+func TestBuildWitness_decodeMIME(t *testing.T) {
+	msg := strings.Replace(testMessage, "\r\n\r\n", "\r\nMIME-Version: 1.0\r\nContent-Type: "+mimeContentType+"\r\n\r\n", 1)
+	msg = msg[:strings.Index(msg, "\r\n\r\n")+4] + mimeBody
+
+	w := testWitness(t, msg, nil, &WitnessOptions{
+		DecodeMIME:  true,
+		BodyReveals: []*RevealSpec{{Name: "word", Regexp: regexp.MustCompile(`^\S+:`)}},
+	})
+	reveal := w.BodyReveals[0]
+	if string(reveal.Text) != "Récupération:" {
+		t.Errorf("Text = %q, want %q", reveal.Text, "Récupération:")
+	}
+	if !bytes.Contains(w.Body, reveal.Value) {
+		t.Errorf("body doesn't contain the revealed value %q", reveal.Value)
+	}
+	if err := reveal.Check(w.Body); err != nil {
+		t.Errorf("Check() = %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package dkim
+
+// HeaderPreset is a predefined set of header fields to sign, see
+// SignOptions.HeaderPreset.
+type HeaderPreset string
+
+const (
+	// HeaderPresetRecommended signs the header fields recommended by RFC 6376
+	// section 5.4.1 which are present in the message.
+	HeaderPresetRecommended HeaderPreset = "recommended"
+	// HeaderPresetGmail signs the same header fields as Gmail, oversigning
+	// the ones identifying the message.
+	HeaderPresetGmail HeaderPreset = "gmail"
+	// HeaderPresetOversigned is HeaderPresetRecommended with From, To,
+	// Subject and Date oversigned.
+	HeaderPresetOversigned HeaderPreset = "oversigned"
+)
+
+// recommendedHeaderKeys is the list of header fields from RFC 6376 section
+// 5.4.1.
+var recommendedHeaderKeys = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc",
+	"Resent-Date", "Resent-From", "Resent-To", "Resent-Cc",
+	"In-Reply-To", "References",
+	"List-Id", "List-Help", "List-Unsubscribe", "List-Subscribe",
+	"List-Post", "List-Owner", "List-Archive",
+}
+
+// headerPresets lists, for each preset, the header fields signed for each of
+// their instances, then the header fields oversigned.
+//
+// Oversigned header fields are listed once more in "h=", after the signed
+// ones. Once all instances are signed, the extra name refers to a nonexistent
+// header field, so that the signature doesn't verify anymore if an instance
+// is added in transit.
+var headerPresets = map[HeaderPreset]struct {
+	signed, oversigned []string
+}{
+	HeaderPresetRecommended: {signed: recommendedHeaderKeys},
+	HeaderPresetGmail: {
+		signed:     []string{"to", "subject", "message-id", "date", "from", "mime-version"},
+		oversigned: []string{"from", "to", "cc", "subject", "date", "message-id", "reply-to"},
+	},
+	HeaderPresetOversigned: {
+		signed:     recommendedHeaderKeys,
+		oversigned: []string{"From", "To", "Subject", "Date"},
+	},
+}
+
+// expandHeaderPreset returns the list of header field names to include in
+// "h=" for a message header.
+func expandHeaderPreset(preset HeaderPreset, h header) []string {
+	p := headerPresets[preset]
+
+	counts := make(map[string]int)
+	for _, kv := range h {
+		k, _ := parseHeaderField(kv)
+		counts[asciiToLower(k)]++
+	}
+
+	var keys []string
+	for _, k := range p.signed {
+		for i := 0; i < counts[asciiToLower(k)]; i++ {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range p.oversigned {
+		keys = append(keys, k)
+	}
+	return keys
+}
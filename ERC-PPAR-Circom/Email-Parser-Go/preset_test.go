@@ -0,0 +1,62 @@
+package dkim
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandHeaderPreset(t *testing.T) {
+	h, err := readHeader(bufio.NewReader(strings.NewReader(testMessage)))
+	if err != nil {
+		t.Fatalf("readHeader() = %v", err)
+	}
+	h = append(h, "To: Other <other@example.com>\r\n")
+
+	tests := []struct {
+		preset HeaderPreset
+		keys   []string
+	}{
+		{HeaderPresetRecommended, []string{"From", "Subject", "Date", "To", "To"}},
+		{HeaderPresetOversigned, []string{"From", "Subject", "Date", "To", "To", "From", "To", "Subject", "Date"}},
+		{HeaderPresetGmail, []string{
+			"to", "to", "subject", "message-id", "date", "from",
+			"from", "to", "cc", "subject", "date", "message-id", "reply-to",
+		}},
+	}
+	for _, tc := range tests {
+		if keys := expandHeaderPreset(tc.preset, h); !reflect.DeepEqual(keys, tc.keys) {
+			t.Errorf("expandHeaderPreset(%v) = %v, want %v", tc.preset, keys, tc.keys)
+		}
+	}
+}
+
+func TestSign_headerPreset(t *testing.T) {
+	lookup := testLookupTXT(t, testRSAKey.Public())
+	for _, preset := range []HeaderPreset{HeaderPresetRecommended, HeaderPresetOversigned, HeaderPresetGmail} {
+		t.Run(string(preset), func(t *testing.T) {
+			signed := testSign(t, testMessage, &SignOptions{HeaderPreset: preset})
+			if verif := testVerify(t, signed, &VerifyOptions{LookupTXT: lookup}); verif.Err != nil {
+				t.Fatalf("Verification.Err = %v", verif.Err)
+			}
+
+			// Adding an unsigned header field keeps the signature valid,
+			// adding an oversigned one breaks it
+			extra := append([]byte("X-Mailer: test\r\n"), signed...)
+			if verif := testVerify(t, extra, &VerifyOptions{LookupTXT: lookup}); verif.Err != nil {
+				t.Errorf("Verification.Err = %v with an unsigned field added", verif.Err)
+			}
+			spoofed := append([]byte("From: Mallory <mallory@example.com>\r\n"), signed...)
+			verif := testVerify(t, spoofed, &VerifyOptions{LookupTXT: lookup})
+			if oversigned := preset != HeaderPresetRecommended; oversigned && verif.Err == nil {
+				t.Error("Verification.Err = nil with a From field added")
+			}
+		})
+	}
+
+	var b strings.Builder
+	if err := Sign(&b, strings.NewReader(testMessage), &SignOptions{Domain: testDomain, Selector: testSelector, Signer: testRSAKey, HeaderPreset: "unknown"}); err == nil {
+		t.Error("Sign() = nil with an unknown header preset")
+	}
+}
@@ -52,6 +52,41 @@ type queryResult struct {
 	Notes     string
 	Services  []string
 	Flags     []string
+	// The TXT records returned by the lookup, with their individual strings.
+	Records [][]string
+}
+
+// KeySize returns the size of the public key in bits.
+func (res *queryResult) KeySize() int {
+	switch pub := res.Verifier.Public().(type) {
+	case *rsa.PublicKey:
+		return pub.N.BitLen()
+	case ed25519.PublicKey:
+		return len(pub) * 8
+	default:
+		return 0
+	}
+}
+
+// Testing returns true if the key has the "y" flag: the domain is testing
+// DKIM.
+func (res *queryResult) Testing() bool {
+	return res.hasFlag("y")
+}
+
+// Strict returns true if the key has the "s" flag: the "i" domain of
+// signatures must be the same as the "d" domain, not a subdomain.
+func (res *queryResult) Strict() bool {
+	return res.hasFlag("s")
+}
+
+func (res *queryResult) hasFlag(flag string) bool {
+	for _, f := range res.Flags {
+		if strings.EqualFold(f, flag) {
+			return true
+		}
+	}
+	return false
 }
 
 // QueryMethod is a DKIM query method.
@@ -62,41 +97,96 @@ const (
 	QueryMethodDNSTXT QueryMethod = "dns/txt"
 )
 
-type txtLookupFunc func(domain string) ([]string, error)
-type queryFunc func(domain, selector string, txtLookup txtLookupFunc) (*queryResult, error)
+// TXTRecordPolicy defines how the TXT records found for a key are handled.
+type TXTRecordPolicy int
+
+const (
+	// TXTRecordStrict fails if more than one TXT record is found, since RFC
+	// 6376 section 3.6.2.2 leaves this case undefined.
+	TXTRecordStrict TXTRecordPolicy = iota
+	// TXTRecordFilter ignores the records which aren't DKIM key records, i.e.
+	// which don't have a "v=DKIM1" or "p" tag, e.g. an SPF record published
+	// at the same name. It fails if more than one record is left.
+	TXTRecordFilter
+)
+
+// txtLookupFunc returns the TXT records of a domain name, each record being a
+// list of strings.
+type txtLookupFunc func(domain string) ([][]string, error)
+type queryFunc func(domain, selector string, txtLookup txtLookupFunc, policy TXTRecordPolicy) (*queryResult, error)
 
 var queryMethods = map[QueryMethod]queryFunc{
 	QueryMethodDNSTXT: queryDNSTXT,
 }
 
-func queryDNSTXT(domain, selector string, txtLookup txtLookupFunc) (*queryResult, error) {
-	if txtLookup == nil {
-		txtLookup = net.LookupTXT
-	}
-
-	txts, err := txtLookup(selector + "._domainkey." + domain)
+func queryDNSTXT(domain, selector string, txtLookup txtLookupFunc, policy TXTRecordPolicy) (*queryResult, error) {
+	records, err := txtLookup(KeyRecordName(domain, selector))
 	if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
 		return nil, tempFailError("key unavailable: " + err.Error())
 	} else if err != nil {
 		return nil, permFailError("no key for signature: " + err.Error())
 	}
 
-	// net.LookupTXT will concatenate strings contained in a single TXT record.
-	// In other words, net.LookupTXT returns one entry per TXT record, even if
-	// a record contains multiple strings.
-	//
+	// The strings of a TXT record are concatenated, see RFC 6376 section
+	// 3.6.2.2.
+	var txts []string
+	for _, record := range records {
+		txt := strings.Join(record, "")
+		if policy == TXTRecordFilter && !isKeyRecord(txt) {
+			continue
+		}
+		txts = append(txts, txt)
+	}
+
 	// RFC 6376 section 3.6.2.2 says multiple TXT records lead to undefined
 	// behavior, so reject that.
 	switch len(txts) {
 	case 0:
 		return nil, permFailError("no valid key found")
 	case 1:
-		return parsePublicKey(txts[0])
+		res, err := parsePublicKey(txts[0])
+		if err != nil {
+			return nil, err
+		}
+		res.Records = records
+		return res, nil
 	default:
 		return nil, permFailError("multiple TXT records found for key")
 	}
 }
 
+// isKeyRecord returns true if the TXT record looks like a DKIM key record.
+func isKeyRecord(txt string) bool {
+	params, err := parseHeaderParams(txt)
+	if err != nil {
+		return false
+	}
+	_, hasKey := params["p"]
+	return params["v"] == "DKIM1" || hasKey
+}
+
+// lookupTXTStrings adapts a lookup function returning concatenated TXT
+// records. If lookupTXT is nil, net.LookupTXT is used.
+func lookupTXTStrings(lookupTXT func(domain string) ([]string, error)) txtLookupFunc {
+	if lookupTXT == nil {
+		lookupTXT = net.LookupTXT
+	}
+	return func(domain string) ([][]string, error) {
+		txts, err := lookupTXT(domain)
+		if err != nil {
+			return nil, err
+		}
+		// net.LookupTXT will concatenate strings contained in a single TXT
+		// record. In other words, net.LookupTXT returns one entry per TXT
+		// record, even if a record contains multiple strings.
+		records := make([][]string, len(txts))
+		for i, txt := range txts {
+			records[i] = []string{txt}
+		}
+		return records, nil
+	}
+}
+
 func parsePublicKey(s string) (*queryResult, error) {
 	params, err := parseHeaderParams(s)
 	if err != nil {
@@ -0,0 +1,128 @@
+package dkim
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+const testEd25519Record = "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+
+func TestQueryDNSTXT(t *testing.T) {
+	tests := []struct {
+		name    string
+		records [][]string
+		policy  TXTRecordPolicy
+		ok      bool
+	}{
+		{"single", [][]string{{testEd25519Record}}, TXTRecordStrict, true},
+		{"split", [][]string{{"v=DKIM1; k=ed25519; ", "p=11qYAYKxCrfVS/7TyWQHOg7hcvPap", "iMlrwIaaPcHURo="}}, TXTRecordStrict, true},
+		{"strict-spf", [][]string{{"v=spf1 -all"}, {testEd25519Record}}, TXTRecordStrict, false},
+		{"filter-spf", [][]string{{"v=spf1 -all"}, {testEd25519Record}}, TXTRecordFilter, true},
+		{"filter-two-keys", [][]string{{testEd25519Record}, {testEd25519Record}}, TXTRecordFilter, false},
+		{"filter-none", [][]string{{"v=spf1 -all"}}, TXTRecordFilter, false},
+		{"empty", nil, TXTRecordStrict, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			lookup := func(domain string) ([][]string, error) {
+				if domain != "test._domainkey.example.org" {
+					t.Errorf("looked up %q", domain)
+				}
+				return tc.records, nil
+			}
+			res, err := queryDNSTXT(testDomain, testSelector, lookup, tc.policy)
+			if !tc.ok {
+				if !IsPermFail(err) {
+					t.Errorf("queryDNSTXT() = %v, want a permanent failure", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("queryDNSTXT() = %v", err)
+			}
+			if res.KeyAlgo != "ed25519" || res.KeySize() != 256 {
+				t.Errorf("queryDNSTXT() returned a %v-bit %v key, want a 256-bit ed25519 key", res.KeySize(), res.KeyAlgo)
+			}
+			if !reflect.DeepEqual(res.Records, tc.records) {
+				t.Errorf("queryDNSTXT() records = %q, want %q", res.Records, tc.records)
+			}
+		})
+	}
+}
+
+func TestQueryDNSTXT_lookupError(t *testing.T) {
+	tests := []struct {
+		err      error
+		tempFail bool
+	}{
+		{&net.DNSError{Err: "server replied SERVFAIL", IsTemporary: true}, true},
+		{&net.DNSError{Err: "no such host", IsNotFound: true}, false},
+		{errors.New("lookup failed"), false},
+	}
+	for _, tc := range tests {
+		lookup := func(domain string) ([][]string, error) {
+			return nil, tc.err
+		}
+		_, err := queryDNSTXT(testDomain, testSelector, lookup, TXTRecordStrict)
+		if IsTempFail(err) != tc.tempFail || IsPermFail(err) == tc.tempFail {
+			t.Errorf("queryDNSTXT() with lookup error %v = %v, want temporary failure = %v", tc.err, err, tc.tempFail)
+		}
+	}
+}
+
+func TestIsKeyRecord(t *testing.T) {
+	tests := []struct {
+		txt  string
+		want bool
+	}{
+		{testEd25519Record, true},
+		{"p=MIIB", true},
+		{"v=DKIM1", true},
+		{"v=spf1 -all", false},
+		{"google-site-verification=abc", false},
+		{"", false},
+	}
+	for _, tc := range tests {
+		if got := isKeyRecord(tc.txt); got != tc.want {
+			t.Errorf("isKeyRecord(%q) = %v, want %v", tc.txt, got, tc.want)
+		}
+	}
+}
+
+func TestVerify_txtRecords(t *testing.T) {
+	record, err := FormatKeyRecord(testRSAKey.Public())
+	if err != nil {
+		t.Fatalf("FormatKeyRecord() = %v", err)
+	}
+	// TXT strings are at most 255 bytes long, so 2048-bit RSA keys are split
+	records := [][]string{{"v=spf1 -all"}, {record[:255], record[255:]}}
+	r := &DNSResolver{Addr: testServeDNS(t, testTXTServer{"test._domainkey.example.org.": records})}
+	signed := testSign(t, testMessage, nil)
+
+	verif := testVerify(t, signed, &VerifyOptions{LookupTXTStrings: r.LookupTXTStrings})
+	if !IsPermFail(verif.Err) {
+		t.Errorf("Verification.Err with the strict policy = %v, want a permanent failure", verif.Err)
+	}
+
+	verif = testVerify(t, signed, &VerifyOptions{
+		LookupTXTStrings: r.LookupTXTStrings,
+		TXTRecordPolicy:  TXTRecordFilter,
+	})
+	if verif.Err != nil {
+		t.Errorf("Verification.Err with the filter policy = %v", verif.Err)
+	}
+
+	w, err := BuildWitness(bytes.NewReader(signed), &WitnessOptions{
+		LookupTXTStrings: r.LookupTXTStrings,
+		TXTRecordPolicy:  TXTRecordFilter,
+	})
+	if err != nil {
+		t.Fatalf("BuildWitness() = %v", err)
+	}
+	if w.Modulus.Cmp(testRSAKey.N) != 0 {
+		t.Errorf("witness modulus isn't the one of the signing key")
+	}
+}
@@ -0,0 +1,99 @@
+package dkim
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// RawHeaderField is a header field exactly as found in a message.
+type RawHeaderField struct {
+	// The field name, without surrounding whitespace.
+	Name string
+	// The field bytes, including the name, the folding whitespace and the
+	// original line endings, CRLF or bare LF. The last field of a message
+	// without body may lack a line ending.
+	Raw []byte
+	// The position of the field in the message, in bytes.
+	Offset int64
+}
+
+// RawHeader is a message header, without any normalization.
+type RawHeader struct {
+	Fields []RawHeaderField
+	// HasBody is true if the header is followed by the empty line separating
+	// it from the body. Messages without body may omit it.
+	HasBody bool
+	// The position of the body in the message, in bytes. If HasBody is false,
+	// it's the length of the message.
+	BodyOffset int64
+}
+
+// ReadRawHeader reads a message header. Unlike the header parsing done when
+// signing and verifying, line endings aren't normalized, so the positions of
+// the fields match the original message.
+//
+// Reaching the end of the input before the empty line ending the header is
+// not an error: the message has no body.
+func ReadRawHeader(r *bufio.Reader) (*RawHeader, error) {
+	h := new(RawHeader)
+	var offset int64
+	for {
+		l, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return h, err
+		}
+		if len(l) == 0 {
+			break
+		}
+
+		if isEmptyLine(l) {
+			h.HasBody = true
+			offset += int64(len(l))
+			break
+		}
+
+		if n := len(h.Fields); n > 0 && (l[0] == ' ' || l[0] == '\t') {
+			// This is a continuation line
+			h.Fields[n-1].Raw = append(h.Fields[n-1].Raw, l...)
+		} else {
+			k, _, _ := bytes.Cut(l, []byte(":"))
+			h.Fields = append(h.Fields, RawHeaderField{
+				Name:   string(bytes.TrimSpace(k)),
+				Raw:    l,
+				Offset: offset,
+			})
+		}
+		offset += int64(len(l))
+
+		if err == io.EOF {
+			break
+		}
+	}
+	h.BodyOffset = offset
+	return h, nil
+}
+
+// header returns the header fields with their line endings normalized to
+// CRLF.
+func (h *RawHeader) header() header {
+	fields := make(header, len(h.Fields))
+	for i, f := range h.Fields {
+		var b bytes.Buffer
+		for _, l := range bytes.SplitAfter(f.Raw, []byte("\n")) {
+			if len(l) == 0 {
+				continue
+			}
+			l = bytes.TrimSuffix(l, []byte("\n"))
+			l = bytes.TrimSuffix(l, []byte("\r"))
+			b.Write(l)
+			b.WriteString(crlf)
+		}
+		fields[i] = b.String()
+	}
+	return fields
+}
+
+func isEmptyLine(l []byte) bool {
+	return len(l) == 1 && l[0] == '\n' || len(l) == 2 && l[0] == '\r' && l[1] == '\n'
+}
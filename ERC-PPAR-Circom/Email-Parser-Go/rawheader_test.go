@@ -0,0 +1,128 @@
+package dkim
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadRawHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     string
+		fields  []RawHeaderField
+		hasBody bool
+	}{
+		{
+			name: "crlf",
+			msg:  "From: alice@example.org\r\nSubject: hi\r\n\r\nbody\r\n",
+			fields: []RawHeaderField{
+				{"From", []byte("From: alice@example.org\r\n"), 0},
+				{"Subject", []byte("Subject: hi\r\n"), 25},
+			},
+			hasBody: true,
+		},
+		{
+			name: "lf",
+			msg:  "From: alice@example.org\nSubject: hi\n\nbody\n",
+			fields: []RawHeaderField{
+				{"From", []byte("From: alice@example.org\n"), 0},
+				{"Subject", []byte("Subject: hi\n"), 24},
+			},
+			hasBody: true,
+		},
+		{
+			name: "mixed-folded",
+			msg:  "Subject: a\r\n\tlong\n  subject\r\nTo : bob@example.org\n\r\n",
+			fields: []RawHeaderField{
+				{"Subject", []byte("Subject: a\r\n\tlong\n  subject\r\n"), 0},
+				{"To", []byte("To : bob@example.org\n"), 29},
+			},
+			hasBody: true,
+		},
+		{
+			name: "no-body",
+			msg:  "From: alice@example.org\r\nSubject: hi\r\n",
+			fields: []RawHeaderField{
+				{"From", []byte("From: alice@example.org\r\n"), 0},
+				{"Subject", []byte("Subject: hi\r\n"), 25},
+			},
+		},
+		{
+			name: "no-line-ending",
+			msg:  "From: alice@example.org\r\nSubject: hi",
+			fields: []RawHeaderField{
+				{"From", []byte("From: alice@example.org\r\n"), 0},
+				{"Subject", []byte("Subject: hi"), 25},
+			},
+		},
+		{
+			name:    "empty-header",
+			msg:     "\r\nbody\r\n",
+			hasBody: true,
+		},
+		{
+			name: "empty",
+			msg:  "",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			br := bufio.NewReader(strings.NewReader(tc.msg))
+			h, err := ReadRawHeader(br)
+			if err != nil {
+				t.Fatalf("ReadRawHeader() = %v", err)
+			}
+			if !reflect.DeepEqual(h.Fields, tc.fields) {
+				t.Errorf("ReadRawHeader() fields = %q, want %q", h.Fields, tc.fields)
+			}
+			if h.HasBody != tc.hasBody {
+				t.Errorf("ReadRawHeader() HasBody = %v, want %v", h.HasBody, tc.hasBody)
+			}
+
+			// The fields and the body are at their offsets in the message
+			for _, f := range h.Fields {
+				if !strings.HasPrefix(tc.msg[f.Offset:], string(f.Raw)) {
+					t.Errorf("field %v isn't at offset %v", f.Name, f.Offset)
+				}
+			}
+			rest, _ := br.ReadString(0)
+			if tc.msg[h.BodyOffset:] != rest {
+				t.Errorf("body at offset %v = %q, want %q", h.BodyOffset, tc.msg[h.BodyOffset:], rest)
+			}
+		})
+	}
+}
+
+func TestRawHeader_header(t *testing.T) {
+	msg := "Subject: a\r\n\tlong\n  subject\nTo: bob@example.org"
+	h, err := ReadRawHeader(bufio.NewReader(strings.NewReader(msg)))
+	if err != nil {
+		t.Fatalf("ReadRawHeader() = %v", err)
+	}
+	want := header{"Subject: a\r\n\tlong\r\n  subject\r\n", "To: bob@example.org\r\n"}
+	if got := h.header(); !reflect.DeepEqual(got, want) {
+		t.Errorf("RawHeader.header() = %q, want %q", got, want)
+	}
+}
+
+func TestReadHeader_noBody(t *testing.T) {
+	if _, err := readHeader(bufio.NewReader(strings.NewReader(""))); err == nil {
+		t.Errorf("readHeader() succeeded for an empty message")
+	}
+
+	// A header-only message can be signed and verified
+	msg := "From: Alice <alice@example.org>\r\nTo: Guardian <guardian@example.com>\r\nSubject: Account recovery\r\n"
+	for _, can := range []Canonicalization{CanonicalizationSimple, CanonicalizationRelaxed} {
+		signed := testSign(t, msg, &SignOptions{HeaderCanonicalization: can, BodyCanonicalization: can})
+		if !bytes.HasSuffix(signed, []byte(msg)) {
+			t.Fatalf("signed message doesn't end with the original message")
+		}
+		verif := testVerify(t, signed, &VerifyOptions{LookupTXT: testLookupTXT(t, testRSAKey.Public())})
+		if verif.Err != nil {
+			t.Errorf("%v: signature of a header-only message didn't verify: %v", can, verif.Err)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package dkim
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// RevealSpec describes a part of a canonicalized header or body that should
+// be disclosed by the circuit while the rest stays private.
+//
+// Exactly one of Regexp and Anchor must be set.
+type RevealSpec struct {
+	// Name identifies the reveal in the claims inputs, see
+	// Witness.ClaimsInput. It must be an identifier, [A-Za-z_][A-Za-z0-9_]*,
+	// and neither it nor the names of its inputs may be the ones of other
+	// inputs.
+	Name string
+
+	// Regexp matches the bytes to reveal. If the expression contains a
+	// capturing group, only the first group is revealed.
+	Regexp *regexp.Regexp
+	// Anchor is a literal prefix. The bytes following it, up to the end of
+	// the line, are revealed.
+	Anchor string
+
+	// If All is set, every match is revealed instead of the first one only.
+	All bool
+}
+
+// A RevealRange is a half-open byte range [Start, End).
+type RevealRange struct {
+	Start int
+	End   int
+}
+
+// A Reveal is produced by FindReveal. It holds the revealed ranges of the
+// canonicalized data, the matching mask and the revealed bytes.
+type Reveal struct {
+	Name string
+
+	// The revealed byte ranges, in increasing order.
+	Ranges []RevealRange
+	// Mask has the same length as the canonicalized data. Revealed bytes are
+	// set to 1, private bytes to 0.
+	Mask []byte
+	// Value is the concatenation of the revealed bytes.
+	Value []byte
+	// Text is the decoded revealed text when the reveal was found in a MIME
+	// part, see BodyPart.Reveal. Otherwise, it's nil.
+	Text []byte
+}
+
+// FindReveal looks for the part of b described by spec. b must be the
+// canonicalized bytes the circuit operates on, e.g. the output of
+// CanonicalizeBody.
+func FindReveal(b []byte, spec *RevealSpec) (*Reveal, error) {
+	if spec == nil {
+		return nil, errors.New("dkim: no reveal specified")
+	}
+	if err := checkRevealName(spec.Name); err != nil {
+		return nil, err
+	}
+	if (spec.Regexp == nil) == (spec.Anchor == "") {
+		return nil, fmt.Errorf("dkim: reveal %q must have exactly one of a regexp or an anchor", spec.Name)
+	}
+
+	n := 1
+	if spec.All {
+		n = -1
+	}
+
+	var ranges []RevealRange
+	if spec.Regexp != nil {
+		for _, m := range spec.Regexp.FindAllSubmatchIndex(b, n) {
+			start, end := m[0], m[1]
+			if len(m) > 2 {
+				start, end = m[2], m[3]
+			}
+			if start < 0 || start == end {
+				continue
+			}
+			ranges = append(ranges, RevealRange{start, end})
+		}
+	} else {
+		anchor := []byte(spec.Anchor)
+		for offset := 0; n < 0 || len(ranges) < n; {
+			i := bytes.Index(b[offset:], anchor)
+			if i < 0 {
+				break
+			}
+			start := offset + i + len(anchor)
+			end := start
+			for end < len(b) && b[end] != '\r' && b[end] != '\n' {
+				end++
+			}
+			if start < end {
+				ranges = append(ranges, RevealRange{start, end})
+			}
+			offset = end
+		}
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("dkim: reveal %q: no match", spec.Name)
+	}
+
+	return newReveal(spec.Name, b, ranges), nil
+}
+
+// revealNameRegexp matches reveal names. The names of the inputs of a reveal
+// are derived from it, and must be valid circom identifiers.
+var revealNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// revealSignalNames returns the names of the mask, start and end inputs of
+// the reveal name.
+func revealSignalNames(name string) (mask, start, end string) {
+	return name + "Mask", name + "Start", name + "End"
+}
+
+func checkRevealName(name string) error {
+	if name == "" {
+		return errors.New("dkim: reveal has no name")
+	}
+	if !revealNameRegexp.MatchString(name) {
+		return fmt.Errorf("dkim: invalid reveal name %q", name)
+	}
+	mask, start, end := revealSignalNames(name)
+	for _, k := range []string{name, mask, start, end} {
+		if isFixedSignal(k) {
+			return fmt.Errorf("dkim: reveal %q conflicts with the input %q", name, k)
+		}
+	}
+	return nil
+}
+
+func newReveal(name string, b []byte, ranges []RevealRange) *Reveal {
+	reveal := &Reveal{
+		Name:   name,
+		Ranges: ranges,
+		Mask:   make([]byte, len(b)),
+	}
+	for _, r := range ranges {
+		for i := r.Start; i < r.End; i++ {
+			reveal.Mask[i] = 1
+		}
+		reveal.Value = append(reveal.Value, b[r.Start:r.End]...)
+	}
+	return reveal
+}
+
+// Check returns an error if the reveal doesn't match the canonicalized data
+// b.
+func (r *Reveal) Check(b []byte) error {
+	if len(r.Mask) != len(b) {
+		return fmt.Errorf("dkim: reveal %q: mask length %v doesn't match data length %v", r.Name, len(r.Mask), len(b))
+	}
+
+	var value []byte
+	for i, m := range r.Mask {
+		switch m {
+		case 0:
+		case 1:
+			value = append(value, b[i])
+		default:
+			return fmt.Errorf("dkim: reveal %q: invalid mask value %v", r.Name, m)
+		}
+	}
+
+	prev := 0
+	var ranged []byte
+	for _, rr := range r.Ranges {
+		if rr.Start < prev || rr.End <= rr.Start || rr.End > len(b) {
+			return fmt.Errorf("dkim: reveal %q: invalid range [%v, %v)", r.Name, rr.Start, rr.End)
+		}
+		for i := prev; i < rr.Start; i++ {
+			if r.Mask[i] != 0 {
+				return fmt.Errorf("dkim: reveal %q: mask doesn't match ranges", r.Name)
+			}
+		}
+		ranged = append(ranged, b[rr.Start:rr.End]...)
+		prev = rr.End
+	}
+
+	if !bytes.Equal(value, ranged) || !bytes.Equal(value, r.Value) {
+		return fmt.Errorf("dkim: reveal %q: revealed value doesn't match data", r.Name)
+	}
+	return nil
+}
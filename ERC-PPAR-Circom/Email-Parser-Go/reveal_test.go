@@ -0,0 +1,174 @@
+package dkim
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+const revealBody = "Hi,\r\n" +
+	"Approve recovery code: 482911\r\n" +
+	"Approve recovery code: 130577\r\n" +
+	"Bye\r\n"
+
+func TestFindReveal(t *testing.T) {
+	tests := []struct {
+		name   string
+		spec   RevealSpec
+		ranges []RevealRange
+		value  string
+	}{
+		{
+			name:   "anchor",
+			spec:   RevealSpec{Name: "code", Anchor: "recovery code: "},
+			ranges: []RevealRange{{28, 34}},
+			value:  "482911",
+		},
+		{
+			name:   "anchor all",
+			spec:   RevealSpec{Name: "code", Anchor: "recovery code: ", All: true},
+			ranges: []RevealRange{{28, 34}, {59, 65}},
+			value:  "482911130577",
+		},
+		{
+			name:   "regexp",
+			spec:   RevealSpec{Name: "code", Regexp: regexp.MustCompile(`\d{6}`)},
+			ranges: []RevealRange{{28, 34}},
+			value:  "482911",
+		},
+		{
+			name:   "regexp group",
+			spec:   RevealSpec{Name: "word", Regexp: regexp.MustCompile(`(recovery) code: 1`)},
+			ranges: []RevealRange{{44, 52}},
+			value:  "recovery",
+		},
+		{
+			name:   "regexp all",
+			spec:   RevealSpec{Name: "code", Regexp: regexp.MustCompile(`code: (\d+)`), All: true},
+			ranges: []RevealRange{{28, 34}, {59, 65}},
+			value:  "482911130577",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reveal, err := FindReveal([]byte(revealBody), &tc.spec)
+			if err != nil {
+				t.Fatalf("FindReveal() = %v", err)
+			}
+			if !reflect.DeepEqual(reveal.Ranges, tc.ranges) {
+				t.Errorf("Ranges = %v, want %v", reveal.Ranges, tc.ranges)
+			}
+			if string(reveal.Value) != tc.value {
+				t.Errorf("Value = %q, want %q", reveal.Value, tc.value)
+			}
+			if err := reveal.Check([]byte(revealBody)); err != nil {
+				t.Errorf("Check() = %v", err)
+			}
+		})
+	}
+}
+
+func TestFindReveal_invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		spec *RevealSpec
+	}{
+		{"nil", nil},
+		{"no name", &RevealSpec{Anchor: "code: "}},
+		{"dash in name", &RevealSpec{Name: "recovery-code", Anchor: "code: "}},
+		{"space in name", &RevealSpec{Name: "recovery code", Anchor: "code: "}},
+		{"leading digit", &RevealSpec{Name: "2fa", Anchor: "code: "}},
+		{"non-ascii name", &RevealSpec{Name: "c\u00f3digo", Anchor: "code: "}},
+		{"input name", &RevealSpec{Name: "body", Anchor: "code: "}},
+		{"derived input name", &RevealSpec{Name: "signatureTime", Regexp: regexp.MustCompile(`\d+`)}},
+		{"no pattern", &RevealSpec{Name: "code"}},
+		{"both patterns", &RevealSpec{Name: "code", Anchor: "code: ", Regexp: regexp.MustCompile(`\d+`)}},
+		{"no match", &RevealSpec{Name: "code", Anchor: "password: "}},
+		{"empty match", &RevealSpec{Name: "code", Regexp: regexp.MustCompile(`x*`)}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := FindReveal([]byte(revealBody), tc.spec); err == nil {
+				t.Error("FindReveal() = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestReveal_Check(t *testing.T) {
+	b := []byte(revealBody)
+	reveal, err := FindReveal(b, &RevealSpec{Name: "code", Anchor: "recovery code: "})
+	if err != nil {
+		t.Fatalf("FindReveal() = %v", err)
+	}
+
+	tampered := append([]byte(nil), b...)
+	tampered[30] = '0'
+	if err := reveal.Check(tampered); err == nil {
+		t.Error("Check() = nil with modified data")
+	}
+	if err := reveal.Check(b[:len(b)-1]); err == nil {
+		t.Error("Check() = nil with truncated data")
+	}
+
+	mask := append([]byte(nil), reveal.Mask...)
+	reveal.Mask[0] = 1
+	if err := reveal.Check(b); err == nil {
+		t.Error("Check() = nil with a mask revealing more than the ranges")
+	}
+	reveal.Mask = mask
+
+	reveal.Ranges = []RevealRange{{28, 33}}
+	if err := reveal.Check(b); err == nil {
+		t.Error("Check() = nil with ranges not matching the mask")
+	}
+}
+
+func TestBuildWitness_bodyReveals(t *testing.T) {
+	w := testWitness(t, testMessage, nil, &WitnessOptions{
+		BodyReveals: []*RevealSpec{{Name: "code", Anchor: "recovery code: "}},
+	})
+	if len(w.BodyReveals) != 1 {
+		t.Fatalf("got %v reveals, want 1", len(w.BodyReveals))
+	}
+	reveal := w.BodyReveals[0]
+	if string(reveal.Value) != "482911" {
+		t.Errorf("Value = %q, want %q", reveal.Value, "482911")
+	}
+	if err := reveal.Check(w.Body); err != nil {
+		t.Errorf("Check() = %v", err)
+	}
+
+	input := w.ClaimsInput()
+	for _, k := range []string{"codeMask", "codeStart", "codeEnd"} {
+		if _, ok := input[k]; !ok {
+			t.Errorf("claims input has no %q", k)
+		}
+		if _, ok := w.CombinedInput()[k]; ok {
+			t.Errorf("combined input has %q, which isn't declared by the circuit", k)
+		}
+	}
+	if mask := input["codeMask"].([]string); len(mask) != len(w.Body) {
+		t.Errorf("codeMask has %v values, want %v", len(mask), len(w.Body))
+	}
+
+	_, err := BuildWitness(bytes.NewReader(testSign(t, testMessage, nil)), &WitnessOptions{
+		LookupTXT:   testLookupTXT(t, testRSAKey.Public()),
+		BodyReveals: []*RevealSpec{{Name: "code", Anchor: "password: "}},
+	})
+	if err == nil {
+		t.Error("BuildWitness() = nil with an unmatched reveal")
+	}
+
+	_, err = BuildWitness(bytes.NewReader(testSign(t, testMessage, nil)), &WitnessOptions{
+		LookupTXT: testLookupTXT(t, testRSAKey.Public()),
+		BodyReveals: []*RevealSpec{
+			{Name: "code", Anchor: "recovery code: "},
+			{Name: "code", Regexp: regexp.MustCompile(`\d+`)},
+		},
+	})
+	if err == nil {
+		t.Error("BuildWitness() = nil with two reveals with the same name")
+	}
+}
@@ -60,14 +60,27 @@ type SignOptions struct {
 	//
 	// See RFC 6376 section 5.4.1 for recommended header fields.
 	HeaderKeys []string
+	// A predefined set of header fields to include in the signature, used if
+	// HeaderKeys is nil. The list is computed from the message header.
+	//
+	// This is optional.
+	HeaderPreset HeaderPreset
 
 	// The expiration time. A zero value means no expiration.
 	Expiration time.Time
 
+	// If CopyHeaderFields is set, a copy of the signed header fields is
+	// included in the signature's "z" tag, so that verifiers can tell which
+	// header fields were modified in transit.
+	CopyHeaderFields bool
+
 	// A list of query methods used to retrieve the public key.
 	//
 	// If nil, it is implicitly defined as QueryMethodDNSTXT.
 	QueryMethods []QueryMethod
+
+	// Now returns the signature time. If nil, the current time is used.
+	Now func() time.Time
 }
 
 // Signer generates a DKIM signature.
@@ -105,7 +118,8 @@ func NewSigner(options *SignOptions) (*Signer, error) {
 	if headerCan == "" {
 		headerCan = CanonicalizationSimple
 	}
-	if _, ok := canonicalizers[headerCan]; !ok {
+	headerCanonicalizer, ok := lookupCanonicalizer(headerCan)
+	if !ok {
 		return nil, fmt.Errorf("dkim: unknown header canonicalization %q", headerCan)
 	}
 
@@ -113,7 +127,8 @@ func NewSigner(options *SignOptions) (*Signer, error) {
 	if bodyCan == "" {
 		bodyCan = CanonicalizationSimple
 	}
-	if _, ok := canonicalizers[bodyCan]; !ok {
+	bodyCanonicalizer, ok := lookupCanonicalizer(bodyCan)
+	if !ok {
 		return nil, fmt.Errorf("dkim: unknown body canonicalization %q", bodyCan)
 	}
 
@@ -142,16 +157,18 @@ func NewSigner(options *SignOptions) (*Signer, error) {
 	}
 
 	if options.HeaderKeys != nil {
-		ok := false
-		for _, k := range options.HeaderKeys {
-			if strings.EqualFold(k, "From") {
-				ok = true
-				break
-			}
-		}
-		if !ok {
+		if !hasFromHeaderKey(options.HeaderKeys) {
 			return nil, fmt.Errorf("dkim: the From header field must be signed")
 		}
+	} else if options.HeaderPreset != "" {
+		if _, ok := headerPresets[options.HeaderPreset]; !ok {
+			return nil, fmt.Errorf("dkim: unknown header preset %q", options.HeaderPreset)
+		}
+	}
+
+	signTime := now()
+	if options.Now != nil {
+		signTime = options.Now()
 	}
 
 	done := make(chan error, 1)
@@ -180,7 +197,7 @@ func NewSigner(options *SignOptions) (*Signer, error) {
 
 		// Hash body
 		hasher := hash.New()
-		can := canonicalizers[bodyCan].CanonicalizeBody(hasher)
+		can := bodyCanonicalizer.CanonicalizeBody(hasher)
 		if _, err := io.Copy(can, br); err != nil {
 			closeReadWithError(err)
 			return
@@ -199,13 +216,18 @@ func NewSigner(options *SignOptions) (*Signer, error) {
 			"d":  options.Domain,
 			//"l": "", // TODO
 			"s": options.Selector,
-			"t": formatTime(now()),
-			//"z": "", // TODO
+			"t": formatTime(signTime),
 		}
 
 		var headerKeys []string
 		if options.HeaderKeys != nil {
 			headerKeys = options.HeaderKeys
+		} else if options.HeaderPreset != "" {
+			headerKeys = expandHeaderPreset(options.HeaderPreset, h)
+			if !hasFromHeaderKey(headerKeys) {
+				closeReadWithError(fmt.Errorf("dkim: the From header field must be signed"))
+				return
+			}
 		} else {
 			for _, kv := range h {
 				k, _ := parseHeaderField(kv)
@@ -233,6 +255,7 @@ func NewSigner(options *SignOptions) (*Signer, error) {
 		// Hash and sign headers
 		hasher.Reset()
 		picker := newHeaderPicker(h)
+		var copied []string
 		for _, k := range headerKeys {
 			kv := picker.Pick(k)
 			if kv == "" {
@@ -242,17 +265,22 @@ func NewSigner(options *SignOptions) (*Signer, error) {
 				// fields of that name are added.
 				continue
 			}
+			copied = append(copied, kv)
 
-			kv = canonicalizers[headerCan].CanonicalizeHeader(kv)
+			kv = headerCanonicalizer.CanonicalizeHeader(kv)
 			if _, err := io.WriteString(hasher, kv); err != nil {
 				closeReadWithError(err)
 				return
 			}
 		}
 
+		if options.CopyHeaderFields {
+			params["z"] = formatCopiedHeaderFields(copied)
+		}
+
 		params["b"] = ""
 		sigField := formatSignature(params)
-		sigField = canonicalizers[headerCan].CanonicalizeHeader(sigField)
+		sigField = headerCanonicalizer.CanonicalizeHeader(sigField)
 		sigField = strings.TrimRight(sigField, crlf)
 		if _, err := io.WriteString(hasher, sigField); err != nil {
 			closeReadWithError(err)
@@ -337,6 +365,15 @@ func formatSignature(params map[string]string) string {
 	return sig
 }
 
+func hasFromHeaderKey(keys []string) bool {
+	for _, k := range keys {
+		if asciiEqualFold(k, "From") {
+			return true
+		}
+	}
+	return false
+}
+
 func formatTagList(l []string) string {
 	return strings.Join(l, ":")
 }
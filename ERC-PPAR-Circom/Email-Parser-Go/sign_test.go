@@ -0,0 +1,64 @@
+package dkim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign_clock(t *testing.T) {
+	signed := testSign(t, testMessage, &SignOptions{Expiration: testTime.Add(time.Hour)})
+	if !bytes.Contains(signed, []byte("t=1700000000;")) {
+		t.Errorf("signature doesn't use the injected clock:\n%s", signed)
+	}
+
+	lookup := testLookupTXT(t, testRSAKey.Public())
+	tests := []struct {
+		name string
+		now  time.Time
+		ok   bool
+	}{
+		{"before expiration", testTime.Add(time.Minute), true},
+		{"after expiration", testTime.Add(2 * time.Hour), false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			verif := testVerify(t, signed, &VerifyOptions{LookupTXT: lookup, Now: func() time.Time { return tc.now }})
+			if tc.ok && verif.Err != nil {
+				t.Errorf("Verification.Err = %v", verif.Err)
+			} else if !tc.ok && !IsPermFail(verif.Err) {
+				t.Errorf("Verification.Err = %v, want a permanent failure", verif.Err)
+			}
+			if !verif.Expiration.Equal(testTime.Add(time.Hour)) {
+				t.Errorf("Verification.Expiration = %v, want %v", verif.Expiration, testTime.Add(time.Hour))
+			}
+		})
+	}
+
+	// Signing twice at the same time gives the same signature
+	if again := testSign(t, testMessage, &SignOptions{Expiration: testTime.Add(time.Hour)}); !bytes.Equal(again, signed) {
+		t.Error("signing the same message at the same time gives different signatures")
+	}
+}
+
+func TestSign_invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		options SignOptions
+	}{
+		{"no domain", SignOptions{Selector: testSelector, Signer: testRSAKey}},
+		{"no selector", SignOptions{Domain: testDomain, Signer: testRSAKey}},
+		{"no signer", SignOptions{Domain: testDomain, Selector: testSelector}},
+		{"From not signed", SignOptions{Domain: testDomain, Selector: testSelector, Signer: testRSAKey, HeaderKeys: []string{"Subject"}}},
+		{"unknown canonicalization", SignOptions{Domain: testDomain, Selector: testSelector, Signer: testRSAKey, HeaderCanonicalization: "nofws"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := Sign(&b, strings.NewReader(testMessage), &tc.options); err == nil {
+				t.Error("Sign() = nil, want an error")
+			}
+		})
+	}
+}
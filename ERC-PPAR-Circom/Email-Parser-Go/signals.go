@@ -0,0 +1,593 @@
+package dkim
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// A Signal is a circuit input signal, either a single field element or an
+// array of them.
+type Signal struct {
+	Name   string
+	Public bool
+	// Scalar is true if the signal isn't an array. Values then has exactly
+	// one element.
+	Scalar bool
+	Values []*big.Int
+}
+
+// A SignalLayout describes a signal without its values. Layouts are needed
+// to decode witness formats which don't name the signals.
+type SignalLayout struct {
+	Name   string `json:"name"`
+	Public bool   `json:"public,omitempty"`
+	Scalar bool   `json:"scalar,omitempty"`
+	// The number of elements, one for a scalar signal.
+	Len int `json:"len"`
+}
+
+// Layout returns the layout of signals.
+func Layout(signals []Signal) []SignalLayout {
+	layout := make([]SignalLayout, len(signals))
+	for i, s := range signals {
+		layout[i] = SignalLayout{
+			Name:   s.Name,
+			Public: s.Public,
+			Scalar: s.Scalar,
+			Len:    len(s.Values),
+		}
+	}
+	return layout
+}
+
+func (l *SignalLayout) check() error {
+	if l.Len < 0 || l.Scalar && l.Len != 1 {
+		return fmt.Errorf("dkim: invalid layout for signal %q", l.Name)
+	}
+	return nil
+}
+
+func (l *SignalLayout) signal(values []*big.Int) Signal {
+	return Signal{
+		Name:   l.Name,
+		Public: l.Public,
+		Scalar: l.Scalar,
+		Values: values,
+	}
+}
+
+// The limb size, in bits, and the number of limbs of the big integers given
+// to the rsa_verify circuit.
+const (
+	limbBits  = 64
+	hashLimbs = 4
+	rsaLimbs  = 32
+)
+
+var signatureSignalNames = []string{"exp", "sign", "modulus", "hashed"}
+
+// combinedSignalNames are the inputs of the CombinedProof template, in the
+// order of its declarations in circuits/other-circuit/combined.circom.
+var combinedSignalNames = []string{
+	"body",
+	"bodyHash",
+	"header",
+	"gmailHash",
+	"headerHash",
+}
+
+// claimSignalNames are the claims inputs which don't come from a reveal, see
+// ClaimsInput.
+var claimSignalNames = []string{"signatureTime", "signatureTimeStart", "signatureTimeEnd", "bodyLength"}
+
+// publicCombinedSignals are the public inputs of the combined circuit, as
+// listed by its main component in circuits/other-circuit/combined_test.circom:
+// the hashes, which the contract checks against the recovery request.
+var publicCombinedSignals = map[string]bool{
+	"gmailHash":  true,
+	"headerHash": true,
+	"bodyHash":   true,
+}
+
+// isFixedSignal returns true if name is one of the inputs which don't come
+// from a reveal.
+func isFixedSignal(name string) bool {
+	for _, names := range [][]string{signatureSignalNames, combinedSignalNames, claimSignalNames} {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SignatureSignals returns the inputs of the rsa_verify circuit, see
+// SignatureInput, in the order they are declared by the circuit. They are all
+// public.
+func (w *Witness) SignatureSignals() ([]Signal, error) {
+	return inputSignals(w.SignatureInput(), signatureSignalNames, func(string) bool { return true })
+}
+
+// CombinedSignals returns the inputs of the combined circuit, see
+// CombinedInput, in the order they are declared by the circuit. The
+// gmailHash, headerHash and bodyHash inputs are public, the header and body
+// are private.
+func (w *Witness) CombinedSignals() ([]Signal, error) {
+	return inputSignals(w.CombinedInput(), combinedSignalNames, func(name string) bool { return publicCombinedSignals[name] })
+}
+
+// ClaimSignals returns the claims inputs, see ClaimsInput: the signature
+// time and the body length, followed by the inputs of the body reveals, in
+// order. They aren't circuit inputs, and aren't public.
+func (w *Witness) ClaimSignals() ([]Signal, error) {
+	names := claimSignalNames
+	for _, reveal := range w.BodyReveals {
+		mask, start, end := revealSignalNames(reveal.Name)
+		names = append(names[:len(names):len(names)], mask, start, end)
+	}
+	return inputSignals(w.ClaimsInput(), names, func(string) bool { return false })
+}
+
+// inputSignals converts JSON circuit inputs, as returned by SignatureInput
+// and CombinedInput, to signals. Names missing from input are skipped, and
+// public reports whether an input is public.
+func inputSignals(input map[string]interface{}, names []string, public func(name string) bool) ([]Signal, error) {
+	var signals []Signal
+	for _, name := range names {
+		v, ok := input[name]
+		if !ok {
+			continue
+		}
+
+		s := Signal{Name: name, Public: public(name)}
+		var values []string
+		switch v := v.(type) {
+		case string:
+			s.Scalar = true
+			values = []string{v}
+		case []string:
+			values = v
+		default:
+			return nil, fmt.Errorf("dkim: unsupported value for input %q", name)
+		}
+		for _, str := range values {
+			n, ok := new(big.Int).SetString(str, 10)
+			if !ok {
+				return nil, fmt.Errorf("dkim: malformed value for input %q", name)
+			}
+			s.Values = append(s.Values, n)
+		}
+		signals = append(signals, s)
+	}
+	if len(signals) != len(input) {
+		return nil, errors.New("dkim: unexpected circuit input")
+	}
+	return signals, nil
+}
+
+// SignalsInput converts signals to JSON circuit inputs, as expected by
+// snarkjs.
+func SignalsInput(signals []Signal) map[string]interface{} {
+	input := make(map[string]interface{}, len(signals))
+	for _, s := range signals {
+		if s.Scalar && len(s.Values) == 1 {
+			input[s.Name] = s.Values[0].String()
+		} else {
+			input[s.Name] = BigToString(s.Values)
+		}
+	}
+	return input
+}
+
+// ArrayToBigInt is the inverse of BigIntToArray: it combines k limbs of n
+// bits, least significant first. It fails if a limb doesn't fit in n bits.
+func ArrayToBigInt(n int, limbs []*big.Int) (*big.Int, error) {
+	x := new(big.Int)
+	for i := len(limbs) - 1; i >= 0; i-- {
+		limb := limbs[i]
+		if limb == nil || limb.Sign() < 0 || limb.BitLen() > n {
+			return nil, fmt.Errorf("dkim: limb %v doesn't fit in %v bits", i, n)
+		}
+		x.Lsh(x, uint(n))
+		x.Or(x, limb)
+	}
+	return x, nil
+}
+
+// WitnessFromSignals rebuilds a witness from the inputs of the rsa_verify
+// and combined circuits and from the claims inputs, as returned by
+// SignatureSignals, CombinedSignals and ClaimSignals. It fails if the inputs
+// duplicating each other don't match, e.g. the header hash of both circuits,
+// but the hashes and the signature aren't checked: see AuditSignals. If
+// claims is nil, the witness has no body reveals and the claims aren't
+// checked: only the length of the body is checked against the body length
+// tag.
+//
+// The domain, selector, signature time and body length are read back from
+// the signature field at the end of the header, and the From address is
+// extracted again from the header. The key flags, the position of the
+// signature in the message, the MIME decoded text of the body reveals and the
+// DNSSEC proof aren't part of the circuit inputs: Testing is false,
+// SignatureIndex is zero, Text and KeyProof are nil.
+func WitnessFromSignals(signature, combined, claims []Signal) (*Witness, error) {
+	d, err := decodeSignals(signature, combined, claims)
+	if err != nil {
+		return nil, err
+	}
+	for _, check := range []func() error{d.checkHeaderHash, d.checkTime, d.checkBodyLength, d.checkFrom, d.checkReveals} {
+		if err := check(); err != nil {
+			return nil, err
+		}
+	}
+	return d.w, nil
+}
+
+// decodedSignals is a witness rebuilt from circuit inputs, along with the
+// inputs duplicating its data, which may not match.
+type decodedSignals struct {
+	w *Witness
+	// The tags of the signature field ending the header.
+	params map[string]string
+
+	headerHash []byte
+	gmailHash  []byte
+	// The signatureTime and bodyLength claims, nil if missing.
+	time       *int64
+	bodyLength *int64
+	// The mask inputs of the body reveals.
+	masks map[string][]byte
+	// hasClaims is true if the claims inputs were given.
+	hasClaims bool
+	// The error returned when looking for the From address in the header.
+	fromErr error
+}
+
+func decodeSignals(signature, combined, claims []Signal) (*decodedSignals, error) {
+	sig := signalMap(signature)
+	comb := signalMap(combined)
+	claimed := signalMap(claims)
+	w := new(Witness)
+	d := &decodedSignals{w: w, masks: make(map[string][]byte), hasClaims: claims != nil}
+
+	var err error
+	if w.Exponent, err = limbsSignal(sig, "exp", rsaLimbs); err != nil {
+		return nil, err
+	}
+	if w.Signature, err = limbsSignal(sig, "sign", rsaLimbs); err != nil {
+		return nil, err
+	}
+	if w.Modulus, err = limbsSignal(sig, "modulus", rsaLimbs); err != nil {
+		return nil, err
+	}
+	hashed, err := limbsSignal(sig, "hashed", hashLimbs)
+	if err != nil {
+		return nil, err
+	}
+	w.HeaderHash = hashed.FillBytes(make([]byte, limbBits*hashLimbs/8))
+
+	if w.Header, err = bytesSignal(comb, "header"); err != nil {
+		return nil, err
+	}
+	if w.Body, err = bytesSignal(comb, "body"); err != nil {
+		return nil, err
+	}
+	if d.headerHash, err = hashSignal(comb, "headerHash"); err != nil {
+		return nil, err
+	}
+	if w.BodyHash, err = hashSignal(comb, "bodyHash"); err != nil {
+		return nil, err
+	}
+	if d.gmailHash, err = hashSignal(comb, "gmailHash"); err != nil {
+		return nil, err
+	}
+
+	if d.params, err = w.parseSignatureField(); err != nil {
+		return nil, err
+	}
+	if _, ok := claimed["signatureTime"]; ok {
+		t, err := scalarSignal(claimed, "signatureTime")
+		if err != nil {
+			return nil, err
+		}
+		start, err := scalarSignal(claimed, "signatureTimeStart")
+		if err != nil {
+			return nil, err
+		}
+		end, err := scalarSignal(claimed, "signatureTimeEnd")
+		if err != nil {
+			return nil, err
+		}
+		d.time = &t
+		w.TimeRange = RevealRange{int(start), int(end)}
+	}
+	if _, ok := claimed["bodyLength"]; ok {
+		l, err := scalarSignal(claimed, "bodyLength")
+		if err != nil {
+			return nil, err
+		}
+		d.bodyLength = &l
+	}
+
+	if from, err := FindFromAddress(w.Header); err != nil {
+		d.fromErr = err
+	} else {
+		w.Gmail = from.Value
+	}
+
+	for _, s := range claims {
+		name, ok := strings.CutSuffix(s.Name, "Mask")
+		if !ok || s.Scalar {
+			continue
+		}
+		reveal, mask, err := revealSignals(claimed, name, w.Body)
+		if err != nil {
+			return nil, err
+		}
+		w.BodyReveals = append(w.BodyReveals, reveal)
+		d.masks[name] = mask
+	}
+
+	return d, nil
+}
+
+// checkHeaderHash checks that both circuits get the same header hash.
+func (d *decodedSignals) checkHeaderHash() error {
+	if !bytes.Equal(d.headerHash, d.w.HeaderHash) {
+		return errors.New("dkim: header hash inputs of the circuits don't match")
+	}
+	return nil
+}
+
+// checkTime checks the signature time claims against the signature field,
+// if the claims were given.
+func (d *decodedSignals) checkTime() error {
+	w := d.w
+	switch {
+	case !d.hasClaims:
+		return nil
+	case d.time == nil && w.Time.IsZero():
+		return nil
+	case d.time == nil:
+		return errors.New("dkim: signature has a time but the signature time claim is missing")
+	case w.Time.IsZero():
+		return errors.New("dkim: signature time claim given but the signature has no time")
+	case *d.time != w.Time.Unix():
+		return errors.New("dkim: signature time claim doesn't match the signature")
+	}
+
+	r := w.TimeRange
+	if r.Start < 0 || r.Start >= r.End || r.End > len(w.Header) {
+		return errors.New("dkim: invalid signature time range")
+	}
+	if t, err := parseTime(string(w.Header[r.Start:r.End])); err != nil || !t.Equal(w.Time) {
+		return errors.New("dkim: signature time range doesn't match the signature time tag")
+	}
+	return nil
+}
+
+// checkBodyLength checks the body against the signature field, and the body
+// length claim against both if the claims were given.
+func (d *decodedSignals) checkBodyLength() error {
+	w := d.w
+	if w.Partial && int64(len(w.Body)) != w.BodyLength {
+		return errors.New("dkim: body length doesn't match the signature body length tag")
+	}
+	switch {
+	case !d.hasClaims:
+		return nil
+	case d.bodyLength == nil && !w.Partial:
+		return nil
+	case d.bodyLength == nil:
+		return errors.New("dkim: signature has a body length but the body length claim is missing")
+	case !w.Partial:
+		return errors.New("dkim: body length claim given but the signature has no body length")
+	case *d.bodyLength != w.BodyLength:
+		return errors.New("dkim: body length claim doesn't match the signature")
+	}
+	return nil
+}
+
+// checkFrom checks that the From address found in the header is the one of
+// the From field picked by verifiers, i.e. the last one, and checks the From
+// address hash input against it.
+func (d *decodedSignals) checkFrom() error {
+	if d.fromErr != nil {
+		return d.fromErr
+	}
+
+	// The address found by scanning the header must be the one of the From
+	// field a verifier picks, otherwise the inputs could attest an address
+	// the signer never vouched for
+	raw, err := ReadRawHeader(bufio.NewReader(bytes.NewReader(d.w.Header)))
+	if err != nil {
+		return err
+	}
+	kv := newHeaderPicker(raw.header()).Pick("from")
+	if kv == "" {
+		return errors.New("dkim: no From field in header")
+	}
+	_, value := parseHeaderField(kv)
+	from, err := ParseFromAddress(value)
+	if err != nil {
+		return err
+	}
+	if from.Address != string(d.w.Gmail) {
+		return fmt.Errorf("dkim: From address %q found in the header isn't the one of the From field, %q", d.w.Gmail, from.Address)
+	}
+
+	high, low := prepareHashInput([]byte(from.Address))
+	want := append(high.FillBytes(make([]byte, 16)), low.FillBytes(make([]byte, 16))...)
+	if subtle.ConstantTimeCompare(d.gmailHash, want) != 1 {
+		return errors.New("dkim: From address hash input doesn't match the From field")
+	}
+	return nil
+}
+
+// checkReveals checks the mask inputs of the body reveals against their
+// ranges.
+func (d *decodedSignals) checkReveals() error {
+	for _, reveal := range d.w.BodyReveals {
+		if !bytes.Equal(reveal.Mask, d.masks[reveal.Name]) {
+			return fmt.Errorf("dkim: reveal %q: mask doesn't match ranges", reveal.Name)
+		}
+		if err := reveal.Check(d.w.Body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSignatureField sets the fields of w found in the canonicalized
+// signature field ending the header, and returns its tags.
+func (w *Witness) parseSignatureField() (map[string]string, error) {
+	i := bytes.LastIndex(w.Header, []byte(crlf))
+	for i >= 0 && i+2 < len(w.Header) && (w.Header[i+2] == ' ' || w.Header[i+2] == '\t') {
+		i = bytes.LastIndex(w.Header[:i], []byte(crlf))
+	}
+	start := 0
+	if i >= 0 {
+		start = i + len(crlf)
+	}
+	k, v := parseHeaderField(string(w.Header[start:]))
+	if !asciiEqualFold(k, headerFieldName) {
+		return nil, errors.New("dkim: header doesn't end with a signature field")
+	}
+	params, err := parseHeaderParams(v)
+	if err != nil {
+		return nil, permFailError("malformed signature tags: " + err.Error())
+	}
+
+	w.Domain = stripWhitespace(params["d"])
+	w.Selector = stripWhitespace(params["s"])
+	w.HeaderCanonicalization, w.BodyCanonicalization = parseCanonicalization(params["c"])
+	if s, ok := params["t"]; ok {
+		if w.Time, err = parseTime(s); err != nil {
+			return nil, permFailError("malformed time: " + err.Error())
+		}
+	}
+	bodyLength, err := parseBodyLength(params, true)
+	if err != nil {
+		return nil, err
+	}
+	if bodyLength >= 0 {
+		w.Partial = true
+		w.BodyLength = bodyLength
+	}
+	return params, nil
+}
+
+func signalMap(signals []Signal) map[string]*Signal {
+	m := make(map[string]*Signal, len(signals))
+	for i := range signals {
+		m[signals[i].Name] = &signals[i]
+	}
+	return m
+}
+
+func getSignal(signals map[string]*Signal, name string) (*Signal, error) {
+	s, ok := signals[name]
+	if !ok {
+		return nil, fmt.Errorf("dkim: missing input %q", name)
+	}
+	return s, nil
+}
+
+func limbsSignal(signals map[string]*Signal, name string, k int) (*big.Int, error) {
+	s, err := getSignal(signals, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Values) != k {
+		return nil, fmt.Errorf("dkim: input %q has %v limbs, expected %v", name, len(s.Values), k)
+	}
+	x, err := ArrayToBigInt(limbBits, s.Values)
+	if err != nil {
+		return nil, fmt.Errorf("dkim: input %q: %v", name, strings.TrimPrefix(err.Error(), "dkim: "))
+	}
+	return x, nil
+}
+
+func bytesSignal(signals map[string]*Signal, name string) ([]byte, error) {
+	s, err := getSignal(signals, name)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, len(s.Values))
+	for i, v := range s.Values {
+		if v.Sign() < 0 || v.BitLen() > 8 {
+			return nil, fmt.Errorf("dkim: input %q has a value which isn't a byte", name)
+		}
+		b[i] = byte(v.Uint64())
+	}
+	return b, nil
+}
+
+// hashSignal decodes a SHA-256 hash split into its high and low 128 bits.
+func hashSignal(signals map[string]*Signal, name string) ([]byte, error) {
+	s, err := getSignal(signals, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Values) != 2 {
+		return nil, fmt.Errorf("dkim: input %q must have 2 values", name)
+	}
+	h := make([]byte, 32)
+	for i, v := range s.Values {
+		if v.Sign() < 0 || v.BitLen() > 128 {
+			return nil, fmt.Errorf("dkim: input %q has a value which doesn't fit in 128 bits", name)
+		}
+		v.FillBytes(h[i*16 : (i+1)*16])
+	}
+	return h, nil
+}
+
+func scalarSignal(signals map[string]*Signal, name string) (int64, error) {
+	s, err := getSignal(signals, name)
+	if err != nil {
+		return 0, err
+	}
+	if len(s.Values) != 1 || !s.Values[0].IsInt64() {
+		return 0, fmt.Errorf("dkim: malformed input %q", name)
+	}
+	return s.Values[0].Int64(), nil
+}
+
+// revealSignals returns the reveal described by the range inputs, and its
+// mask input.
+func revealSignals(signals map[string]*Signal, name string, body []byte) (*Reveal, []byte, error) {
+	if err := checkRevealName(name); err != nil {
+		return nil, nil, err
+	}
+	maskName, startName, endName := revealSignalNames(name)
+	mask, err := bytesSignal(signals, maskName)
+	if err != nil {
+		return nil, nil, err
+	}
+	starts, err := getSignal(signals, startName)
+	if err != nil {
+		return nil, nil, err
+	}
+	ends, err := getSignal(signals, endName)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(starts.Values) != len(ends.Values) {
+		return nil, nil, fmt.Errorf("dkim: reveal %q has %v starts and %v ends", name, len(starts.Values), len(ends.Values))
+	}
+
+	var ranges []RevealRange
+	for i := range starts.Values {
+		start, end := starts.Values[i], ends.Values[i]
+		if !start.IsInt64() || !end.IsInt64() || start.Sign() < 0 || start.Cmp(end) > 0 || end.Int64() > int64(len(body)) {
+			return nil, nil, fmt.Errorf("dkim: reveal %q has an invalid range", name)
+		}
+		ranges = append(ranges, RevealRange{int(start.Int64()), int(end.Int64())})
+	}
+	return newReveal(name, body, ranges), mask, nil
+}
@@ -0,0 +1,185 @@
+package dkim
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// testPartialWitness returns the witness of a message signed with a body
+// length tag and a signature time, with a body reveal: it has every kind of
+// combined circuit input and claim.
+func testPartialWitness(t *testing.T) *Witness {
+	t.Helper()
+	prefix := "Hi,\r\n\r\nApprove recovery code: 482911\r\n"
+	signed := testSignBodyLength(t, testMessage, int64(len(prefix)), "Appended\r\n")
+	w, err := BuildWitness(bytes.NewReader(signed), &WitnessOptions{
+		LookupTXT:       testLookupTXT(t, testRSAKey.Public()),
+		AllowBodyLength: true,
+		BodyReveals:     []*RevealSpec{{Name: "code", Anchor: "recovery code: "}},
+	})
+	if err != nil {
+		t.Fatalf("BuildWitness() = %v", err)
+	}
+	if w.Time.IsZero() || !w.Partial || len(w.BodyReveals) != 1 {
+		t.Fatalf("witness is missing a signature time, a body length or a reveal")
+	}
+	return w
+}
+
+// testSignals returns the inputs of both circuits and the claims inputs for
+// w.
+func testSignals(t *testing.T, w *Witness) (signature, combined, claims []Signal) {
+	t.Helper()
+	signature, err := w.SignatureSignals()
+	if err != nil {
+		t.Fatalf("SignatureSignals() = %v", err)
+	}
+	combined, err = w.CombinedSignals()
+	if err != nil {
+		t.Fatalf("CombinedSignals() = %v", err)
+	}
+	claims, err = w.ClaimSignals()
+	if err != nil {
+		t.Fatalf("ClaimSignals() = %v", err)
+	}
+	return signature, combined, claims
+}
+
+// checkDecodedWitness checks that a witness decoded from circuit inputs
+// matches the original one. Only the data part of the inputs is compared.
+func checkDecodedWitness(t *testing.T, got, want *Witness) {
+	t.Helper()
+	fields := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"Domain", got.Domain, want.Domain},
+		{"Selector", got.Selector, want.Selector},
+		{"Header", got.Header, want.Header},
+		{"HeaderHash", got.HeaderHash, want.HeaderHash},
+		{"Time", got.Time.Unix(), want.Time.Unix()},
+		{"TimeRange", got.TimeRange, want.TimeRange},
+		{"Body", got.Body, want.Body},
+		{"BodyHash", got.BodyHash, want.BodyHash},
+		{"Partial", got.Partial, want.Partial},
+		{"BodyLength", got.BodyLength, want.BodyLength},
+		{"Signature", got.Signature.String(), want.Signature.String()},
+		{"Modulus", got.Modulus.String(), want.Modulus.String()},
+		{"Exponent", got.Exponent.String(), want.Exponent.String()},
+		{"Gmail", got.Gmail, want.Gmail},
+		{"reveals", len(got.BodyReveals), len(want.BodyReveals)},
+	}
+	for _, f := range fields {
+		if !reflect.DeepEqual(f.got, f.want) {
+			t.Errorf("decoded %v = %v, want %v", f.name, f.got, f.want)
+		}
+	}
+	for i := 0; i < len(got.BodyReveals) && i < len(want.BodyReveals); i++ {
+		g, w := got.BodyReveals[i], want.BodyReveals[i]
+		if g.Name != w.Name || !reflect.DeepEqual(g.Ranges, w.Ranges) || !bytes.Equal(g.Value, w.Value) || !bytes.Equal(g.Mask, w.Mask) {
+			t.Errorf("decoded reveal %v = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestCombinedSignals_public(t *testing.T) {
+	w := testPartialWitness(t)
+	signature, combined, _ := testSignals(t, w)
+
+	for _, s := range signature {
+		if !s.Public {
+			t.Errorf("signature input %q is private, want public", s.Name)
+		}
+	}
+	public := map[string]bool{
+		"gmailHash":  true,
+		"headerHash": true,
+		"bodyHash":   true,
+	}
+	found := 0
+	for _, s := range combined {
+		if s.Public != public[s.Name] {
+			t.Errorf("combined input %q public = %v, want %v", s.Name, s.Public, public[s.Name])
+		}
+		if public[s.Name] {
+			found++
+		}
+	}
+	if found != len(public) {
+		t.Errorf("found %v public combined inputs, want %v", found, len(public))
+	}
+
+	// The public inputs are kept when reading the JSON input back
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(SignalsInput(combined)); err != nil {
+		t.Fatalf("Encode() = %v", err)
+	}
+	read, err := ReadCircuitInput(&b, false)
+	if err != nil {
+		t.Fatalf("ReadCircuitInput() = %v", err)
+	}
+	for _, s := range read {
+		if s.Public != public[s.Name] {
+			t.Errorf("ReadCircuitInput() input %q public = %v, want %v", s.Name, s.Public, public[s.Name])
+		}
+	}
+}
+
+// TestCombinedSignals_circuit checks the combined inputs against the
+// declarations of the circuit: the inputs of the CombinedProof template, and
+// the public inputs of its main component.
+func TestCombinedSignals_circuit(t *testing.T) {
+	template, err := os.ReadFile("../circuits/other-circuit/combined.circom")
+	if err != nil {
+		t.Fatalf("ReadFile() = %v", err)
+	}
+	_, body, ok := strings.Cut(string(template), "template CombinedProof(")
+	if !ok {
+		t.Fatalf("combined.circom has no CombinedProof template")
+	}
+	body, _, _ = strings.Cut(body, "\ntemplate ")
+	var inputs []string
+	for _, m := range regexp.MustCompile(`signal\s+input\s+(\w+)`).FindAllStringSubmatch(body, -1) {
+		inputs = append(inputs, m[1])
+	}
+	if !reflect.DeepEqual(inputs, combinedSignalNames) {
+		t.Errorf("CombinedProof inputs = %v, want %v", inputs, combinedSignalNames)
+	}
+
+	main, err := os.ReadFile("../circuits/other-circuit/combined_test.circom")
+	if err != nil {
+		t.Fatalf("ReadFile() = %v", err)
+	}
+	m := regexp.MustCompile(`component\s+main\s*\{\s*public\s*\[([^\]]*)\]\s*\}\s*=\s*CombinedProof\(`).FindStringSubmatch(string(main))
+	if m == nil {
+		t.Fatalf("combined_test.circom has no CombinedProof main component")
+	}
+	public := make(map[string]bool)
+	for _, name := range strings.Split(m[1], ",") {
+		public[strings.TrimSpace(name)] = true
+	}
+	if !reflect.DeepEqual(public, publicCombinedSignals) {
+		t.Errorf("public inputs of the main component = %v, want %v", public, publicCombinedSignals)
+	}
+}
+
+// signalsEqual returns true if both lists have the same signals, with the
+// same values.
+func signalsEqual(a, b []Signal) bool {
+	if !reflect.DeepEqual(Layout(a), Layout(b)) {
+		return false
+	}
+	for i := range a {
+		for j := range a[i].Values {
+			if a[i].Values[j].Cmp(b[i].Values[j]) != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
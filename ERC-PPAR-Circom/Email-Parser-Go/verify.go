@@ -6,8 +6,6 @@ import (
 	"crypto/subtle"
 	"encoding/base64"
 	"errors"
-	"fmt"
-	// "fmt"
 	"io"
 	"io/ioutil"
 	"regexp"
@@ -56,6 +54,24 @@ func isFail(err error) bool {
 	return ok
 }
 
+type policyError string
+
+func (err policyError) Error() string {
+	return "dkim: " + string(err)
+}
+
+// IsPolicyFail returns true if the error returned by Verify is a policy
+// failure, i.e. the signature is valid but was rejected because of the
+// verification options. Invalid signatures are reported as such, whatever
+// the options.
+//
+// BuildWitness, which doesn't verify signatures, returns policy failures
+// before checking the body hash.
+func IsPolicyFail(err error) bool {
+	_, ok := err.(policyError)
+	return ok
+}
+
 // ErrTooManySignatures is returned by Verify when the message exceeds the
 // maximum number of signatures.
 var ErrTooManySignatures = errors.New("dkim: too many signatures")
@@ -71,15 +87,56 @@ type Verification struct {
 	// The Agent or User Identifier (AUID) on behalf of which the SDID is taking
 	// responsibility.
 	Identifier string
+	// The selector subdividing the namespace for the domain.
+	Selector string
+	// The signature data, as the base64 value of the "b" tag without
+	// whitespace.
+	Signature string
 
 	// The list of signed header fields.
 	HeaderKeys []string
 
+	// The signing algorithm, e.g. "rsa-sha256".
+	Algorithm string
+	// Header and body canonicalization algorithms.
+	HeaderCanonicalization Canonicalization
+	BodyCanonicalization   Canonicalization
+	// The body hash, decoded from the "bh" tag.
+	BodyHash []byte
+	// The raw DKIM-Signature tags.
+	Params map[string]string
+
+	// The public key algorithm ("rsa" or "ed25519") and size in bits of the
+	// key record. Only set if the key could be retrieved.
+	KeyAlgorithm string
+	KeySize      int
+	// The notes and flags of the key record, i.e. its "n" and "t" tags.
+	KeyNotes string
+	KeyFlags []string
+	// Testing is true if the key record has the "y" flag: the domain is
+	// testing DKIM and the signature must not be trusted.
+	Testing bool
+	// KeyRecords are the TXT records returned when looking up the key, with
+	// their individual strings if VerifyOptions.LookupTXTStrings is set.
+	KeyRecords [][]string
+
+	// HeaderDiffs lists the header fields modified since signing, according
+	// to the copies in the signature's "z" tag. It's only set if the
+	// signature failed to verify and VerifyOptions.DiagnoseHeaders is set.
+	HeaderDiffs []HeaderDiff
+
 	// The time that this signature was created. If unknown, it's set to zero.
 	Time time.Time
 	// The expiration time. If the signature doesn't expire, it's set to zero.
 	Expiration time.Time
 
+	// Partial is true if the signature has a body length tag and only covers
+	// the first BodyLength bytes of the canonicalized body. Content may have
+	// been appended to the signed body. This can only happen if
+	// VerifyOptions.AllowBodyLength is set.
+	Partial    bool
+	BodyLength int64
+
 	// Err is nil if the signature is valid.
 	Err error
 }
@@ -95,11 +152,50 @@ type VerifyOptions struct {
 	// LookupTXT returns the DNS TXT records for the given domain name. If nil,
 	// net.LookupTXT is used.
 	LookupTXT func(domain string) ([]string, error)
+	// LookupTXTStrings is like LookupTXT, but returns the individual strings
+	// of each TXT record. If set, it's used instead of LookupTXT.
+	LookupTXTStrings func(domain string) ([][]string, error)
+	// TXTRecordPolicy defines how multiple TXT records found for a key are
+	// handled. Defaults to TXTRecordStrict.
+	TXTRecordPolicy TXTRecordPolicy
+	// KeyCache caches the retrieved keys across verifications. If nil, keys
+	// are queried for each signature.
+	KeyCache *KeyCache
 	// MaxVerifications controls the maximum number of signature verifications
 	// to perform. If more signatures are present, the first MaxVerifications
 	// signatures are verified, the rest are ignored and ErrTooManySignatures
 	// is returned. If zero, there is no maximum.
 	MaxVerifications int
+	// MaxBodySize is the maximum size of the message body in bytes. Larger
+	// messages are rejected with ErrBodyTooLarge. If zero, there is no
+	// maximum.
+	MaxBodySize int64
+	// AllowBodyLength enables verification of signatures with a body length
+	// tag. Only the signed prefix of the body is hashed, and the resulting
+	// Verification is marked as Partial. If false, such signatures fail with
+	// a policy error.
+	AllowBodyLength bool
+	// RejectTestingKeys makes signatures whose key record has the "y" flag
+	// fail with a policy error, even if they are valid.
+	RejectTestingKeys bool
+	// Freshness restricts the signature time. If nil, only the "x" tag is
+	// checked.
+	Freshness *FreshnessPolicy
+	// DiagnoseHeaders enables the comparison of the received header fields
+	// with the copies in the "z" tag of signatures that fail to verify, see
+	// Verification.HeaderDiffs.
+	DiagnoseHeaders bool
+	// Now returns the reference time used to check expiration and freshness,
+	// e.g. the receipt time when verifying archived messages. If nil, the
+	// current time is used.
+	Now func() time.Time
+}
+
+func (options *VerifyOptions) currentTime() time.Time {
+	if options != nil && options.Now != nil {
+		return options.Now()
+	}
+	return now()
 }
 
 // Verify checks if a message's signatures are valid. It returns one
@@ -107,8 +203,6 @@ type VerifyOptions struct {
 //
 // There is no guarantee that the reader will be completely consumed.
 func Verify(r io.Reader) ([]*Verification, error) {
-	fmt.Println("Into Verify()")
-	fmt.Println("r: ", r)
 	return VerifyWithOptions(r, nil)
 }
 
@@ -116,27 +210,20 @@ func Verify(r io.Reader) ([]*Verification, error) {
 // verification options.
 func VerifyWithOptions(r io.Reader, options *VerifyOptions) ([]*Verification, error) {
 	// Read header
-	fmt.Println("Into VerifyWithOptions()")
 	bufr := bufio.NewReader(r)
 	h, err := readHeader(bufr)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("h: ", h)
-	// fmt.Println("bufr: ", bufr)
 
 	// Scan header fields for signatures
 	var signatures []*signature
 	for i, kv := range h {
-		k, v := parseHeaderField(kv)	
-		fmt.Println("k: ", k)
-		fmt.Println("v: ", v)
-		if strings.EqualFold(k, headerFieldName) {
-			fmt.Println("\nlast signature: ", &signatures)
+		k, v := parseHeaderField(kv)
+		if asciiEqualFold(k, headerFieldName) {
 			signatures = append(signatures, &signature{i, v})
 		}
 	}
-	fmt.Println("signatures: ", signatures[0])
 
 	tooManySignatures := false
 	if options != nil && options.MaxVerifications > 0 && len(signatures) > options.MaxVerifications {
@@ -144,32 +231,30 @@ func VerifyWithOptions(r io.Reader, options *VerifyOptions) ([]*Verification, er
 		signatures = signatures[:options.MaxVerifications]
 	}
 
+	var body io.Reader = bufr
+	if options != nil {
+		body = newBodyReader(bufr, options.MaxBodySize)
+	}
+
 	var verifs []*Verification
 	if len(signatures) == 1 {
 		// If there is only one signature - just verify it.
-		fmt.Println("Into verify()")
-		v, err := verify(h, bufr, h[signatures[0].i], signatures[0].v, options)
-		if err != nil && !IsTempFail(err) && !IsPermFail(err) && !isFail(err) {
+		v, err := verify(h, body, h[signatures[0].i], signatures[0].v, options)
+		if err != nil && !IsTempFail(err) && !IsPermFail(err) && !isFail(err) && !IsPolicyFail(err) {
 			return nil, err
 		}
-		fmt.Println("Out of verify()")
 		v.Err = err
 		verifs = []*Verification{v}
-		fmt.Println("verifs: ", verifs)
 	} else {
-		fmt.Println("Into parallelVerify()")
-		verifs, err = parallelVerify(bufr, h, signatures, options)
+		verifs, err = parallelVerify(body, h, signatures, options)
 		if err != nil {
 			return nil, err
 		}
-		fmt.Println("Out of parallelVerify()")
-		fmt.Println("verifs: ", verifs)
 	}
 
 	if tooManySignatures {
 		return verifs, ErrTooManySignatures
 	}
-	fmt.Println("Out of VerifyWithOptions()")
 	return verifs, nil
 }
 
@@ -192,20 +277,21 @@ func parallelVerify(r io.Reader, h header, signatures []*signature, options *Ver
 		pipeWriters[i] = pw
 
 		go func() {
-			fmt.Println("Into verify() from parallelVerify()")
 			v, err := verify(h, pr, h[sig.i], sig.v, options)
-			fmt.Println("v: ", v)
 			// Make sure we consume the whole reader, otherwise io.Copy on
 			// other side can block forever.
 			io.Copy(ioutil.Discard, pr)
 
 			v.Err = err
 			chans[i] <- v
-			fmt.Println("Out of verify() from parallelVerify()")
 		}()
 	}
 
 	if _, err := io.Copy(io.MultiWriter(writers...), r); err != nil {
+		// Unblock the verifying goroutines
+		for _, wr := range pipeWriters {
+			wr.CloseWithError(err)
+		}
 		return nil, err
 	}
 	for _, wr := range pipeWriters {
@@ -216,69 +302,62 @@ func parallelVerify(r io.Reader, h header, signatures []*signature, options *Ver
 	for i, ch := range chans {
 		verifications[i] = <-ch
 	}
-	fmt.Println("verifications: ", verifications)
 
 	// Return unexpected failures as a separate error.
 	for _, v := range verifications {
 		err := v.Err
-		if err != nil && !IsTempFail(err) && !IsPermFail(err) && !isFail(err) {
+		if err != nil && !IsTempFail(err) && !IsPermFail(err) && !isFail(err) && !IsPolicyFail(err) {
 			v.Err = nil
 			return verifications, err
 		}
 	}
-	fmt.Println("Out of parallelVerify()")
 	return verifications, nil
 }
 
 func verify(h header, r io.Reader, sigField, sigValue string, options *VerifyOptions) (*Verification, error) {
-	fmt.Println("h: ", h)
-	fmt.Println("r: ", r)
-	fmt.Println("sigField: ", sigField)
-	fmt.Println("sigValue: ", sigValue)
-	// fmt.Println("options: ", options)
 	verif := new(Verification)
 
 	params, err := parseHeaderParams(sigValue)
 	if err != nil {
 		return verif, permFailError("malformed signature tags: " + err.Error())
 	}
-	fmt.Println("params: ", params)
+	verif.Params = params
 
 	if params["v"] != "1" {
 		return verif, permFailError("incompatible signature version")
 	}
 
+	verif.Algorithm = stripWhitespace(params["a"])
+	headerCan, bodyCan := parseCanonicalization(params["c"])
+	verif.HeaderCanonicalization = headerCan
+	verif.BodyCanonicalization = bodyCan
+
 	verif.Domain = stripWhitespace(params["d"])
+	verif.Selector = stripWhitespace(params["s"])
+	verif.Signature = stripWhitespace(params["b"])
 	for _, tag := range requiredTags {
 		if _, ok := params[tag]; !ok {
-			fmt.Println("verif: ", verif)
 			return verif, permFailError("signature missing required tag")
 		}
 	}
-	fmt.Println("verif: ", verif)
 
 	if i, ok := params["i"]; ok {
 		verif.Identifier = stripWhitespace(i)
 		if !strings.HasSuffix(verif.Identifier, "@"+verif.Domain) && !strings.HasSuffix(verif.Identifier, "."+verif.Domain) {
-			fmt.Println("verif: ", verif)
 			return verif, permFailError("domain mismatch")
 		}
 	} else {
 		verif.Identifier = "@" + verif.Domain
 	}
-	fmt.Println("verif: ", verif)
 
 	headerKeys := parseTagList(params["h"])
-	fmt.Println("params: ", params["h"])
-	fmt.Println("headerKeys: ", headerKeys)
 	ok := false
 	for _, k := range headerKeys {
-		if strings.EqualFold(k, "from") {
+		if asciiEqualFold(k, "from") {
 			ok = true
 			break
 		}
 	}
-	fmt.Println("headerKeys: ", headerKeys)
 	if !ok {
 		return verif, permFailError("From field not signed")
 	}
@@ -297,38 +376,188 @@ func verify(h header, r io.Reader, sigField, sigValue string, options *VerifyOpt
 			return verif, permFailError("malformed expiration time: " + err.Error())
 		}
 		verif.Expiration = t
-		if now().After(t) {
+		if options.currentTime().After(t) {
 			return verif, permFailError("signature has expired")
 		}
 	}
 
 	// Query public key
 	// TODO: compute hash in parallel
+	res, hash, err := queryKey(verif.Domain, params, options)
+	if res != nil {
+		verif.KeyAlgorithm = res.KeyAlgo
+		verif.KeySize = res.KeySize()
+		verif.KeyNotes = res.Notes
+		verif.KeyFlags = res.Flags
+		verif.Testing = res.Testing()
+		verif.KeyRecords = res.Records
+	}
+	if err != nil {
+		return verif, err
+	}
+	if err := checkKeyFlags(res, verif.Domain, verif.Identifier); err != nil {
+		return verif, err
+	}
+
+	headerCanonicalizer, ok := lookupCanonicalizer(headerCan)
+	if !ok {
+		return verif, permFailError("unsupported header canonicalization algorithm")
+	}
+	bodyCanonicalizer, ok := lookupCanonicalizer(bodyCan)
+	if !ok {
+		return verif, permFailError("unsupported body canonicalization algorithm")
+	}
+
+	bodyLength, err := parseBodyLength(params, true)
+	if err != nil {
+		return verif, err
+	}
+	if bodyLength >= 0 {
+		verif.Partial = true
+		verif.BodyLength = bodyLength
+	}
+
+	// Parse body hash and signature
+	bodyHashed, err := decodeBase64String(params["bh"])
+	if err != nil {
+		return verif, permFailError("malformed body hash: " + err.Error())
+	}
+	verif.BodyHash = bodyHashed
+	sig, err := decodeBase64String(params["b"])
+	if err != nil {
+		return verif, permFailError("malformed signature: " + err.Error())
+	}
+	// Check body hash
+	hasher := hash.New()
+	bodyWriter, lw := limitBodyWriter(hasher, bodyLength)
+	if err := canonicalizeBody(bodyWriter, r, bodyCanonicalizer); err != nil {
+		return verif, err
+	}
+	if lw != nil && lw.N > 0 {
+		return verif, failError("body is shorter than the body length tag")
+	}
+	if subtle.ConstantTimeCompare(hasher.Sum(nil), bodyHashed) != 1 {
+		return verif, failError("body hash did not verify")
+	}
+
+	// Compute data hash
+	hasher.Reset()
+	if err := hashHeader(hasher, h, headerKeys, headerCanonicalizer, sigField); err != nil {
+		return verif, err
+	}
+	hashed := hasher.Sum(nil)
+	// Check signature
+	if err := res.Verifier.Verify(hash, hashed, sig); err != nil {
+		if z, ok := params["z"]; ok && options != nil && options.DiagnoseHeaders {
+			// The diagnosis is best-effort, a malformed "z" tag doesn't
+			// change the verification result
+			verif.HeaderDiffs, _ = diffCopiedHeaderFields(h, z, headerCanonicalizer)
+		}
+		return verif, failError("signature did not verify: " + err.Error())
+	}
+
+	// The signature is valid: it may still be rejected by the options
+	if err := options.checkPolicy(verif.Testing, verif.Partial, verif.Time); err != nil {
+		return verif, err
+	}
+	return verif, nil
+}
+
+// checkPolicy applies the options rejecting signatures of keys in testing
+// mode, with a body length tag, or too old.
+func (options *VerifyOptions) checkPolicy(testing, partial bool, t time.Time) error {
+	if options == nil {
+		return nil
+	}
+	if testing && options.RejectTestingKeys {
+		return errTestingKey
+	}
+	if partial && !options.AllowBodyLength {
+		return errInsecureBodyLength
+	}
+	if options.Freshness != nil {
+		return options.Freshness.check(t, options.currentTime())
+	}
+	return nil
+}
+
+// hashHeader writes the canonicalized header fields listed in headerKeys to
+// w, followed by the signature header field with an empty "b" tag.
+func hashHeader(w io.Writer, h header, headerKeys []string, can Canonicalizer, sigField string) error {
+	picker := newHeaderPicker(h)
+	for _, key := range headerKeys {
+		kv := picker.Pick(key)
+		if kv == "" {
+			// The field MAY contain names of header fields that do not exist
+			// when signed; nonexistent header fields do not contribute to the
+			// signature computation
+			continue
+		}
+		kv = can.CanonicalizeHeader(kv)
+		if _, err := io.WriteString(w, kv); err != nil {
+			return err
+		}
+	}
+	canSigField := removeSignature(sigField)
+	canSigField = can.CanonicalizeHeader(canSigField)
+	canSigField = strings.TrimRight(canSigField, "\r\n")
+	_, err := io.WriteString(w, canSigField)
+	return err
+}
+
+func parseTagList(s string) []string {
+	tags := strings.Split(s, ":")
+	for i, t := range tags {
+		tags[i] = stripWhitespace(t)
+	}
+	return tags
+}
+
+func (options *VerifyOptions) txtLookup() txtLookupFunc {
+	if options.LookupTXTStrings != nil {
+		return options.LookupTXTStrings
+	}
+	return lookupTXTStrings(options.LookupTXT)
+}
+
+// queryKey retrieves the public key of a signature from its "q" tag, and
+// checks that it can be used with the signature's "a" tag. It returns the key
+// and the hash algorithm to use. If the key was retrieved but can't be used,
+// it's returned along with the error.
+func queryKey(domain string, params map[string]string, options *VerifyOptions) (*queryResult, crypto.Hash, error) {
 	methods := []string{string(QueryMethodDNSTXT)}
 	if methodsStr, ok := params["q"]; ok {
 		methods = parseTagList(methodsStr)
 	}
 	var res *queryResult
+	var err error
 	for _, method := range methods {
 		if query, ok := queryMethods[QueryMethod(method)]; ok {
+			selector := stripWhitespace(params["s"])
+			lookup, policy := lookupTXTStrings(nil), TXTRecordStrict
 			if options != nil {
-				res, err = query(verif.Domain, stripWhitespace(params["s"]), options.LookupTXT)
+				lookup, policy = options.txtLookup(), options.TXTRecordPolicy
+			}
+			if options != nil && options.KeyCache != nil {
+				res, err = options.KeyCache.query(QueryMethod(method), domain, selector, func() (*queryResult, error) {
+					return query(domain, selector, lookup, policy)
+				})
 			} else {
-				res, err = query(verif.Domain, stripWhitespace(params["s"]), nil)
+				res, err = query(domain, selector, lookup, policy)
 			}
 			break
 		}
 	}
 	if err != nil {
-		return verif, err
+		return nil, 0, err
 	} else if res == nil {
-		return verif, permFailError("unsupported public key query method")
+		return nil, 0, permFailError("unsupported public key query method")
 	}
 
 	// Parse algos
 	keyAlgo, hashAlgo, ok := strings.Cut(stripWhitespace(params["a"]), "-")
 	if !ok {
-		return verif, permFailError("malformed algorithm name")
+		return res, 0, permFailError("malformed algorithm name")
 	}
 
 	// Check hash algo
@@ -341,7 +570,7 @@ func verify(h header, r io.Reader, sigField, sigValue string, options *VerifyOpt
 			}
 		}
 		if !ok {
-			return verif, permFailError("inappropriate hash algorithm")
+			return res, 0, permFailError("inappropriate hash algorithm")
 		}
 	}
 	var hash crypto.Hash
@@ -349,16 +578,15 @@ func verify(h header, r io.Reader, sigField, sigValue string, options *VerifyOpt
 	case "sha1":
 		// RFC 8301 section 3.1: rsa-sha1 MUST NOT be used for signing or
 		// verifying.
-		return verif, permFailError("hash algorithm too weak")
+		return res, 0, permFailError("hash algorithm too weak")
 	case "sha256":
 		hash = crypto.SHA256
 	default:
-		return verif, permFailError("unsupported hash algorithm")
+		return res, 0, permFailError("unsupported hash algorithm")
 	}
-	// fmt.Println("hash: ", reflect.TypeOf(hash))
 	// Check key algo
 	if res.KeyAlgo != keyAlgo {
-		return verif, permFailError("inappropriate key algorithm")
+		return res, 0, permFailError("inappropriate key algorithm")
 	}
 
 	if res.Services != nil {
@@ -370,102 +598,51 @@ func verify(h header, r io.Reader, sigField, sigValue string, options *VerifyOpt
 			}
 		}
 		if !ok {
-			return verif, permFailError("inappropriate service")
+			return res, 0, permFailError("inappropriate service")
 		}
 	}
 
-	headerCan, bodyCan := parseCanonicalization(params["c"])
-	
-	if _, ok := canonicalizers[headerCan]; !ok {
-		return verif, permFailError("unsupported header canonicalization algorithm")
-	}
-	if _, ok := canonicalizers[bodyCan]; !ok {
-		return verif, permFailError("unsupported body canonicalization algorithm")
-	}
-
-	// The body length "l" parameter is insecure, because it allows parts of
-	// the message body to not be signed. Reject messages which have it set.
-	if _, ok := params["l"]; ok {
-		// TODO: technically should be policyError
-		return verif, failError("message contains an insecure body length tag")
-	}
+	return res, hash, nil
+}
 
-	// Parse body hash and signature
-	bodyHashed, err := decodeBase64String(params["bh"])
-	fmt.Println("bodyHashed: ", bodyHashed)
-	if err != nil {
-		return verif, permFailError("malformed body hash: " + err.Error())
-	}
-	sig, err := decodeBase64String(params["b"])
-	if err != nil {
-		return verif, permFailError("malformed signature: " + err.Error())
-	}
-	fmt.Println("sig: ", sig)
-	// Check body hash
-	hasher := hash.New()
-	fmt.Println("hasher: ", hasher)
-	fmt.Println("bodyCan: ", bodyCan)
-	// fmt.Println("r: ", r)
-	wc := canonicalizers[bodyCan].CanonicalizeBody(hasher)
-	fmt.Println("wc: ", wc)
-	if _, err := io.Copy(wc, r); err != nil {
-		return verif, err
-	}
-	if err := wc.Close(); err != nil {
-		return verif, err
-	}
-	fmt.Println("hasher.Sum(nil): ", hasher.Sum(nil))
-	fmt.Println("bodyHashed: ", bodyHashed)
-	if subtle.ConstantTimeCompare(hasher.Sum(nil), bodyHashed) != 1 {
-		return verif, failError("body hash did not verify")
-	}
+const (
+	errTestingKey         = policyError("key is in testing mode")
+	errInsecureBodyLength = policyError("message contains an insecure body length tag")
+)
 
-	// Compute data hash
-	hasher.Reset()
-	picker := newHeaderPicker(h)
-	for _, key := range headerKeys {
-		kv := picker.Pick(key)
-		if kv == "" {
-			// The field MAY contain names of header fields that do not exist
-			// when signed; nonexistent header fields do not contribute to the
-			// signature computation
-			continue
+// checkKeyFlags enforces the flags of a key record, as defined in RFC 6376
+// section 3.6.1. Keys in testing mode are rejected by checkPolicy.
+func checkKeyFlags(res *queryResult, domain, identifier string) error {
+	if res.Strict() && identifier != "" {
+		// The "i" domain must not be a subdomain of "d"
+		i := strings.LastIndexByte(identifier, '@')
+		if !strings.EqualFold(identifier[i+1:], domain) {
+			return permFailError("domain mismatch: key doesn't allow subdomains")
 		}
-		kv = canonicalizers[headerCan].CanonicalizeHeader(kv)
-			fmt.Println("kv: ", kv)
-		if _, err := hasher.Write([]byte(kv)); err != nil {
-			return verif, err
-		}
-		fmt.Println("hasher: ", hasher)
 	}
-	fmt.Println("SigField: ", sigField)
-	canSigField := removeSignature(sigField)
-	fmt.Println("canSigField: ", canSigField)
-	canSigField = canonicalizers[headerCan].CanonicalizeHeader(canSigField)
-	fmt.Println("canSigField: ", canSigField)
-	canSigField = strings.TrimRight(canSigField, "\r\n")
-	fmt.Println("canSigField: ", canSigField)
-	if _, err := hasher.Write([]byte(canSigField)); err != nil {
-		return verif, err
+	return nil
+}
+
+// parseBodyLength returns the value of the body length tag, or -1 if the
+// signature covers the whole body.
+func parseBodyLength(params map[string]string, allow bool) (int64, error) {
+	s, ok := params["l"]
+	if !ok {
+		return -1, nil
 	}
-	hashed := hasher.Sum(nil)
-	fmt.Println("hashed: ", hashed)
-	// Check signature
-	if err := res.Verifier.Verify(hash, hashed, sig); err != nil {
-		// fmt.Println("verif: ", verif)
-		return verif, failError("signature did not verify: " + err.Error())
+
+	// The body length "l" parameter is insecure, because it allows parts of
+	// the message body to not be signed. Reject messages which have it set,
+	// unless explicitly allowed.
+	if !allow {
+		return -1, errInsecureBodyLength
 	}
-	// fmt.Println("verif: ", verif)
-	fmt.Println("Out of verify()")
-	return verif, nil
-}
 
-func parseTagList(s string) []string {
-	tags := strings.Split(s, ":")
-	for i, t := range tags {
-		tags[i] = stripWhitespace(t)
+	l, err := strconv.ParseInt(stripWhitespace(s), 10, 64)
+	if err != nil || l < 0 {
+		return -1, permFailError("malformed body length tag")
 	}
-	return tags
+	return l, nil
 }
 
 func parseCanonicalization(s string) (headerCan, bodyCan Canonicalization) {
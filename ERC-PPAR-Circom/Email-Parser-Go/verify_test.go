@@ -0,0 +1,187 @@
+package dkim
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVerify_bodyLength(t *testing.T) {
+	body := testMessage[len(testMessage)-len("Hi,\r\n\r\nApprove recovery code: 482911\r\n\r\nAlice\r\n"):]
+	signed := testSignBodyLength(t, testMessage, int64(len(body)), "Appended by an attacker\r\n")
+	lookup := testLookupTXT(t, testRSAKey.Public())
+
+	verif := testVerify(t, signed, &VerifyOptions{LookupTXT: lookup})
+	if !IsPolicyFail(verif.Err) {
+		t.Errorf("Verification.Err = %v, want a policy error", verif.Err)
+	}
+
+	verif = testVerify(t, signed, &VerifyOptions{LookupTXT: lookup, AllowBodyLength: true})
+	if verif.Err != nil {
+		t.Fatalf("Verification.Err = %v", verif.Err)
+	}
+	if !verif.Partial || verif.BodyLength != int64(len(body)) {
+		t.Errorf("Partial, BodyLength = %v, %v, want true, %v", verif.Partial, verif.BodyLength, len(body))
+	}
+
+	short := testSignBodyLength(t, testMessage, int64(len(body)), "")
+	short = short[:len(short)-len("Alice\r\n")]
+	if verif := testVerify(t, short, &VerifyOptions{LookupTXT: lookup, AllowBodyLength: true}); verif.Err == nil {
+		t.Error("Verification.Err = nil with a body shorter than the body length tag")
+	}
+}
+
+func TestVerify_details(t *testing.T) {
+	signed := testSign(t, testMessage, &SignOptions{
+		Identifier:             "alice@example.org",
+		HeaderCanonicalization: CanonicalizationRelaxed,
+		BodyCanonicalization:   CanonicalizationSimple,
+		HeaderKeys:             []string{"From", "To", "Subject"},
+	})
+	record, err := FormatKeyRecord(testRSAKey.Public())
+	if err != nil {
+		t.Fatalf("FormatKeyRecord() = %v", err)
+	}
+	record += "; n=recovery key; t=s:y"
+
+	verif := testVerify(t, signed, &VerifyOptions{
+		LookupTXT: func(domain string) ([]string, error) {
+			return []string{record}, nil
+		},
+	})
+	if verif.Err != nil {
+		t.Fatalf("Verification.Err = %v", verif.Err)
+	}
+
+	want := &Verification{
+		Domain:                 testDomain,
+		Identifier:             "alice@example.org",
+		Selector:               testSelector,
+		HeaderKeys:             []string{"From", "To", "Subject"},
+		Algorithm:              "rsa-sha256",
+		HeaderCanonicalization: CanonicalizationRelaxed,
+		BodyCanonicalization:   CanonicalizationSimple,
+		KeyAlgorithm:           "rsa",
+		KeySize:                2048,
+		KeyNotes:               "recovery key",
+		KeyFlags:               []string{"s", "y"},
+		Testing:                true,
+		KeyRecords:             [][]string{{record}},
+		Time:                   testTime,
+	}
+	got := *verif
+	got.Signature, got.BodyHash, got.Params = "", nil, nil
+	if !reflect.DeepEqual(&got, want) {
+		t.Errorf("VerifyWithOptions() = %+v, want %+v", &got, want)
+	}
+	if verif.Signature == "" || len(verif.BodyHash) != 32 || verif.Params["s"] != testSelector {
+		t.Errorf("Signature, BodyHash, Params = %q, %x, %v", verif.Signature, verif.BodyHash, verif.Params)
+	}
+}
+
+func TestVerify_keyFlags(t *testing.T) {
+	record, err := FormatKeyRecord(testRSAKey.Public())
+	if err != nil {
+		t.Fatalf("FormatKeyRecord() = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		identifier string
+		flags      string
+		reject     bool
+		check      func(error) bool
+	}{
+		{"testing", "", "y", false, func(err error) bool { return err == nil }},
+		{"testing rejected", "", "y", true, IsPolicyFail},
+		{"strict", "alice@example.org", "s", false, func(err error) bool { return err == nil }},
+		{"strict subdomain", "alice@mail.example.org", "s", false, IsPermFail},
+		{"subdomain", "alice@mail.example.org", "", false, func(err error) bool { return err == nil }},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			signed := testSign(t, testMessage, &SignOptions{Identifier: tc.identifier})
+			r := record
+			if tc.flags != "" {
+				r += "; t=" + tc.flags
+			}
+			verif := testVerify(t, signed, &VerifyOptions{
+				LookupTXT: func(domain string) ([]string, error) {
+					return []string{r}, nil
+				},
+				RejectTestingKeys: tc.reject,
+			})
+			if !tc.check(verif.Err) {
+				t.Errorf("Verification.Err = %v", verif.Err)
+			}
+		})
+	}
+}
+
+func TestBuildWitness_keyFlags(t *testing.T) {
+	record, err := FormatKeyRecord(testRSAKey.Public())
+	if err != nil {
+		t.Fatalf("FormatKeyRecord() = %v", err)
+	}
+	lookup := func(domain string) ([]string, error) {
+		return []string{record + "; t=y"}, nil
+	}
+
+	w := testWitness(t, testMessage, nil, &WitnessOptions{LookupTXT: lookup})
+	if !w.Testing {
+		t.Error("Witness.Testing = false with a testing key")
+	}
+
+	signed := testSign(t, testMessage, nil)
+	_, err = BuildWitness(bytes.NewReader(signed), &WitnessOptions{LookupTXT: lookup, RejectTestingKeys: true})
+	if !IsPolicyFail(err) {
+		t.Errorf("BuildWitness() = %v, want a policy error", err)
+	}
+}
+
+func TestVerify_policyForged(t *testing.T) {
+	record, err := FormatKeyRecord(testRSAKey.Public())
+	if err != nil {
+		t.Fatalf("FormatKeyRecord() = %v", err)
+	}
+	testingLookup := func(domain string) ([]string, error) {
+		return []string{record + "; t=y"}, nil
+	}
+	lookup := testLookupTXT(t, testRSAKey.Public())
+	prefix := "Hi,\r\n\r\nApprove recovery code: 482911\r\n"
+
+	tests := []struct {
+		name    string
+		signed  []byte
+		options *VerifyOptions
+	}{
+		{"testing", testSign(t, testMessage, nil), &VerifyOptions{LookupTXT: testingLookup, RejectTestingKeys: true}},
+		{"body-length", testSignBodyLength(t, testMessage, int64(len(prefix)), ""), &VerifyOptions{LookupTXT: lookup}},
+		{"freshness", testSign(t, testMessage, nil), &VerifyOptions{
+			LookupTXT: lookup,
+			Freshness: &FreshnessPolicy{MaxAge: time.Hour},
+			Now:       func() time.Time { return testTime.Add(2 * time.Hour) },
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// A valid signature is rejected by the policy
+			if verif := testVerify(t, tc.signed, tc.options); !IsPolicyFail(verif.Err) {
+				t.Errorf("Verification.Err = %v, want a policy error", verif.Err)
+			}
+
+			// A forged one fails, whatever the policy
+			forged := map[string][]byte{
+				"header": bytes.Replace(tc.signed, []byte("Subject: Account recovery"), []byte("Subject: Account takeover"), 1),
+				"body":   bytes.Replace(tc.signed, []byte("482911"), []byte("000000"), 1),
+			}
+			for name, msg := range forged {
+				verif := testVerify(t, msg, tc.options)
+				if VerificationResult(verif) != AuthResultFail {
+					t.Errorf("forged %v: Verification.Err = %v, want a failure", name, verif.Err)
+				}
+			}
+		})
+	}
+}
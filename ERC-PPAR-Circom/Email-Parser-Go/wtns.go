@@ -0,0 +1,244 @@
+package dkim
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// WTNS is a circom witness, as stored in .wtns files: the value of every
+// wire of a circuit, the first one being the constant 1.
+type WTNS struct {
+	// The order of the field.
+	Prime  *big.Int
+	Values []*big.Int
+}
+
+const (
+	wtnsMagic   = "wtns"
+	wtnsVersion = 2
+
+	wtnsSectionHeader = 1
+	wtnsSectionData   = 2
+)
+
+// WriteWTNS writes a witness in the .wtns format, version 2: a header
+// section with the element size, the prime and the number of values,
+// followed by a data section with the values. All integers are
+// little-endian.
+func WriteWTNS(w io.Writer, wtns *WTNS) error {
+	n8 := (wtns.Prime.BitLen() + 63) / 64 * 8
+
+	var b bytes.Buffer
+	b.WriteString(wtnsMagic)
+	binary.Write(&b, binary.LittleEndian, uint32(wtnsVersion))
+	binary.Write(&b, binary.LittleEndian, uint32(2))
+
+	binary.Write(&b, binary.LittleEndian, uint32(wtnsSectionHeader))
+	binary.Write(&b, binary.LittleEndian, uint64(4+n8+4))
+	binary.Write(&b, binary.LittleEndian, uint32(n8))
+	b.Write(littleEndian(wtns.Prime, n8))
+	binary.Write(&b, binary.LittleEndian, uint32(len(wtns.Values)))
+
+	binary.Write(&b, binary.LittleEndian, uint32(wtnsSectionData))
+	binary.Write(&b, binary.LittleEndian, uint64(n8*len(wtns.Values)))
+	for i, v := range wtns.Values {
+		if v.Sign() < 0 || v.Cmp(wtns.Prime) >= 0 {
+			return fmt.Errorf("dkim: witness value %v is outside of the field", i)
+		}
+		b.Write(littleEndian(v, n8))
+	}
+
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// ReadWTNS reads a witness in the .wtns format.
+func ReadWTNS(r io.Reader) (*WTNS, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 12 || string(b[:4]) != wtnsMagic {
+		return nil, errors.New("dkim: not a wtns file")
+	}
+	if v := binary.LittleEndian.Uint32(b[4:]); v != wtnsVersion {
+		return nil, fmt.Errorf("dkim: unsupported wtns version %v", v)
+	}
+	nSections := binary.LittleEndian.Uint32(b[8:])
+	b = b[12:]
+
+	sections := make(map[uint32][]byte)
+	for i := uint32(0); i < nSections; i++ {
+		if len(b) < 12 {
+			return nil, errors.New("dkim: truncated wtns file")
+		}
+		typ := binary.LittleEndian.Uint32(b)
+		size := binary.LittleEndian.Uint64(b[4:])
+		b = b[12:]
+		if uint64(len(b)) < size {
+			return nil, errors.New("dkim: truncated wtns file")
+		}
+		sections[typ] = b[:size]
+		b = b[size:]
+	}
+
+	header, data := sections[wtnsSectionHeader], sections[wtnsSectionData]
+	if len(header) < 4 {
+		return nil, errors.New("dkim: wtns file has no header section")
+	}
+	n8 := int(binary.LittleEndian.Uint32(header))
+	if n8 == 0 || n8%8 != 0 || len(header) != 4+n8+4 {
+		return nil, errors.New("dkim: malformed wtns header section")
+	}
+	wtns := &WTNS{Prime: fromLittleEndian(header[4 : 4+n8])}
+	n := int(binary.LittleEndian.Uint32(header[4+n8:]))
+	if len(data) != n*n8 {
+		return nil, errors.New("dkim: malformed wtns data section")
+	}
+	wtns.Values = make([]*big.Int, n)
+	for i := range wtns.Values {
+		wtns.Values[i] = fromLittleEndian(data[i*n8 : (i+1)*n8])
+	}
+	return wtns, nil
+}
+
+// Signals extracts the inputs of the main component from a witness. sym is
+// the symbol file generated by circom (--sym), mapping signal names to
+// witness values, and layout describes the inputs to extract.
+func (wtns *WTNS) Signals(sym io.Reader, layout []SignalLayout) ([]Signal, error) {
+	wires, err := readSym(sym)
+	if err != nil {
+		return nil, err
+	}
+
+	signals := make([]Signal, len(layout))
+	for i, l := range layout {
+		if err := l.check(); err != nil {
+			return nil, err
+		}
+		names := []string{"main." + l.Name}
+		if !l.Scalar {
+			names = make([]string, l.Len)
+			for j := range names {
+				names[j] = fmt.Sprintf("main.%v[%v]", l.Name, j)
+			}
+		}
+
+		values := make([]*big.Int, len(names))
+		for j, name := range names {
+			wire, ok := wires[name]
+			if !ok {
+				return nil, fmt.Errorf("dkim: signal %q not found in symbol file", name)
+			}
+			if wire < 0 || wire >= len(wtns.Values) {
+				return nil, fmt.Errorf("dkim: signal %q has no witness value", name)
+			}
+			values[j] = wtns.Values[wire]
+		}
+		signals[i] = l.signal(values)
+	}
+	return signals, nil
+}
+
+// readSym reads a circom symbol file, made of "label,wire,component,name"
+// lines. Signals removed by the optimizer have the wire -1.
+func readSym(r io.Reader) (map[string]int, error) {
+	wires := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, ",", 4)
+		if len(fields) != 4 {
+			return nil, errors.New("dkim: malformed symbol file")
+		}
+		wire, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, errors.New("dkim: malformed symbol file")
+		}
+		wires[fields[3]] = wire
+	}
+	return wires, scanner.Err()
+}
+
+// A WASMWitnessCalculator computes circom witnesses with the witness
+// calculator generated by circom (--wasm), run by Node.js.
+type WASMWitnessCalculator struct {
+	// WASM is the path of the circuit WebAssembly module. The
+	// generate_witness.js script generated along with it must be in the same
+	// directory.
+	WASM string
+	// Node is the Node.js executable. If empty, "node" is used.
+	Node string
+}
+
+// Calculate computes the witness of the circuit for the given inputs.
+func (c *WASMWitnessCalculator) Calculate(signals []Signal) (*WTNS, error) {
+	dir, err := os.MkdirTemp("", "wtns")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	b, err := json.Marshal(SignalsInput(signals))
+	if err != nil {
+		return nil, err
+	}
+	input := filepath.Join(dir, "input.json")
+	if err := os.WriteFile(input, b, 0600); err != nil {
+		return nil, err
+	}
+
+	node := c.Node
+	if node == "" {
+		node = "node"
+	}
+	script := filepath.Join(filepath.Dir(c.WASM), "generate_witness.js")
+	output := filepath.Join(dir, "witness.wtns")
+	var stderr bytes.Buffer
+	cmd := exec.Command(node, script, c.WASM, input, output)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("dkim: witness calculator failed: %v: %v", err, msg)
+		}
+		return nil, fmt.Errorf("dkim: witness calculator failed: %v", err)
+	}
+
+	f, err := os.Open(output)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadWTNS(f)
+}
+
+func littleEndian(x *big.Int, n int) []byte {
+	b := x.FillBytes(make([]byte, n))
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return b
+}
+
+func fromLittleEndian(b []byte) *big.Int {
+	be := make([]byte, len(b))
+	for i, c := range b {
+		be[len(b)-1-i] = c
+	}
+	return new(big.Int).SetBytes(be)
+}
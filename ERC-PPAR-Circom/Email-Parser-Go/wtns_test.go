@@ -0,0 +1,164 @@
+package dkim
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// testWTNS lays signals out in a witness, the way circom assigns the wires of
+// the main component inputs, and returns it with its symbol file.
+func testWTNS(signals []Signal) (*WTNS, string) {
+	wtns := &WTNS{Prime: BN254ScalarField, Values: []*big.Int{big.NewInt(1)}}
+	var sym strings.Builder
+	for _, s := range signals {
+		for i, v := range s.Values {
+			name := fmt.Sprintf("main.%v[%v]", s.Name, i)
+			if s.Scalar {
+				name = "main." + s.Name
+			}
+			fmt.Fprintf(&sym, "%v,%v,0,%v\n", len(wtns.Values), len(wtns.Values), name)
+			wtns.Values = append(wtns.Values, v)
+		}
+	}
+	// Signals removed by the optimizer have no wire
+	fmt.Fprintf(&sym, "%v,-1,1,main.sub.tmp\n", len(wtns.Values))
+	return wtns, sym.String()
+}
+
+func TestWTNS(t *testing.T) {
+	w := testPartialWitness(t)
+	signature, combined, claims := testSignals(t, w)
+	wtns, sym := testWTNS(combined)
+
+	var b bytes.Buffer
+	if err := WriteWTNS(&b, wtns); err != nil {
+		t.Fatalf("WriteWTNS() = %v", err)
+	}
+	read, err := ReadWTNS(&b)
+	if err != nil {
+		t.Fatalf("ReadWTNS() = %v", err)
+	}
+	if read.Prime.Cmp(BN254ScalarField) != 0 || len(read.Values) != len(wtns.Values) {
+		t.Fatalf("ReadWTNS() = %v values modulo %v, want %v values modulo %v", len(read.Values), read.Prime, len(wtns.Values), BN254ScalarField)
+	}
+
+	decoded, err := read.Signals(strings.NewReader(sym), Layout(combined))
+	if err != nil {
+		t.Fatalf("WTNS.Signals() = %v", err)
+	}
+	if !signalsEqual(decoded, combined) {
+		t.Errorf("WTNS.Signals() doesn't return the witness inputs")
+	}
+
+	got, err := WitnessFromSignals(signature, decoded, claims)
+	if err != nil {
+		t.Fatalf("WitnessFromSignals() = %v", err)
+	}
+	checkDecodedWitness(t, got, w)
+}
+
+func TestWTNS_invalid(t *testing.T) {
+	wtns := &WTNS{Prime: BN254ScalarField, Values: []*big.Int{big.NewInt(1), BN254ScalarField}}
+	if err := WriteWTNS(new(bytes.Buffer), wtns); err == nil {
+		t.Errorf("WriteWTNS() succeeded with a value outside of the field")
+	}
+
+	wtns.Values[1] = big.NewInt(2)
+	var b bytes.Buffer
+	if err := WriteWTNS(&b, wtns); err != nil {
+		t.Fatalf("WriteWTNS() = %v", err)
+	}
+	valid := b.Bytes()
+	version := append([]byte(nil), valid...)
+	version[4] = 1
+
+	for name, data := range map[string][]byte{
+		"magic":     append([]byte("wtnx"), valid[4:]...),
+		"version":   version,
+		"truncated": valid[:len(valid)-1],
+		"empty":     nil,
+	} {
+		if _, err := ReadWTNS(bytes.NewReader(data)); err == nil {
+			t.Errorf("ReadWTNS() succeeded for %v", name)
+		}
+	}
+
+	sym := "1,1,0,main.a\n2,-1,0,main.b\n3,5,0,main.c\n"
+	for _, l := range []SignalLayout{
+		{Name: "b", Scalar: true, Len: 1},
+		{Name: "c", Scalar: true, Len: 1},
+		{Name: "d", Scalar: true, Len: 1},
+		{Name: "a", Len: 1},
+	} {
+		if _, err := wtns.Signals(strings.NewReader(sym), []SignalLayout{l}); err == nil {
+			t.Errorf("WTNS.Signals() succeeded for signal %q", l.Name)
+		}
+	}
+	if _, err := wtns.Signals(strings.NewReader("main.a\n"), nil); err == nil {
+		t.Errorf("WTNS.Signals() succeeded with a malformed symbol file")
+	}
+}
+
+func TestWASMWitnessCalculator(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake Node.js executable is a shell script")
+	}
+	w := testPartialWitness(t)
+	_, combined, _ := testSignals(t, w)
+	wtns, _ := testWTNS(combined)
+
+	// The fake Node.js executable checks its arguments, keeps the input
+	// and writes a precomputed witness
+	dir := t.TempDir()
+	var b bytes.Buffer
+	if err := WriteWTNS(&b, wtns); err != nil {
+		t.Fatalf("WriteWTNS() = %v", err)
+	}
+	wtnsPath := filepath.Join(dir, "precomputed.wtns")
+	if err := os.WriteFile(wtnsPath, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wasm := filepath.Join(dir, "circuit_js", "circuit.wasm")
+	inputPath := filepath.Join(dir, "input.json")
+	script := fmt.Sprintf(`#!/bin/sh
+[ "$1" = %q ] && [ "$2" = %q ] || { echo "unexpected arguments: $*" >&2; exit 1; }
+cp "$3" %q && cp %q "$4"
+`, filepath.Join(filepath.Dir(wasm), "generate_witness.js"), wasm, inputPath, wtnsPath)
+	node := filepath.Join(dir, "node")
+	if err := os.WriteFile(node, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	calc := &WASMWitnessCalculator{WASM: wasm, Node: node}
+	got, err := calc.Calculate(combined)
+	if err != nil {
+		t.Fatalf("Calculate() = %v", err)
+	}
+	if len(got.Values) != len(wtns.Values) {
+		t.Errorf("Calculate() returned %v values, want %v", len(got.Values), len(wtns.Values))
+	}
+
+	f, err := os.Open(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	input, err := ReadCircuitInput(f, false)
+	if err != nil {
+		t.Fatalf("ReadCircuitInput() = %v", err)
+	}
+	if len(input) != len(combined) {
+		t.Errorf("witness calculator input has %v signals, want %v", len(input), len(combined))
+	}
+
+	calc.WASM = filepath.Join(dir, "other", "circuit.wasm")
+	if _, err := calc.Calculate(combined); err == nil || !strings.Contains(err.Error(), "unexpected arguments") {
+		t.Errorf("Calculate() = %v, want the witness calculator error", err)
+	}
+}